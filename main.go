@@ -1,13 +1,32 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+	// embed the timezone database, so schedules run in their timezone on hosts without one
+	_ "time/tzdata"
+
 	"github.com/gin-gonic/gin"
 
 	"github.com/mdcantarini/transaction-processor-api/pkg/model"
 	"github.com/mdcantarini/transaction-processor-api/pkg/service"
 )
 
+// shutdownTimeout bounds the time given to the requests in flight to complete once the service is stopped
+const shutdownTimeout = 30 * time.Second
+
 func main() {
+	// the service stops on interrupt or termination
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
 	// set up the service
 	s := service.NewService()
 
@@ -17,19 +36,78 @@ func main() {
 		panic(err)
 	}
 
+	var wg sync.WaitGroup
+
+	// deliver the report emails in the background
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		s.RunOutboxWorker(ctx)
+	}()
+
+	// run the scheduled reports in the background
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		s.RunScheduler(ctx)
+	}()
+
 	// set up http router
 	router := gin.Default()
 	router.POST("/transactions/run-daily-report", s.RunDailyReport)
+	router.POST("/transactions/imports", s.ImportTransactions)
+	router.GET("/transactions", s.ListTransactions)
+	router.GET("/transactions/:transactionId", s.GetTransaction)
+	router.GET("/imports", s.ListImportBatches)
+	router.GET("/imports/:id", s.GetImportBatch)
+	router.GET("/imports/:id/rejects", s.GetImportBatchRejects)
+	router.POST("/fx-rates", s.ImportFXRates)
+	router.GET("/accounts", s.ListAccounts)
+	router.GET("/accounts/:id", s.GetAccount)
+	router.POST("/accounts", s.CreateAccount)
+	router.PATCH("/accounts/:id", s.UpdateAccount)
+	router.DELETE("/accounts/:id", s.DeleteAccount)
+	router.GET("/accounts/:id/summary", s.GetAccountSummary)
+	router.GET("/accounts/:id/report/preview", s.PreviewAccountReport)
+	router.GET("/outbox", s.ListOutboxMessages)
+	router.GET("/outbox/:id", s.GetOutboxMessage)
+	router.POST("/reports", s.CreateReportDefinition)
+	router.GET("/reports", s.ListReportDefinitions)
+	router.GET("/reports/:id", s.GetReportDefinition)
+	router.POST("/reports/:id/subscriptions", s.SubscribeAccount)
+	router.DELETE("/reports/:id/subscriptions/:accountId", s.UnsubscribeAccount)
+	router.POST("/reports/:id/run", s.RunReport)
+	router.POST("/schedules", s.CreateSchedule)
+	router.GET("/schedules", s.ListSchedules)
 
-	err = router.Run(":8000")
-	if err != nil {
-		panic(err)
+	server := &http.Server{Addr: ":8000", Handler: router}
+	serverErr := make(chan error, 1)
+	go func() {
+		serverErr <- server.ListenAndServe()
+	}()
+
+	select {
+	case err = <-serverErr:
+	case <-ctx.Done():
+		// the requests in flight are completed before the background workers are waited for
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+		err = server.Shutdown(shutdownCtx)
+	}
+
+	// the outbox worker leaves the undelivered emails pending, while the scheduler completes the runs it started
+	stop()
+	wg.Wait()
+
+	if err != nil && !errors.Is(err, http.ErrServerClosed) {
+		log.Fatal(err)
 	}
 }
 
+// seedDB creates the seeded accounts, filling the base currency of the existing ones which lack it
 func seedDB(s *service.Service) error {
 	accounts := []model.Account{
-		{Email: "martin.d.cantarini@gmail.com"},
+		{Email: "martin.d.cantarini@gmail.com", BaseCurrency: "USD"},
 	}
 
 	return s.AccountRepo().UpsertAccounts(accounts)
@@ -0,0 +1,229 @@
+package converter
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/mdcantarini/transaction-processor-api/pkg/model"
+)
+
+const camt053ParsingError = `unable to parse camt.053 file`
+
+// credit and debit indicators of camt.053 entries
+const (
+	camtCredit = "CRDT"
+	camtDebit  = "DBIT"
+)
+
+// camtBooked is the status of booked entries, other entries like pending or information only ones are not
+// transactions of the account yet
+const camtBooked = "BOOK"
+
+type camtAccount struct {
+	IBAN  string `xml:"Id>IBAN"`
+	Other string `xml:"Id>Othr>Id"`
+	Ccy   string `xml:"Ccy"`
+}
+
+func (a camtAccount) number() string {
+	if a.IBAN != "" {
+		return strings.ReplaceAll(a.IBAN, " ", "")
+	}
+
+	return a.Other
+}
+
+type camtAmount struct {
+	Value string `xml:",chardata"`
+	Ccy   string `xml:"Ccy,attr"`
+}
+
+// camtStatus is the status of an entry, a code in version 02 and a Cd element holding it since version 08
+type camtStatus struct {
+	Value string `xml:",chardata"`
+	Cd    string `xml:"Cd"`
+}
+
+func (s camtStatus) code() string {
+	if s.Cd != "" {
+		return strings.TrimSpace(s.Cd)
+	}
+
+	return strings.TrimSpace(s.Value)
+}
+
+type camtEntry struct {
+	NtryRef     string     `xml:"NtryRef"`
+	Amt         camtAmount `xml:"Amt"`
+	CdtDbtInd   string     `xml:"CdtDbtInd"`
+	Sts         camtStatus `xml:"Sts"`
+	BookgDt     string     `xml:"BookgDt>Dt"`
+	BookgDtTm   string     `xml:"BookgDt>DtTm"`
+	AcctSvcrRef string     `xml:"AcctSvcrRef"`
+	// reference of the first transaction details, used when the entry has no reference of its own. The end to end
+	// ID is not used, since it is set by the originator of the payment and is not unique within the account.
+	TxAcctSvcrRef string `xml:"NtryDtls>TxDtls>Refs>AcctSvcrRef"`
+}
+
+func (e camtEntry) reference() string {
+	for _, ref := range []string{e.NtryRef, e.AcctSvcrRef, e.TxAcctSvcrRef} {
+		if ref != "" && ref != "NOTPROVIDED" {
+			return ref
+		}
+	}
+
+	return ""
+}
+
+// key identifies the entry within its bank account. Account servicer references are assigned by the bank and unique
+// within the account, whereas entry references are often numbered within each statement, so they only identify the
+// entry along with the statement ID and the booking date.
+func (e camtEntry) key(statementID string) string {
+	for _, ref := range []string{e.AcctSvcrRef, e.TxAcctSvcrRef} {
+		if ref != "" && ref != "NOTPROVIDED" {
+			return ref
+		}
+	}
+
+	return fmt.Sprintf("%s|%s%s|%s", statementID, e.BookgDt, e.BookgDtTm, e.NtryRef)
+}
+
+// ParseCAMT053 reads the booked entries of an ISO 20022 camt.053 bank to customer statement file
+func ParseCAMT053(r io.Reader) ([]StatementEntry, error) {
+	decoder := xml.NewDecoder(r)
+
+	var entries []StatementEntry
+	var account *camtAccount
+	var statementID string
+	// depth of the current element and of the current statement, so the Id of the statement is told apart from
+	// the Id elements nested in other elements
+	depth, statementDepth := 0, -1
+	for {
+		line, _ := decoder.InputPos()
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", camt053ParsingError, err)
+		}
+
+		if _, ok := token.(xml.EndElement); ok {
+			depth--
+			continue
+		}
+
+		start, ok := token.(xml.StartElement)
+		if !ok {
+			continue
+		}
+
+		depth++
+		switch start.Name.Local {
+		case "Stmt":
+			// every statement has its own account
+			account = nil
+			statementID = ""
+			statementDepth = depth
+		case "Id":
+			if depth != statementDepth+1 {
+				continue
+			}
+
+			depth--
+			err = decoder.DecodeElement(&statementID, &start)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", camt053ParsingError, err)
+			}
+		case "Acct":
+			depth--
+			account = &camtAccount{}
+			err = decoder.DecodeElement(account, &start)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", camt053ParsingError, err)
+			}
+		case "Ntry":
+			depth--
+			if account == nil || account.number() == "" {
+				return nil, fmt.Errorf("%s: entry in line %d has no account", camt053ParsingError, line)
+			}
+
+			entry := camtEntry{}
+			err = decoder.DecodeElement(&entry, &start)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", camt053ParsingError, err)
+			}
+
+			if entry.Sts.code() != camtBooked {
+				continue
+			}
+
+			entries = append(entries, camtEntryToStatementEntry(line, *account, strings.TrimSpace(statementID), entry))
+		}
+	}
+
+	return entries, nil
+}
+
+func camtEntryToStatementEntry(line int, account camtAccount, statementID string, ntry camtEntry) StatementEntry {
+	bankAccount := account.number()
+	entry := StatementEntry{Line: line, BankAccount: bankAccount}
+	addError := func(column, value string, err error) {
+		entry.Errors = append(entry.Errors, RowError{Line: line, Column: column, Value: value, Reason: err.Error()})
+	}
+
+	reference := ntry.reference()
+	if reference == "" {
+		addError("NtryRef", "", fmt.Errorf("missing entry reference"))
+	}
+
+	amount, err := stringToDecimal(strings.TrimSpace(ntry.Amt.Value))
+	if err != nil {
+		addError("Amt", ntry.Amt.Value, err)
+	}
+
+	switch ntry.CdtDbtInd {
+	case camtCredit:
+	case camtDebit:
+		amount = amount.Neg()
+	default:
+		addError("CdtDbtInd", ntry.CdtDbtInd, fmt.Errorf("unknown credit debit indicator %s", ntry.CdtDbtInd))
+	}
+
+	date, err := camtStringToDate(ntry.BookgDt, ntry.BookgDtTm)
+	if err != nil {
+		addError("BookgDt", ntry.BookgDt+ntry.BookgDtTm, err)
+	}
+
+	currency := ntry.Amt.Ccy
+	if currency == "" {
+		currency = account.Ccy
+	}
+
+	entry.Transaction = model.Transaction{
+		TransactionID:     StatementTransactionID(FormatCAMT053, bankAccount, ntry.key(statementID)),
+		ExternalID:        reference,
+		Date:              date,
+		TransactionAmount: amount,
+		Currency:          currency,
+	}
+
+	return entry
+}
+
+// camtStringToDate converts the booking date, which is either a date or a datetime, keeping the date only
+func camtStringToDate(date, dateTime string) (time.Time, error) {
+	if date == "" && len(dateTime) >= len(dateFormat) {
+		date = dateTime[:len(dateFormat)]
+	}
+
+	d, err := time.Parse(dateFormat, date)
+	if err != nil {
+		return time.Now(), fmt.Errorf("unable to convert %s into date", date+dateTime)
+	}
+
+	return d, nil
+}
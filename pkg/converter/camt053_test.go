@@ -0,0 +1,120 @@
+package converter
+
+import (
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseCAMT053_Version02(t *testing.T) {
+	file, err := os.Open("testdata/camt053_v02.xml")
+	require.NoError(t, err)
+	defer file.Close()
+
+	entries, err := ParseCAMT053(file)
+	require.NoError(t, err)
+	// the pending entry is skipped
+	require.Len(t, entries, 3)
+
+	require.Equal(t, "DE89370400440532013000", entries[0].BankAccount)
+	require.Empty(t, entries[0].Errors)
+	require.Equal(t, 23, entries[0].Line)
+	require.Equal(t, "E2023121600001", entries[0].Transaction.ExternalID)
+	// the account servicer reference identifies the entry
+	require.Equal(t, StatementTransactionID(FormatCAMT053, "DE89370400440532013000", "BANKREF-1"), entries[0].Transaction.TransactionID)
+	require.Equal(t, time.Date(2023, 12, 15, 0, 0, 0, 0, time.UTC), entries[0].Transaction.Date)
+	require.Equal(t, decimal.RequireFromString("60.50"), entries[0].Transaction.TransactionAmount)
+	require.Equal(t, "EUR", entries[0].Transaction.Currency)
+
+	// debit entries are negative and the transaction details reference is used when the entry has none
+	require.Empty(t, entries[1].Errors)
+	require.Equal(t, "BANKREF-2", entries[1].Transaction.ExternalID)
+	require.Equal(t, decimal.RequireFromString("-10.30"), entries[1].Transaction.TransactionAmount)
+
+	require.Equal(t, []RowError{{Line: 47, Column: "CdtDbtInd", Value: "DEBIT", Reason: "unknown credit debit indicator DEBIT"}}, entries[2].Errors)
+}
+
+func TestParseCAMT053_Version08MultipleStatements(t *testing.T) {
+	file, err := os.Open("testdata/camt053_v08.xml")
+	require.NoError(t, err)
+	defer file.Close()
+
+	entries, err := ParseCAMT053(file)
+	require.NoError(t, err)
+	// the information only entry is skipped
+	require.Len(t, entries, 2)
+
+	require.Equal(t, "FR7630006000011234567890189", entries[0].BankAccount)
+	require.Equal(t, time.Date(2023, 12, 14, 0, 0, 0, 0, time.UTC), entries[0].Transaction.Date)
+	require.Equal(t, "USD", entries[0].Transaction.Currency)
+
+	require.Equal(t, "0001234567", entries[1].BankAccount)
+	require.Equal(t, "CH-0001", entries[1].Transaction.ExternalID)
+	require.Equal(t, decimal.RequireFromString("-42.00"), entries[1].Transaction.TransactionAmount)
+	// the account currency is used when the amount has none
+	require.Equal(t, "CHF", entries[1].Transaction.Currency)
+}
+
+func TestParseCAMT053_EntryReferencesNumberedPerStatement(t *testing.T) {
+	statement := func(id, date string) string {
+		return `<Stmt><Id>` + id + `</Id><Acct><Id><IBAN>DE89370400440532013000</IBAN></Id></Acct>
+<Ntry><NtryRef>1</NtryRef><Amt Ccy="EUR">10.00</Amt><CdtDbtInd>CRDT</CdtDbtInd><Sts>BOOK</Sts><BookgDt><Dt>` + date + `</Dt></BookgDt></Ntry>
+<Ntry><NtryRef>2</NtryRef><Amt Ccy="EUR">5.00</Amt><CdtDbtInd>DBIT</CdtDbtInd><Sts>BOOK</Sts><BookgDt><Dt>` + date + `</Dt></BookgDt></Ntry>
+</Stmt>`
+	}
+	first := `<Document><BkToCstmrStmt>` + statement("STMT-1", "2023-12-15") + `</BkToCstmrStmt></Document>`
+	second := `<Document><BkToCstmrStmt>` + statement("STMT-2", "2023-12-15") + `</BkToCstmrStmt></Document>`
+
+	firstEntries, err := ParseCAMT053(strings.NewReader(first))
+	require.NoError(t, err)
+	secondEntries, err := ParseCAMT053(strings.NewReader(second))
+	require.NoError(t, err)
+	require.Len(t, firstEntries, 2)
+	require.Len(t, secondEntries, 2)
+
+	// entries of the next statement reusing the entry references are not dropped as duplicates
+	ids := map[int]bool{}
+	for _, entry := range append(firstEntries, secondEntries...) {
+		require.Empty(t, entry.Errors)
+		ids[entry.Transaction.TransactionID] = true
+	}
+	require.Len(t, ids, 4)
+	require.Equal(t, "1", secondEntries[0].Transaction.ExternalID)
+
+	// importing the same statement again keeps its IDs
+	again, err := ParseCAMT053(strings.NewReader(first))
+	require.NoError(t, err)
+	require.Equal(t, firstEntries[0].Transaction.TransactionID, again[0].Transaction.TransactionID)
+}
+
+func TestParseCAMT053_EndToEndIDIsNotAReference(t *testing.T) {
+	content := `<Document><BkToCstmrStmt><Stmt><Acct><Id><IBAN>DE89370400440532013000</IBAN></Id></Acct>
+<Ntry><Amt Ccy="EUR">10.00</Amt><CdtDbtInd>CRDT</CdtDbtInd><Sts>BOOK</Sts><BookgDt><Dt>2023-12-15</Dt></BookgDt>
+<NtryDtls><TxDtls><Refs><EndToEndId>INVOICE-42</EndToEndId></Refs></TxDtls></NtryDtls></Ntry>
+</Stmt></BkToCstmrStmt></Document>`
+
+	entries, err := ParseCAMT053(strings.NewReader(content))
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+
+	// payments sharing an end to end ID would otherwise be dropped as duplicates
+	require.Equal(t, []RowError{{Line: 2, Column: "NtryRef", Value: "", Reason: "missing entry reference"}}, entries[0].Errors)
+}
+
+func TestParseCAMT053_EntryWithoutAccount(t *testing.T) {
+	content := `<Document><BkToCstmrStmt><Stmt><Ntry><NtryRef>1</NtryRef></Ntry></Stmt></BkToCstmrStmt></Document>`
+
+	_, err := ParseCAMT053(strings.NewReader(content))
+	require.ErrorContains(t, err, "has no account")
+}
+
+func TestDetectFormat_CAMT053(t *testing.T) {
+	content, err := os.ReadFile("testdata/camt053_v02.xml")
+	require.NoError(t, err)
+
+	require.Equal(t, FormatCAMT053, DetectFormat(content[:FormatDetectionBytes]))
+}
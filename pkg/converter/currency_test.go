@@ -0,0 +1,28 @@
+package converter
+
+import (
+	"testing"
+
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidateCurrencyAmount(t *testing.T) {
+	require.NoError(t, ValidateCurrencyAmount("EUR", decimal.RequireFromString("10.50")))
+	require.NoError(t, ValidateCurrencyAmount("JPY", decimal.RequireFromString("500")))
+	require.NoError(t, ValidateCurrencyAmount("KWD", decimal.RequireFromString("1.125")))
+	// trailing zeros do not count as decimal places
+	require.NoError(t, ValidateCurrencyAmount("JPY", decimal.RequireFromString("500.00")))
+
+	require.ErrorContains(t, ValidateCurrencyAmount("EUR", decimal.RequireFromString("10.001")), "more than 2 decimal places allowed by EUR")
+	require.ErrorContains(t, ValidateCurrencyAmount("JPY", decimal.RequireFromString("5.5")), "more than 0 decimal places allowed by JPY")
+	require.ErrorIs(t, ValidateCurrencyAmount("XYZ", decimal.RequireFromString("1")), ErrUnknownCurrency)
+	require.ErrorIs(t, ValidateCurrencyAmount("eur", decimal.RequireFromString("1")), ErrUnknownCurrency)
+}
+
+func TestFormatAmount(t *testing.T) {
+	require.Equal(t, "60.50", FormatAmount("USD", decimal.RequireFromString("60.5")))
+	require.Equal(t, "3.333", FormatAmount("BHD", decimal.RequireFromString("10").Div(decimal.RequireFromString("3"))))
+	require.Equal(t, "1000", FormatAmount("JPY", decimal.RequireFromString("1000")))
+	require.Equal(t, "1.2345", FormatAmount("XYZ", decimal.RequireFromString("1.2345")))
+}
@@ -0,0 +1,83 @@
+package converter
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/mdcantarini/transaction-processor-api/pkg/model"
+)
+
+const (
+	ExportFormatCSV  = "csv"
+	ExportFormatXLSX = "xlsx"
+)
+
+var errUnknownExportFormat = fmt.Errorf("unknown export format")
+
+// TransactionCSVHeader is the header of the exported transaction files, which can be imported back
+// with the default mapping profile
+var TransactionCSVHeader = []string{"Id", "Date", "Transaction", "Account", "Currency"}
+
+// TransactionRecord returns the transaction as a record of an exported transactions file. Dates are stored at
+// midnight UTC, so they are written in UTC whatever the location the database driver returns them in.
+func TransactionRecord(transaction model.Transaction) []string {
+	return []string{
+		strconv.Itoa(transaction.TransactionID),
+		transaction.Date.UTC().Format(time.DateOnly),
+		transaction.TransactionAmount.String(),
+		strconv.Itoa(transaction.AccountID),
+		transaction.Currency,
+	}
+}
+
+// ValidateExportFormat checks the export format is either ExportFormatCSV or ExportFormatXLSX
+func ValidateExportFormat(format string) error {
+	if format != ExportFormatCSV && format != ExportFormatXLSX {
+		return fmt.Errorf("%w %q", errUnknownExportFormat, format)
+	}
+
+	return nil
+}
+
+// ExportContentType returns the MIME type of the files written in the given export format
+func ExportContentType(format string) string {
+	if format == ExportFormatXLSX {
+		return "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
+	}
+
+	return "text/csv"
+}
+
+// ExportTransactions writes the transactions into w as a file in the given export format
+func ExportTransactions(w io.Writer, format string, transactions []model.Transaction) error {
+	switch format {
+	case ExportFormatCSV:
+		return WriteTransactionsCSV(w, transactions)
+	case ExportFormatXLSX:
+		return WriteTransactionsXLSX(w, transactions)
+	}
+
+	return ValidateExportFormat(format)
+}
+
+// WriteTransactionsCSV writes the transactions into w as a CSV file headed by TransactionCSVHeader
+func WriteTransactionsCSV(w io.Writer, transactions []model.Transaction) error {
+	writer := csv.NewWriter(w)
+	err := writer.Write(TransactionCSVHeader)
+	if err != nil {
+		return err
+	}
+
+	for _, transaction := range transactions {
+		err = writer.Write(TransactionRecord(transaction))
+		if err != nil {
+			return err
+		}
+	}
+
+	writer.Flush()
+	return writer.Error()
+}
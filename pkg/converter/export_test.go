@@ -0,0 +1,88 @@
+package converter
+
+import (
+	"archive/zip"
+	"bytes"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mdcantarini/transaction-processor-api/pkg/model"
+)
+
+var exportedTransactions = []model.Transaction{
+	{TransactionID: 1, Date: time.Date(2023, 12, 15, 0, 0, 0, 0, time.UTC), TransactionAmount: decimal.RequireFromString("60.5"), Currency: "USD", AccountID: 1},
+	{TransactionID: 2, Date: time.Date(2023, 12, 16, 0, 0, 0, 0, time.UTC), TransactionAmount: decimal.RequireFromString("-10.3"), Currency: "EUR", AccountID: 1},
+}
+
+func TestWriteTransactionsCSV(t *testing.T) {
+	var buf bytes.Buffer
+	require.NoError(t, WriteTransactionsCSV(&buf, exportedTransactions))
+	require.Equal(t, "Id,Date,Transaction,Account,Currency\n1,2023-12-15,60.5,1,USD\n2,2023-12-16,-10.3,1,EUR\n", buf.String())
+
+	// the exported file is imported back by the default mapping profile
+	reader := NewCSVTransactionReader(&buf, DefaultMappingProfile)
+	transaction, rowErrors, err := reader.Read()
+	require.NoError(t, err)
+	require.Empty(t, rowErrors)
+	require.Equal(t, 1, transaction.TransactionID)
+	require.Equal(t, "USD", transaction.Currency)
+}
+
+func TestTransactionRecord_UTCDate(t *testing.T) {
+	// the driver returns the date in the time zone of the session
+	newYork := time.FixedZone("EST", -5*60*60)
+	transaction := model.Transaction{TransactionID: 1, Date: time.Date(2023, 12, 15, 0, 0, 0, 0, time.UTC).In(newYork), AccountID: 1}
+
+	require.Equal(t, "2023-12-15", TransactionRecord(transaction)[1])
+}
+
+func TestWriteTransactionsXLSX(t *testing.T) {
+	var buf bytes.Buffer
+	require.NoError(t, WriteTransactionsXLSX(&buf, exportedTransactions))
+
+	archive, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	require.NoError(t, err)
+
+	parts := map[string]string{}
+	for _, file := range archive.File {
+		content, err := file.Open()
+		require.NoError(t, err)
+		data, err := io.ReadAll(content)
+		require.NoError(t, err)
+		parts[file.Name] = string(data)
+	}
+
+	require.Contains(t, parts, "[Content_Types].xml")
+	require.Contains(t, parts, "xl/workbook.xml")
+	sheet := parts["xl/worksheets/sheet1.xml"]
+	require.Contains(t, sheet, `<c r="A1" t="inlineStr"><is><t>Id</t></is></c>`)
+	require.Contains(t, sheet, `<row r="3"><c r="A3" t="inlineStr"><is><t>2</t></is></c><c r="B3" t="inlineStr"><is><t>2023-12-16</t></is></c><c r="C3"><v>-10.3</v></c><c r="D3" t="inlineStr"><is><t>1</t></is></c>`)
+}
+
+func TestWriteTransactionsXLSX_LargeIDs(t *testing.T) {
+	// IDs derived from statements exceed the 2^53 integers a double holds exactly
+	transactions := []model.Transaction{
+		{TransactionID: 9007199254740993, Date: time.Date(2023, 12, 15, 0, 0, 0, 0, time.UTC), TransactionAmount: decimal.RequireFromString("60.5"), Currency: "USD", AccountID: 1},
+	}
+
+	var buf bytes.Buffer
+	require.NoError(t, WriteTransactionsXLSX(&buf, transactions))
+
+	archive, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	require.NoError(t, err)
+
+	file, err := archive.Open("xl/worksheets/sheet1.xml")
+	require.NoError(t, err)
+	sheet, err := io.ReadAll(file)
+	require.NoError(t, err)
+
+	require.Contains(t, string(sheet), `<c r="A2" t="inlineStr"><is><t>9007199254740993</t></is></c>`)
+}
+
+func TestExportTransactions_UnknownFormat(t *testing.T) {
+	require.ErrorContains(t, ExportTransactions(io.Discard, "pdf", exportedTransactions), `unknown export format "pdf"`)
+}
@@ -0,0 +1,108 @@
+package converter
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+
+	"github.com/mdcantarini/transaction-processor-api/pkg/model"
+)
+
+// xlsxParts are the fixed parts of a workbook holding a single worksheet, which is written apart
+var xlsxParts = []struct {
+	name    string
+	content string
+}{
+	{"[Content_Types].xml", xml.Header + `<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">` +
+		`<Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>` +
+		`<Default Extension="xml" ContentType="application/xml"/>` +
+		`<Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/>` +
+		`<Override PartName="/xl/worksheets/sheet1.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/>` +
+		`</Types>`},
+	{"_rels/.rels", xml.Header + `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+		`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/>` +
+		`</Relationships>`},
+	{"xl/workbook.xml", xml.Header + `<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships">` +
+		`<sheets><sheet name="Transactions" sheetId="1" r:id="rId1"/></sheets>` +
+		`</workbook>`},
+	{"xl/_rels/workbook.xml.rels", xml.Header + `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+		`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet1.xml"/>` +
+		`</Relationships>`},
+}
+
+// xlsxNumericColumns are the indexes of the TransactionCSVHeader columns written as numbers rather than text. IDs
+// are written as text, since Excel keeps only 15 significant digits of numbers and statement transaction IDs
+// are longer.
+var xlsxNumericColumns = map[int]bool{2: true}
+
+// WriteTransactionsXLSX writes the transactions into w as an Excel workbook with the same columns as
+// WriteTransactionsCSV. Dates are written as text, so they read the same as in the CSV file.
+func WriteTransactionsXLSX(w io.Writer, transactions []model.Transaction) error {
+	archive := zip.NewWriter(w)
+	for _, part := range xlsxParts {
+		file, err := archive.Create(part.name)
+		if err != nil {
+			return err
+		}
+
+		_, err = io.WriteString(file, part.content)
+		if err != nil {
+			return err
+		}
+	}
+
+	file, err := archive.Create("xl/worksheets/sheet1.xml")
+	if err != nil {
+		return err
+	}
+
+	_, err = io.WriteString(file, xml.Header+`<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData>`)
+	if err != nil {
+		return err
+	}
+
+	err = writeXLSXRow(file, 1, TransactionCSVHeader, nil)
+	if err != nil {
+		return err
+	}
+
+	for i, transaction := range transactions {
+		err = writeXLSXRow(file, i+2, TransactionRecord(transaction), xlsxNumericColumns)
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err = io.WriteString(file, `</sheetData></worksheet>`)
+	if err != nil {
+		return err
+	}
+
+	return archive.Close()
+}
+
+func writeXLSXRow(w io.Writer, row int, values []string, numericColumns map[int]bool) error {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, `<row r="%d">`, row)
+	for i, value := range values {
+		// exported files have less than 26 columns, so every column is named by a single letter
+		ref := fmt.Sprintf("%c%d", 'A'+i, row)
+		if numericColumns[i] {
+			fmt.Fprintf(&buf, `<c r="%s"><v>%s</v></c>`, ref, value)
+			continue
+		}
+
+		fmt.Fprintf(&buf, `<c r="%s" t="inlineStr"><is><t>`, ref)
+		err := xml.EscapeText(&buf, []byte(value))
+		if err != nil {
+			return err
+		}
+		buf.WriteString(`</t></is></c>`)
+	}
+	buf.WriteString(`</row>`)
+
+	_, err := w.Write(buf.Bytes())
+	return err
+}
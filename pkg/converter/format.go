@@ -0,0 +1,45 @@
+package converter
+
+import (
+	"bytes"
+)
+
+// supported transaction file formats
+const (
+	FormatCSV     = "csv"
+	FormatOFX     = "ofx"
+	FormatCAMT053 = "camt.053"
+	FormatMT940   = "mt940"
+)
+
+// FormatDetectionBytes is the number of leading bytes needed by DetectFormat
+const FormatDetectionBytes = 1024
+
+// DetectFormat guesses the format of a transactions file from its leading bytes, falling back to CSV
+func DetectFormat(head []byte) string {
+	head = trimLeadingSpace(head)
+
+	switch {
+	case bytes.HasPrefix(head, []byte("OFXHEADER:")):
+		// OFX 1.x files start with a plain text header followed by SGML
+		return FormatOFX
+	case bytes.HasPrefix(head, []byte(":20:")) || (bytes.HasPrefix(head, []byte("{1:")) && bytes.Contains(head, []byte(":20:"))):
+		// MT940 statements start with their transaction reference, optionally wrapped in SWIFT blocks
+		return FormatMT940
+	case bytes.Contains(head, []byte("camt.053")) || bytes.Contains(head, []byte("<BkToCstmrStmt>")):
+		return FormatCAMT053
+	case bytes.HasPrefix(head, []byte("<?xml")) && (bytes.Contains(head, []byte("<?OFX")) || bytes.Contains(head, []byte("<OFX>"))):
+		return FormatOFX
+	case bytes.HasPrefix(head, []byte("<OFX>")):
+		return FormatOFX
+	default:
+		return FormatCSV
+	}
+}
+
+// trimLeadingSpace removes the byte order mark and the white space preceding the content
+func trimLeadingSpace(content []byte) []byte {
+	content = bytes.TrimPrefix(content, []byte("\ufeff"))
+
+	return bytes.TrimLeft(content, " \t\r\n")
+}
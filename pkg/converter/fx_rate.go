@@ -0,0 +1,148 @@
+package converter
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/shopspring/decimal"
+
+	"github.com/mdcantarini/transaction-processor-api/pkg/model"
+)
+
+// ErrMissingFXRate is returned when no rate converts an amount on the date of its transaction
+var ErrMissingFXRate = errors.New("missing fx rate")
+
+// RateFinder returns the rate converting amounts from one currency into another on the given date
+type RateFinder func(from, to string, date time.Time) (decimal.Decimal, error)
+
+// fxRateRecord is a rate as written in the rates files, either as a JSON object or a CSV row
+type fxRateRecord struct {
+	Pair   string      `json:"pair"`
+	Date   string      `json:"date"`
+	Rate   json.Number `json:"rate"`
+	Source string      `json:"source"`
+}
+
+var fxRateCSVHeader = []string{"pair", "date", "rate", "source"}
+
+// ParseFXRates reads the rates of a JSON array or a CSV file with the pair, date, rate and source columns.
+// The whole file is rejected when any of its rates is invalid.
+func ParseFXRates(r io.Reader) ([]model.FXRate, error) {
+	buffered := bufio.NewReader(r)
+	head, _ := buffered.Peek(FormatDetectionBytes)
+
+	var records []fxRateRecord
+	var err error
+	if strings.HasPrefix(string(trimLeadingSpace(head)), "[") {
+		err = json.NewDecoder(buffered).Decode(&records)
+	} else {
+		records, err = readFXRateCSV(buffered)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	rates := make([]model.FXRate, 0, len(records))
+	for i, record := range records {
+		rate, err := record.toFXRate()
+		if err != nil {
+			return nil, fmt.Errorf("rate %d: %w", i+1, err)
+		}
+
+		rates = append(rates, rate)
+	}
+
+	return rates, nil
+}
+
+func readFXRateCSV(r io.Reader) ([]fxRateRecord, error) {
+	reader := csv.NewReader(r)
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, err
+	}
+
+	indexes := map[string]int{}
+	for i, name := range header {
+		indexes[normalizeHeader(name)] = i
+	}
+	for _, column := range fxRateCSVHeader[:3] {
+		if _, ok := indexes[column]; !ok {
+			return nil, fmt.Errorf("%w: %s", ErrMissingColumns, column)
+		}
+	}
+
+	value := func(record []string, column string) string {
+		i, ok := indexes[column]
+		if !ok {
+			return ""
+		}
+
+		return strings.TrimSpace(record[i])
+	}
+
+	var records []fxRateRecord
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		records = append(records, fxRateRecord{
+			Pair:   value(record, "pair"),
+			Date:   value(record, "date"),
+			Rate:   json.Number(value(record, "rate")),
+			Source: value(record, "source"),
+		})
+	}
+
+	return records, nil
+}
+
+func (fr fxRateRecord) toFXRate() (model.FXRate, error) {
+	base, quote, ok := strings.Cut(fr.Pair, "/")
+	if !ok {
+		return model.FXRate{}, fmt.Errorf("invalid pair %s, expected a pair like EUR/USD", fr.Pair)
+	}
+
+	base, quote = NormalizeCurrency(base), NormalizeCurrency(quote)
+	for _, currency := range []string{base, quote} {
+		if _, err := CurrencyMinorUnits(currency); err != nil {
+			return model.FXRate{}, err
+		}
+	}
+	if base == quote {
+		return model.FXRate{}, fmt.Errorf("invalid pair %s, currencies must differ", fr.Pair)
+	}
+
+	date, err := stringToDateWithFormat(fr.Date, dateFormat)
+	if err != nil {
+		return model.FXRate{}, err
+	}
+
+	rate, err := stringToDecimal(fr.Rate.String())
+	if err != nil {
+		return model.FXRate{}, err
+	}
+	if !rate.IsPositive() {
+		return model.FXRate{}, fmt.Errorf("rate %s must be positive", fr.Rate)
+	}
+
+	return model.FXRate{
+		BaseCurrency:  base,
+		QuoteCurrency: quote,
+		Date:          date,
+		Rate:          rate,
+		Source:        fr.Source,
+	}, nil
+}
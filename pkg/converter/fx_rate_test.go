@@ -0,0 +1,53 @@
+package converter
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseFXRates_CSV(t *testing.T) {
+	content := "Pair,Date,Rate,Source\nEUR/USD,2023-12-15,1.0912,ECB\nusd/jpy,2023-12-15,142.5,\n"
+
+	rates, err := ParseFXRates(strings.NewReader(content))
+	require.NoError(t, err)
+	require.Len(t, rates, 2)
+
+	require.Equal(t, "EUR", rates[0].BaseCurrency)
+	require.Equal(t, "USD", rates[0].QuoteCurrency)
+	require.Equal(t, time.Date(2023, 12, 15, 0, 0, 0, 0, time.UTC), rates[0].Date)
+	require.Equal(t, decimal.RequireFromString("1.0912"), rates[0].Rate)
+	require.Equal(t, "ECB", rates[0].Source)
+
+	require.Equal(t, "USD/JPY", rates[1].Pair())
+	require.Empty(t, rates[1].Source)
+}
+
+func TestParseFXRates_JSON(t *testing.T) {
+	content := `[{"pair": "EUR/USD", "date": "2023-12-15", "rate": 1.0912, "source": "ECB"}, {"pair": "EUR/GBP", "date": "2023-12-15", "rate": "0.86"}]`
+
+	rates, err := ParseFXRates(strings.NewReader(content))
+	require.NoError(t, err)
+	require.Len(t, rates, 2)
+
+	require.Equal(t, decimal.RequireFromString("1.0912"), rates[0].Rate)
+	require.Equal(t, "EUR/GBP", rates[1].Pair())
+	require.Equal(t, decimal.RequireFromString("0.86"), rates[1].Rate)
+}
+
+func TestParseFXRates_InvalidRates(t *testing.T) {
+	for content, expected := range map[string]string{
+		"pair,date,rate\nEURUSD,2023-12-15,1.09\n":  "rate 1: invalid pair EURUSD",
+		"pair,date,rate\nEUR/EUR,2023-12-15,1.09\n": "rate 1: invalid pair EUR/EUR, currencies must differ",
+		"pair,date,rate\nEUR/ABC,2023-12-15,1.09\n": "rate 1: unknown currency ABC",
+		"pair,date,rate\nEUR/USD,15/12/2023,1.09\n": "rate 1: unable to convert 15/12/2023 into date",
+		"pair,date,rate\nEUR/USD,2023-12-15,0\n":    "rate 1: rate 0 must be positive",
+		"pair,date\nEUR/USD,2023-12-15\n":           "missing required columns: rate",
+	} {
+		_, err := ParseFXRates(strings.NewReader(content))
+		require.ErrorContains(t, err, expected)
+	}
+}
@@ -0,0 +1,221 @@
+package converter
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// transaction fields a CSV column can be mapped to
+const (
+	FieldTransactionID     = "transactionID"
+	FieldDate              = "date"
+	FieldTransactionAmount = "transactionAmount"
+	FieldAccountID         = "accountID"
+	FieldCurrency          = "currency"
+)
+
+var requiredFields = []string{FieldTransactionID, FieldDate, FieldTransactionAmount, FieldAccountID}
+
+// optionalFields may be missing from a file, transactions without a currency take the base currency of their account
+var optionalFields = []string{FieldCurrency}
+
+const invalidProfileError = `invalid mapping profile`
+
+// ErrMissingColumns is returned when the header of a file cannot be found
+var ErrMissingColumns = errors.New("missing required columns")
+
+// headerSearchRows is the number of leading rows inspected when looking for the header,
+// since some banks add a preamble before it
+const headerSearchRows = 10
+
+const DefaultMappingProfileName = "default"
+
+// MappingProfile describes how the columns of a CSV file are mapped into transaction fields
+type MappingProfile struct {
+	Name string `json:"name"`
+	// Columns maps a header name into a transaction field, header names are case-insensitive
+	Columns          map[string]string `json:"columns"`
+	DateFormat       string            `json:"date_format"`
+	DecimalSeparator string            `json:"decimal_separator"`
+	Delimiter        string            `json:"delimiter"`
+}
+
+// DefaultMappingProfile matches the transaction files used since the first version of the service
+var DefaultMappingProfile = MappingProfile{
+	Name: DefaultMappingProfileName,
+	Columns: map[string]string{
+		"id":                 FieldTransactionID,
+		"transaction_id":     FieldTransactionID,
+		"date":               FieldDate,
+		"transaction":        FieldTransactionAmount,
+		"amount":             FieldTransactionAmount,
+		"transaction_amount": FieldTransactionAmount,
+		"account":            FieldAccountID,
+		"account_id":         FieldAccountID,
+		"currency":           FieldCurrency,
+	},
+	DateFormat:       dateFormat,
+	DecimalSeparator: ".",
+	Delimiter:        ",",
+}
+
+// LoadMappingProfiles reads the mapping profiles defined as a JSON array in the given file.
+// The default profile is always available unless the file overrides it.
+func LoadMappingProfiles(filePath string) (map[string]MappingProfile, error) {
+	profiles := map[string]MappingProfile{DefaultMappingProfileName: DefaultMappingProfile}
+	if filePath == "" {
+		return profiles, nil
+	}
+
+	content, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, err
+	}
+
+	var definedProfiles []MappingProfile
+	err = json.Unmarshal(content, &definedProfiles)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, profile := range definedProfiles {
+		profile.setDefaults()
+		err = profile.Validate()
+		if err != nil {
+			return nil, err
+		}
+
+		profiles[profile.Name] = profile
+	}
+
+	return profiles, nil
+}
+
+func (mp *MappingProfile) setDefaults() {
+	if mp.DateFormat == "" {
+		mp.DateFormat = dateFormat
+	}
+	if mp.DecimalSeparator == "" {
+		mp.DecimalSeparator = "."
+	}
+	if mp.Delimiter == "" {
+		mp.Delimiter = ","
+	}
+}
+
+func (mp MappingProfile) Validate() error {
+	if mp.Name == "" {
+		return fmt.Errorf("%s: name is required", invalidProfileError)
+	}
+
+	mappedFields := map[string]bool{}
+	for header, field := range mp.Columns {
+		if !isKnownField(field) {
+			return fmt.Errorf("%s %s: unknown field %s for column %s", invalidProfileError, mp.Name, field, header)
+		}
+
+		mappedFields[field] = true
+	}
+
+	for _, field := range requiredFields {
+		if !mappedFields[field] {
+			return fmt.Errorf("%s %s: no column mapped to %s", invalidProfileError, mp.Name, field)
+		}
+	}
+
+	if utf8.RuneCountInString(mp.DecimalSeparator) != 1 {
+		return fmt.Errorf("%s %s: decimal separator must be a single character", invalidProfileError, mp.Name)
+	}
+
+	if utf8.RuneCountInString(mp.Delimiter) != 1 {
+		return fmt.Errorf("%s %s: delimiter must be a single character", invalidProfileError, mp.Name)
+	}
+
+	return nil
+}
+
+// DelimiterRune returns the field delimiter of the CSV files using this profile
+func (mp MappingProfile) DelimiterRune() rune {
+	if mp.Delimiter == "" {
+		return ','
+	}
+
+	r, _ := utf8.DecodeRuneInString(mp.Delimiter)
+	return r
+}
+
+// ColumnMapping is the result of resolving a mapping profile against the header of a file
+type ColumnMapping struct {
+	profile MappingProfile
+	// indexes holds the record position of every transaction field
+	indexes map[string]int
+}
+
+// ResolveHeader maps every required transaction field into a position of the given header record
+func (mp MappingProfile) ResolveHeader(header []string) (*ColumnMapping, error) {
+	columns := map[string]string{}
+	for name, field := range mp.Columns {
+		columns[normalizeHeader(name)] = field
+	}
+
+	indexes := map[string]int{}
+	for i, name := range header {
+		field, ok := columns[normalizeHeader(name)]
+		if !ok {
+			continue
+		}
+
+		if _, ok := indexes[field]; ok {
+			return nil, fmt.Errorf("more than one column mapped to %s", field)
+		}
+
+		indexes[field] = i
+	}
+
+	var missing []string
+	for _, field := range requiredFields {
+		if _, ok := indexes[field]; !ok {
+			missing = append(missing, fmt.Sprintf("%s (expected one of: %s)", field, strings.Join(mp.headersFor(field), ", ")))
+		}
+	}
+
+	if len(missing) > 0 {
+		return nil, fmt.Errorf("%w: %s", ErrMissingColumns, strings.Join(missing, "; "))
+	}
+
+	return &ColumnMapping{profile: mp, indexes: indexes}, nil
+}
+
+func (mp MappingProfile) headersFor(field string) []string {
+	var headers []string
+	for name, f := range mp.Columns {
+		if f == field {
+			headers = append(headers, name)
+		}
+	}
+	sort.Strings(headers)
+
+	return headers
+}
+
+func isKnownField(field string) bool {
+	for _, f := range append(requiredFields, optionalFields...) {
+		if f == field {
+			return true
+		}
+	}
+
+	return false
+}
+
+func normalizeHeader(name string) string {
+	// files exported by spreadsheets usually start with a byte order mark
+	name = strings.TrimPrefix(name, "\ufeff")
+
+	return strings.ToLower(strings.TrimSpace(name))
+}
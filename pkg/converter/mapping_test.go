@@ -0,0 +1,84 @@
+package converter
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/require"
+)
+
+var bankProfile = MappingProfile{
+	Name: "bank",
+	Columns: map[string]string{
+		"Booking Date": FieldDate,
+		"Amount":       FieldTransactionAmount,
+		"Reference":    FieldTransactionID,
+		"Account No":   FieldAccountID,
+	},
+	DateFormat:       "02/01/2006",
+	DecimalSeparator: ",",
+	Delimiter:        ";",
+}
+
+func TestCSVTransactionReader_CustomProfile(t *testing.T) {
+	content := "Statement generated by the bank\n" +
+		"ACCOUNT NO; booking date ;Reference;Amount;Description\n" +
+		"1;15/12/2023;10;-60,5;groceries\n"
+
+	transactions, rowErrors, err := readAllTransactions(content, bankProfile)
+	require.NoError(t, err)
+	require.Empty(t, rowErrors)
+	require.Len(t, transactions, 1)
+
+	require.Equal(t, 10, transactions[0].TransactionID)
+	require.Equal(t, time.Date(2023, 12, 15, 0, 0, 0, 0, time.UTC), transactions[0].Date)
+	require.Equal(t, decimal.RequireFromString("-60.5"), transactions[0].TransactionAmount)
+	require.Equal(t, 1, transactions[0].AccountID)
+}
+
+func TestCSVTransactionReader_RejectsDotWithCommaSeparator(t *testing.T) {
+	content := "Account No;Booking Date;Reference;Amount\n1;15/12/2023;10;1.060,5\n"
+
+	_, rowErrors, err := readAllTransactions(content, bankProfile)
+	require.NoError(t, err)
+	require.Equal(t, []RowError{{Line: 2, Column: FieldTransactionAmount, Value: "1.060,5", Reason: "unable to convert 1.060,5 into decimal"}}, rowErrors)
+}
+
+func TestCSVTransactionReader_MissingColumns(t *testing.T) {
+	content := "Id,Date,Transaction\n1,2023-12-15,60.5\n"
+
+	_, _, err := readAllTransactions(content, DefaultMappingProfile)
+	require.ErrorIs(t, err, ErrMissingColumns)
+	require.ErrorContains(t, err, "accountID (expected one of: account, account_id)")
+}
+
+func TestResolveHeader_DuplicatedField(t *testing.T) {
+	_, err := DefaultMappingProfile.ResolveHeader([]string{"Id", "Transaction_ID", "Date", "Amount", "Account"})
+	require.ErrorContains(t, err, "more than one column mapped to transactionID")
+}
+
+func TestLoadMappingProfiles_Success(t *testing.T) {
+	filePath := filepath.Join(t.TempDir(), "profiles.json")
+	content := `[{"name": "bank", "columns": {"Reference": "transactionID", "Booking Date": "date", "Amount": "transactionAmount", "Account No": "accountID"}, "decimal_separator": ","}]`
+	require.NoError(t, os.WriteFile(filePath, []byte(content), 0600))
+
+	profiles, err := LoadMappingProfiles(filePath)
+	require.NoError(t, err)
+	require.Contains(t, profiles, DefaultMappingProfileName)
+	require.Equal(t, ",", profiles["bank"].DecimalSeparator)
+	require.Equal(t, dateFormat, profiles["bank"].DateFormat)
+	require.Equal(t, ',', profiles["bank"].DelimiterRune())
+}
+
+func TestLoadMappingProfiles_InvalidProfile(t *testing.T) {
+	filePath := filepath.Join(t.TempDir(), "profiles.json")
+	content := `[{"name": "bank", "columns": {"Reference": "transactionID", "Booking Date": "date", "Amount": "amount"}}]`
+	require.NoError(t, os.WriteFile(filePath, []byte(content), 0600))
+
+	_, err := LoadMappingProfiles(filePath)
+	require.ErrorContains(t, err, invalidProfileError)
+	require.ErrorContains(t, err, "unknown field amount")
+}
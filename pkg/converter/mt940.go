@@ -0,0 +1,292 @@
+package converter
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/shopspring/decimal"
+
+	"github.com/mdcantarini/transaction-processor-api/pkg/model"
+)
+
+const (
+	mt940ParsingError = `unable to parse mt940 file`
+	balanceError      = `closing balance does not match`
+)
+
+// mt940Field is a tag of an MT940 statement along with its value, which may span several lines
+type mt940Field struct {
+	tag   string
+	value string
+	line  int
+}
+
+var (
+	mt940TagRegexp     = regexp.MustCompile(`^:(\d{2}[A-Z]?):(.*)$`)
+	mt940BalanceRegexp = regexp.MustCompile(`^([CD])(\d{6})([A-Z]{3})(\d+,\d*)$`)
+	// value date, optional entry date, mark, optional funds code, amount, transaction type,
+	// reference for the account owner and optional reference of the bank
+	mt940LineRegexp = regexp.MustCompile(`^(\d{6})(\d{4})?(RC|RD|C|D)([A-Z])?(\d+,\d*)([A-Z][A-Z0-9]{3})([^/\n]*)(?://([^\n]*))?`)
+)
+
+// ParseMT940 reads the statement lines of a SWIFT MT940 file along with the balances of every statement.
+// Statements whose closing balance differs from their opening balance plus their movements are rejected.
+func ParseMT940(r io.Reader) ([]StatementEntry, []model.StatementBalance, error) {
+	statements, err := splitMT940Statements(r)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%s: %w", mt940ParsingError, err)
+	}
+
+	var entries []StatementEntry
+	var balances []model.StatementBalance
+	for _, fields := range statements {
+		statementEntries, balance, err := parseMT940Statement(fields)
+		if err != nil {
+			return nil, nil, fmt.Errorf("%s: %w", mt940ParsingError, err)
+		}
+
+		entries = append(entries, statementEntries...)
+		balances = append(balances, balance)
+	}
+
+	return entries, balances, nil
+}
+
+// splitMT940Statements groups the fields of every statement in the file, skipping the SWIFT blocks wrapping them
+func splitMT940Statements(r io.Reader) ([][]mt940Field, error) {
+	var statements [][]mt940Field
+	var fields []mt940Field
+
+	scanner := bufio.NewScanner(r)
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := strings.TrimRight(scanner.Text(), " \r")
+		if line == 1 {
+			text = strings.TrimPrefix(text, "\ufeff")
+		}
+
+		// the text block of a SWIFT message ends with "-}", some files only use "-" between statements
+		if text == "-}" || text == "-" {
+			continue
+		}
+
+		if match := mt940TagRegexp.FindStringSubmatch(text); match != nil {
+			// every statement starts with its transaction reference
+			if match[1] == "20" && len(fields) > 0 {
+				statements = append(statements, fields)
+				fields = nil
+			}
+
+			fields = append(fields, mt940Field{tag: match[1], value: match[2], line: line})
+			continue
+		}
+
+		// lines starting with a block like {1:F01...}{4: precede the first tag of the message
+		if strings.HasPrefix(text, "{") || len(fields) == 0 {
+			continue
+		}
+
+		fields[len(fields)-1].value += "\n" + text
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(fields) > 0 {
+		statements = append(statements, fields)
+	}
+
+	if len(statements) == 0 {
+		return nil, fmt.Errorf("no statements found")
+	}
+
+	return statements, nil
+}
+
+func parseMT940Statement(fields []mt940Field) ([]StatementEntry, model.StatementBalance, error) {
+	balance := model.StatementBalance{}
+	var entries []StatementEntry
+	var hasOpening, hasClosing bool
+	// statementNumber is the statement and sequence number of :28C:, unlike the reference of :20: which banks
+	// reuse across days
+	var statementNumber string
+
+	for i, field := range fields {
+		switch field.tag {
+		case "20":
+			balance.Reference = strings.TrimSpace(field.value)
+		case "25":
+			balance.BankAccount = strings.TrimSpace(field.value)
+		case "28C":
+			statementNumber = strings.TrimSpace(field.value)
+		case "60F", "60M":
+			currency, date, amount, err := parseMT940Balance(field.value)
+			if err != nil {
+				return nil, balance, fmt.Errorf("line %d: %s %s: %w", field.line, convertingError, field.tag, err)
+			}
+
+			balance.Currency, balance.OpeningDate, balance.OpeningBalance = currency, date, amount
+			hasOpening = true
+		case "62F", "62M":
+			currency, date, amount, err := parseMT940Balance(field.value)
+			if err != nil {
+				return nil, balance, fmt.Errorf("line %d: %s %s: %w", field.line, convertingError, field.tag, err)
+			}
+
+			if balance.Currency != "" && currency != balance.Currency {
+				return nil, balance, fmt.Errorf("line %d: closing balance currency %s differs from opening balance currency %s", field.line, currency, balance.Currency)
+			}
+
+			balance.ClosingDate, balance.ClosingBalance = date, amount
+			hasClosing = true
+		case "61":
+			entries = append(entries, mt940LineToEntry(field, balance, statementNumber, len(entries)+1))
+		case "86":
+			// the information to account owner describes the preceding statement line
+			if i > 0 && fields[i-1].tag == "61" {
+				entries[len(entries)-1].Transaction.Description = strings.ReplaceAll(strings.TrimSpace(field.value), "\n", " ")
+			}
+		}
+	}
+
+	if balance.BankAccount == "" {
+		return nil, balance, fmt.Errorf("statement %s has no account", balance.Reference)
+	}
+	if !hasOpening || !hasClosing {
+		return nil, balance, fmt.Errorf("statement %s lacks its opening or closing balance", balance.Reference)
+	}
+
+	movements := decimal.Zero
+	for _, entry := range entries {
+		movements = movements.Add(entry.Transaction.TransactionAmount)
+	}
+
+	expected := balance.OpeningBalance.Add(movements)
+	if !expected.Equal(balance.ClosingBalance) {
+		return nil, balance, fmt.Errorf(
+			"statement %s: %s opening balance %s plus movements %s, expected %s but got %s",
+			balance.Reference, balanceError, balance.OpeningBalance, movements, expected, balance.ClosingBalance,
+		)
+	}
+
+	return entries, balance, nil
+}
+
+// parseMT940Balance converts balances like C231215EUR1000,00
+func parseMT940Balance(s string) (string, time.Time, decimal.Decimal, error) {
+	match := mt940BalanceRegexp.FindStringSubmatch(strings.TrimSpace(s))
+	if match == nil {
+		return "", time.Time{}, decimal.Zero, fmt.Errorf("invalid balance %s", s)
+	}
+
+	date, err := mt940StringToDate(match[2])
+	if err != nil {
+		return "", time.Time{}, decimal.Zero, err
+	}
+
+	amount, err := stringToDecimalWithSeparator(match[4], ",")
+	if err != nil {
+		return "", time.Time{}, decimal.Zero, err
+	}
+
+	if match[1] == "D" {
+		amount = amount.Neg()
+	}
+
+	return match[3], date, amount, nil
+}
+
+// mt940LineToEntry converts statement lines like 2312151215C60,50NTRFREF001//BANKREF1
+func mt940LineToEntry(field mt940Field, balance model.StatementBalance, statementNumber string, position int) StatementEntry {
+	entry := StatementEntry{Line: field.line, BankAccount: balance.BankAccount}
+
+	match := mt940LineRegexp.FindStringSubmatch(field.value)
+	if match == nil {
+		entry.Errors = []RowError{{Line: field.line, Column: field.tag, Value: field.value, Reason: "invalid statement line"}}
+		return entry
+	}
+
+	valueDate, err := mt940StringToDate(match[1])
+	if err != nil {
+		entry.Errors = append(entry.Errors, RowError{Line: field.line, Column: "valueDate", Value: match[1], Reason: err.Error()})
+	}
+
+	// the booking date only has month and day, its year is the one closest to the value date
+	date := valueDate
+	if match[2] != "" && err == nil {
+		bookingDate, err := time.Parse("0102", match[2])
+		if err != nil {
+			entry.Errors = append(entry.Errors, RowError{Line: field.line, Column: "entryDate", Value: match[2], Reason: err.Error()})
+		} else {
+			date = closestDate(valueDate, bookingDate.Month(), bookingDate.Day())
+		}
+	}
+
+	amount, err := stringToDecimalWithSeparator(match[5], ",")
+	if err != nil {
+		entry.Errors = append(entry.Errors, RowError{Line: field.line, Column: "amount", Value: match[5], Reason: err.Error()})
+	}
+
+	// reversals have the opposite effect of the mark they reverse
+	if match[3] == "D" || match[3] == "RC" {
+		amount = amount.Neg()
+	}
+
+	reference := strings.TrimSpace(match[7])
+	if reference == "" || reference == "NONREF" {
+		reference = strings.TrimSpace(match[8])
+	}
+	if reference == "" {
+		// lines without references are identified by their position in the statement
+		reference = fmt.Sprintf("%s/%d", balance.Reference, position)
+	}
+
+	// customer references are neither unique nor always given, so lines are identified by their statement, their
+	// position within it, their value date, mark, amount and bank reference
+	key := fmt.Sprintf("%s|%s|%d|%s|%s%s|%s", statementNumber, balance.OpeningDate.Format(time.DateOnly), position, match[1], match[3], match[5], strings.TrimSpace(match[8]))
+
+	entry.Transaction = model.Transaction{
+		TransactionID:     StatementTransactionID(FormatMT940, balance.BankAccount, key),
+		ExternalID:        reference,
+		Date:              date,
+		TransactionAmount: amount,
+		Currency:          balance.Currency,
+	}
+
+	return entry
+}
+
+func mt940StringToDate(s string) (time.Time, error) {
+	d, err := time.Parse("060102", s)
+	if err != nil {
+		return time.Now(), fmt.Errorf("unable to convert %s into date", s)
+	}
+
+	return d, nil
+}
+
+// closestDate returns the date with the given month and day which is closest to the reference date
+func closestDate(reference time.Time, month time.Month, day int) time.Time {
+	closest := time.Date(reference.Year(), month, day, 0, 0, 0, 0, time.UTC)
+	for _, years := range []int{-1, 1} {
+		candidate := time.Date(reference.Year()+years, month, day, 0, 0, 0, 0, time.UTC)
+		if absDuration(candidate.Sub(reference)) < absDuration(closest.Sub(reference)) {
+			closest = candidate
+		}
+	}
+
+	return closest
+}
+
+func absDuration(d time.Duration) time.Duration {
+	if d < 0 {
+		return -d
+	}
+
+	return d
+}
@@ -0,0 +1,111 @@
+package converter
+
+import (
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseMT940_Success(t *testing.T) {
+	file, err := os.Open("testdata/statement.mt940")
+	require.NoError(t, err)
+	defer file.Close()
+
+	entries, balances, err := ParseMT940(file)
+	require.NoError(t, err)
+	require.Len(t, entries, 4)
+	require.Len(t, balances, 2)
+
+	require.Equal(t, "DE89370400440532013000", entries[0].BankAccount)
+	require.Empty(t, entries[0].Errors)
+	require.Equal(t, 6, entries[0].Line)
+	require.Equal(t, "REF001", entries[0].Transaction.ExternalID)
+	require.Equal(t, StatementTransactionID(FormatMT940, "DE89370400440532013000", "00001/001|2023-12-14|1|231215|C60,50|BANKREF1"), entries[0].Transaction.TransactionID)
+	require.Equal(t, time.Date(2023, 12, 15, 0, 0, 0, 0, time.UTC), entries[0].Transaction.Date)
+	require.Equal(t, decimal.RequireFromString("60.50"), entries[0].Transaction.TransactionAmount)
+	require.Equal(t, "EUR", entries[0].Transaction.Currency)
+	// the information to account owner may span several lines
+	require.Equal(t, "Invoice 42 payment Customer ACME Corp", entries[0].Transaction.Description)
+
+	// the bank reference is used when the customer reference is missing
+	require.Equal(t, "BANKREF2", entries[1].Transaction.ExternalID)
+	require.Equal(t, decimal.RequireFromString("-10.30"), entries[1].Transaction.TransactionAmount)
+	require.Equal(t, "Card fee", entries[1].Transaction.Description)
+
+	// reversed debits are positive and lines without references are identified by their position
+	require.Equal(t, "STMT231215/3", entries[2].Transaction.ExternalID)
+	require.Equal(t, decimal.RequireFromString("5.00"), entries[2].Transaction.TransactionAmount)
+	require.Empty(t, entries[2].Transaction.Description)
+
+	require.Equal(t, "STMT231215", balances[0].Reference)
+	require.Equal(t, "DE89370400440532013000", balances[0].BankAccount)
+	require.Equal(t, "EUR", balances[0].Currency)
+	require.Equal(t, time.Date(2023, 12, 14, 0, 0, 0, 0, time.UTC), balances[0].OpeningDate)
+	require.Equal(t, decimal.RequireFromString("1000.00"), balances[0].OpeningBalance)
+	require.Equal(t, time.Date(2023, 12, 15, 0, 0, 0, 0, time.UTC), balances[0].ClosingDate)
+	require.Equal(t, decimal.RequireFromString("1055.20"), balances[0].ClosingBalance)
+
+	require.Equal(t, "STMT231216", balances[1].Reference)
+	require.Equal(t, decimal.RequireFromString("-55.20"), entries[3].Transaction.TransactionAmount)
+}
+
+func TestParseMT940_SharedCustomerReference(t *testing.T) {
+	// both statements reuse their :20: reference and their lines share the customer reference
+	content := ":20:STMT\n:25:123\n:28C:1/1\n:60F:C231214EUR0,\n:61:2312151215C1,00NTRFINVOICE\n:62F:C231215EUR1,\n" +
+		":20:STMT\n:25:123\n:28C:2/1\n:60F:C231215EUR1,\n:61:2312161216C1,00NTRFINVOICE\n:62F:C231216EUR2,\n"
+
+	entries, _, err := ParseMT940(strings.NewReader(content))
+	require.NoError(t, err)
+	require.Len(t, entries, 2)
+	require.Equal(t, "INVOICE", entries[0].Transaction.ExternalID)
+	require.Equal(t, "INVOICE", entries[1].Transaction.ExternalID)
+	require.NotEqual(t, entries[0].Transaction.TransactionID, entries[1].Transaction.TransactionID)
+
+	// importing the same statements again gives the same IDs
+	again, _, err := ParseMT940(strings.NewReader(content))
+	require.NoError(t, err)
+	require.Equal(t, entries[0].Transaction.TransactionID, again[0].Transaction.TransactionID)
+	require.Equal(t, entries[1].Transaction.TransactionID, again[1].Transaction.TransactionID)
+}
+
+func TestParseMT940_BookingDateInNextYear(t *testing.T) {
+	content := ":20:STMT\n:25:123\n:60F:C231231EUR0,\n:61:2312310101C1,00NTRFREF\n:62F:C240101EUR1,\n"
+
+	entries, _, err := ParseMT940(strings.NewReader(content))
+	require.NoError(t, err)
+	require.Equal(t, time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC), entries[0].Transaction.Date)
+}
+
+func TestParseMT940_UnbalancedStatement(t *testing.T) {
+	content := ":20:STMT\n:25:123\n:60F:C231214EUR100,00\n:61:2312151215C60,50NTRFREF\n:62F:C231215EUR150,00\n"
+
+	_, _, err := ParseMT940(strings.NewReader(content))
+	require.ErrorContains(t, err, "closing balance does not match opening balance 100 plus movements 60.5, expected 160.5 but got 150")
+}
+
+func TestParseMT940_MissingClosingBalance(t *testing.T) {
+	content := ":20:STMT\n:25:123\n:60F:C231214EUR100,00\n:61:2312151215C60,50NTRFREF\n"
+
+	_, _, err := ParseMT940(strings.NewReader(content))
+	require.ErrorContains(t, err, "lacks its opening or closing balance")
+}
+
+func TestParseMT940_InvalidStatementLine(t *testing.T) {
+	content := ":20:STMT\n:25:123\n:60F:C231214EUR100,00\n:61:invalid\n:62F:C231215EUR100,00\n"
+
+	entries, _, err := ParseMT940(strings.NewReader(content))
+	require.NoError(t, err)
+	require.Equal(t, []RowError{{Line: 4, Column: "61", Value: "invalid", Reason: "invalid statement line"}}, entries[0].Errors)
+}
+
+func TestDetectFormat_MT940(t *testing.T) {
+	content, err := os.ReadFile("testdata/statement.mt940")
+	require.NoError(t, err)
+
+	require.Equal(t, FormatMT940, DetectFormat(content))
+	require.Equal(t, FormatMT940, DetectFormat([]byte(":20:STMT\r\n:25:123\r\n")))
+}
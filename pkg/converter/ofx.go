@@ -0,0 +1,270 @@
+package converter
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/shopspring/decimal"
+
+	"github.com/mdcantarini/transaction-processor-api/pkg/model"
+)
+
+const ofxParsingError = `unable to parse ofx file`
+
+// ofxNode is an OFX element, leaf elements hold a value while aggregates hold children
+type ofxNode struct {
+	tag      string
+	text     string
+	line     int
+	children []*ofxNode
+}
+
+// first returns the first descendant with the given tag. Descendants are searched rather than children,
+// since an empty SGML leaf element is taken for an aggregate holding the elements following it.
+func (n *ofxNode) first(tag string) *ofxNode {
+	for _, c := range n.children {
+		if c.tag == tag {
+			return c
+		}
+
+		if found := c.first(tag); found != nil {
+			return found
+		}
+	}
+
+	return nil
+}
+
+func (n *ofxNode) value(tag string) string {
+	found := n.first(tag)
+	if found == nil {
+		return ""
+	}
+
+	return found.text
+}
+
+// find returns every descendant with the given tag
+func (n *ofxNode) find(tag string) []*ofxNode {
+	var nodes []*ofxNode
+	for _, c := range n.children {
+		if c.tag == tag {
+			nodes = append(nodes, c)
+			continue
+		}
+
+		nodes = append(nodes, c.find(tag)...)
+	}
+
+	return nodes
+}
+
+// ParseOFX reads the transactions of an OFX 1.x (SGML) or 2.x (XML) statement file
+func ParseOFX(r io.Reader) ([]StatementEntry, error) {
+	content, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var root *ofxNode
+	if bytes.HasPrefix(trimLeadingSpace(content), []byte("<?xml")) {
+		root, err = parseOFXXML(content)
+	} else {
+		root, err = parseOFXSGML(content)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", ofxParsingError, err)
+	}
+
+	var entries []StatementEntry
+	// bank statements use BANKACCTFROM while credit card statements use CCACCTFROM
+	statements := append(root.find("STMTRS"), root.find("CCSTMTRS")...)
+	for _, statement := range statements {
+		accountFrom := statement.first("BANKACCTFROM")
+		if accountFrom == nil {
+			accountFrom = statement.first("CCACCTFROM")
+		}
+		if accountFrom == nil || accountFrom.value("ACCTID") == "" {
+			return nil, fmt.Errorf("%s: statement in line %d has no account", ofxParsingError, statement.line)
+		}
+
+		bankAccount := accountFrom.value("ACCTID")
+		currency := statement.value("CURDEF")
+		for _, trn := range statement.find("STMTTRN") {
+			entries = append(entries, ofxTransactionToEntry(trn, bankAccount, currency))
+		}
+	}
+
+	return entries, nil
+}
+
+func ofxTransactionToEntry(trn *ofxNode, bankAccount, currency string) StatementEntry {
+	entry := StatementEntry{Line: trn.line, BankAccount: bankAccount}
+	addError := func(tag string, err error) {
+		entry.Errors = append(entry.Errors, RowError{Line: trn.line, Column: tag, Value: trn.value(tag), Reason: err.Error()})
+	}
+
+	fitID := trn.value("FITID")
+	if fitID == "" {
+		addError("FITID", fmt.Errorf("missing transaction id"))
+	}
+
+	date, err := ofxStringToDate(trn.value("DTPOSTED"))
+	if err != nil {
+		addError("DTPOSTED", err)
+	}
+
+	amount, err := ofxStringToDecimal(trn.value("TRNAMT"))
+	if err != nil {
+		addError("TRNAMT", err)
+	}
+
+	entry.Transaction = model.Transaction{
+		TransactionID:     StatementTransactionID(FormatOFX, bankAccount, fitID),
+		ExternalID:        fitID,
+		Date:              date,
+		TransactionAmount: amount,
+		Currency:          currency,
+	}
+
+	return entry
+}
+
+// ofxStringToDate converts OFX datetimes like 20231215120000.000[-5:EST] keeping the date only,
+// as every other transaction source does
+func ofxStringToDate(s string) (time.Time, error) {
+	if len(s) < 8 {
+		return time.Now(), fmt.Errorf("unable to convert %s into date", s)
+	}
+
+	d, err := time.Parse("20060102", s[:8])
+	if err != nil {
+		return time.Now(), fmt.Errorf("unable to convert %s into date", s)
+	}
+
+	return d, nil
+}
+
+// ofxStringToDecimal converts OFX amounts, which some banks send using a comma as decimal separator. Grouping
+// separators are not supported, so amounts like 1.234,56 or 1,234, whose separators are ambiguous, are rejected
+// rather than guessed.
+func ofxStringToDecimal(s string) (decimal.Decimal, error) {
+	comma := strings.Index(s, ",")
+	if comma < 0 {
+		return stringToDecimal(s)
+	}
+
+	// a comma followed by three digits might as well be a thousands separator
+	if strings.Contains(s, ".") || strings.Count(s, ",") > 1 || len(s)-comma-1 == 3 {
+		return decimal.Zero, fmt.Errorf("ambiguous separators in amount %s", s)
+	}
+
+	return stringToDecimalWithSeparator(s, ",")
+}
+
+// parseOFXSGML builds the element tree of an OFX 1.x file, whose leaf elements usually lack their closing tag
+func parseOFXSGML(content []byte) (*ofxNode, error) {
+	root := &ofxNode{}
+	stack := []*ofxNode{root}
+	inBody := false
+
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	line := 0
+	for scanner.Scan() {
+		line++
+		rest := strings.TrimSpace(scanner.Text())
+
+		// the header is made of KEY:VALUE lines preceding the first element
+		if !inBody {
+			if !strings.HasPrefix(rest, "<") {
+				continue
+			}
+			inBody = true
+		}
+
+		for rest != "" {
+			start := strings.Index(rest, "<")
+			end := strings.Index(rest, ">")
+			if start != 0 || end < 0 {
+				return nil, fmt.Errorf("unexpected content in line %d: %s", line, rest)
+			}
+
+			tag := strings.ToUpper(strings.TrimSpace(rest[1:end]))
+			rest = strings.TrimSpace(rest[end+1:])
+
+			value := rest
+			if next := strings.Index(rest, "<"); next >= 0 {
+				value = strings.TrimSpace(rest[:next])
+				rest = rest[next:]
+			} else {
+				rest = ""
+			}
+
+			if strings.HasPrefix(tag, "/") {
+				tag = tag[1:]
+				// pop up to the matching element, closing the leaf elements left open on the way
+				for i := len(stack) - 1; i > 0; i-- {
+					if stack[i].tag == tag {
+						stack = stack[:i]
+						break
+					}
+				}
+
+				continue
+			}
+
+			node := &ofxNode{tag: tag, line: line}
+			parent := stack[len(stack)-1]
+			parent.children = append(parent.children, node)
+			if value != "" {
+				node.text = value
+				continue
+			}
+
+			stack = append(stack, node)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return root, nil
+}
+
+// parseOFXXML builds the element tree of an OFX 2.x file
+func parseOFXXML(content []byte) (*ofxNode, error) {
+	root := &ofxNode{}
+	stack := []*ofxNode{root}
+
+	decoder := xml.NewDecoder(bytes.NewReader(content))
+	for {
+		line, _ := decoder.InputPos()
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		switch t := token.(type) {
+		case xml.StartElement:
+			node := &ofxNode{tag: strings.ToUpper(t.Name.Local), line: line}
+			parent := stack[len(stack)-1]
+			parent.children = append(parent.children, node)
+			stack = append(stack, node)
+		case xml.EndElement:
+			stack = stack[:len(stack)-1]
+		case xml.CharData:
+			stack[len(stack)-1].text += strings.TrimSpace(string(t))
+		}
+	}
+
+	return root, nil
+}
@@ -0,0 +1,132 @@
+package converter
+
+import (
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseOFX_SGML(t *testing.T) {
+	file, err := os.Open("testdata/statement_v1.ofx")
+	require.NoError(t, err)
+	defer file.Close()
+
+	entries, err := ParseOFX(file)
+	require.NoError(t, err)
+	require.Len(t, entries, 3)
+
+	require.Equal(t, "000123456789", entries[0].BankAccount)
+	require.Empty(t, entries[0].Errors)
+	require.Equal(t, "202312150001", entries[0].Transaction.ExternalID)
+	require.Equal(t, StatementTransactionID(FormatOFX, "000123456789", "202312150001"), entries[0].Transaction.TransactionID)
+	require.Equal(t, time.Date(2023, 12, 15, 0, 0, 0, 0, time.UTC), entries[0].Transaction.Date)
+	require.Equal(t, decimal.RequireFromString("60.50"), entries[0].Transaction.TransactionAmount)
+	require.Equal(t, "USD", entries[0].Transaction.Currency)
+
+	// the empty MEMO element must not hide the rest of the transaction
+	require.Empty(t, entries[1].Errors)
+	require.Equal(t, "202312160001", entries[1].Transaction.ExternalID)
+	require.Equal(t, decimal.RequireFromString("-10.30"), entries[1].Transaction.TransactionAmount)
+
+	require.Equal(t, []RowError{{Line: 54, Column: "DTPOSTED", Value: "2023121a", Reason: "unable to convert 2023121a into date"}}, entries[2].Errors)
+}
+
+func TestParseOFX_XML(t *testing.T) {
+	file, err := os.Open("testdata/statement_v2.ofx")
+	require.NoError(t, err)
+	defer file.Close()
+
+	entries, err := ParseOFX(file)
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+
+	require.Equal(t, "4111111111111111", entries[0].BankAccount)
+	require.Empty(t, entries[0].Errors)
+	require.Equal(t, 29, entries[0].Line)
+	require.Equal(t, "CC-0001", entries[0].Transaction.ExternalID)
+	require.Equal(t, time.Date(2023, 12, 14, 0, 0, 0, 0, time.UTC), entries[0].Transaction.Date)
+	require.Equal(t, decimal.RequireFromString("-25.99"), entries[0].Transaction.TransactionAmount)
+}
+
+func TestParseOFX_MissingAccount(t *testing.T) {
+	content := "OFXHEADER:100\n\n<OFX><BANKMSGSRSV1><STMTTRNRS><STMTRS><CURDEF>USD</STMTRS></STMTTRNRS></BANKMSGSRSV1></OFX>"
+
+	_, err := ParseOFX(strings.NewReader(content))
+	require.ErrorContains(t, err, "statement in line 3 has no account")
+}
+
+func TestOFXStringToDecimal(t *testing.T) {
+	tests := []struct {
+		value  string
+		amount string
+		err    string
+	}{
+		{"60.50", "60.50", ""},
+		{"-1234.5", "-1234.5", ""},
+		{"1.234", "1.234", ""},
+		{"60,50", "60.50", ""},
+		{"-10,3", "-10.3", ""},
+		{"1.234,56", "", "ambiguous separators in amount 1.234,56"},
+		{"1,234.56", "", "ambiguous separators in amount 1,234.56"},
+		{"1,234", "", "ambiguous separators in amount 1,234"},
+		{"1,234,567", "", "ambiguous separators in amount 1,234,567"},
+		{"12a", "", "unable to convert 12a into decimal"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			amount, err := ofxStringToDecimal(tt.value)
+			if tt.err != "" {
+				require.EqualError(t, err, tt.err)
+				return
+			}
+
+			require.NoError(t, err)
+			require.True(t, decimal.RequireFromString(tt.amount).Equal(amount))
+		})
+	}
+}
+
+func TestStatementTransactionReader_ResolvesAccounts(t *testing.T) {
+	entries := []StatementEntry{
+		{Line: 1, BankAccount: "001"},
+		{Line: 2, BankAccount: "001"},
+		{Line: 3, BankAccount: "002"},
+	}
+
+	resolved := 0
+	reader := NewStatementTransactionReader(entries, func(bankAccount string) (int, error) {
+		resolved++
+		if bankAccount == "001" {
+			return 7, nil
+		}
+
+		return 0, ErrUnknownBankAccount
+	})
+
+	transaction, rowErrors, err := reader.Read()
+	require.NoError(t, err)
+	require.Empty(t, rowErrors)
+	require.Equal(t, 7, transaction.AccountID)
+
+	transaction, _, err = reader.Read()
+	require.NoError(t, err)
+	require.Equal(t, 7, transaction.AccountID)
+
+	_, rowErrors, err = reader.Read()
+	require.NoError(t, err)
+	require.Equal(t, []RowError{{Line: 3, Column: FieldAccountID, Value: "002", Reason: ErrUnknownBankAccount.Error()}}, rowErrors)
+
+	// bank accounts are resolved once
+	require.Equal(t, 2, resolved)
+}
+
+func TestDetectFormat(t *testing.T) {
+	require.Equal(t, FormatOFX, DetectFormat([]byte("\ufeff\r\nOFXHEADER:100\nDATA:OFXSGML")))
+	require.Equal(t, FormatOFX, DetectFormat([]byte(`<?xml version="1.0"?><?OFX OFXHEADER="200"?><OFX>`)))
+	require.Equal(t, FormatCSV, DetectFormat([]byte("Id,Date,Transaction,Account\n")))
+}
@@ -0,0 +1,124 @@
+package converter
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/shopspring/decimal"
+
+	"github.com/mdcantarini/transaction-processor-api/pkg/model"
+)
+
+// ReportPeriodRange returns the first date included and the first date excluded of the latest complete period of
+// the report definition before the given date, so a monthly report run on January 1st covers December. Custom
+// reports always cover the dates of their definition.
+func ReportPeriodRange(definition model.ReportDefinition, date time.Time) (time.Time, time.Time, error) {
+	day := time.Date(date.Year(), date.Month(), date.Day(), 0, 0, 0, 0, time.UTC)
+
+	switch definition.Period {
+	case model.ReportPeriodDaily:
+		return day.AddDate(0, 0, -1), day, nil
+	case model.ReportPeriodWeekly:
+		// weeks start on Monday
+		monday := day.AddDate(0, 0, -(int(day.Weekday())+6)%7)
+		return monday.AddDate(0, 0, -7), monday, nil
+	case model.ReportPeriodMonthly:
+		first := time.Date(day.Year(), day.Month(), 1, 0, 0, 0, 0, time.UTC)
+		return first.AddDate(0, -1, 0), first, nil
+	case model.ReportPeriodCustom:
+		if definition.From == nil || definition.To == nil {
+			return time.Time{}, time.Time{}, fmt.Errorf("custom report %s without date range", definition.Name)
+		}
+
+		return *definition.From, definition.To.AddDate(0, 0, 1), nil
+	}
+
+	return time.Time{}, time.Time{}, fmt.Errorf("unknown report period %q", definition.Period)
+}
+
+// PeriodReportView is the data the period report templates are rendered with, its amounts are already formatted
+// along with their currency
+type PeriodReportView struct {
+	LogoURL string `json:"logo_url,omitempty"`
+	Name    string `json:"name"`
+	// From and To are the first and last dates covered by the report, formatted like 2006-01-02
+	From         string `json:"from"`
+	To           string `json:"to"`
+	BaseCurrency string `json:"base_currency"`
+	// OpeningBalance and ClosingBalance are the balances of every currency converted into the base currency,
+	// empty without base currency
+	OpeningBalance   string               `json:"opening_balance,omitempty"`
+	ClosingBalance   string               `json:"closing_balance,omitempty"`
+	TransactionCount int64                `json:"transaction_count"`
+	Currencies       []PeriodCurrencyView `json:"currencies"`
+}
+
+// PeriodCurrencyView is the opening balance, movements and closing balance of the period in a single currency
+type PeriodCurrencyView struct {
+	Currency       string `json:"currency"`
+	OpeningBalance string `json:"opening_balance"`
+	CreditCount    int64  `json:"credit_count"`
+	CreditTotal    string `json:"credit_total"`
+	DebitCount     int64  `json:"debit_count"`
+	DebitTotal     string `json:"debit_total"`
+	ClosingBalance string `json:"closing_balance"`
+}
+
+// NewPeriodReportView builds the view of the report of an account over a period, from the completed summaries of
+// its transactions before the period and of its movements within the period, from the first date included to the
+// first date excluded
+func NewPeriodReportView(name string, from, until time.Time, opening, movements *model.AccountSummary, logoURL string) PeriodReportView {
+	view := PeriodReportView{
+		LogoURL:          logoURL,
+		Name:             name,
+		From:             from.Format(time.DateOnly),
+		To:               until.AddDate(0, 0, -1).Format(time.DateOnly),
+		BaseCurrency:     movements.BaseCurrency,
+		TransactionCount: movements.TransactionCount,
+	}
+
+	// the balances converted at the rate of every date add up
+	if opening.ConvertedBalance != nil && movements.ConvertedBalance != nil {
+		view.OpeningBalance = formatMoney(opening.BaseCurrency, *opening.ConvertedBalance)
+		view.ClosingBalance = formatMoney(movements.BaseCurrency, opening.ConvertedBalance.Add(*movements.ConvertedBalance))
+	}
+
+	openingBalances := map[string]decimal.Decimal{}
+	for _, currency := range opening.Currencies {
+		openingBalances[currency.Currency] = currency.Balance
+	}
+
+	movementsByCurrency := map[string]model.CurrencySummary{}
+	for _, currency := range movements.Currencies {
+		movementsByCurrency[currency.Currency] = currency
+	}
+
+	// currencies without movements within the period are reported as well
+	codes := []string{}
+	for code := range openingBalances {
+		codes = append(codes, code)
+	}
+	for code := range movementsByCurrency {
+		if _, ok := openingBalances[code]; !ok {
+			codes = append(codes, code)
+		}
+	}
+	sort.Strings(codes)
+
+	for _, code := range codes {
+		movement := movementsByCurrency[code]
+		closing := openingBalances[code].Add(movement.CreditTotal).Add(movement.DebitTotal)
+		view.Currencies = append(view.Currencies, PeriodCurrencyView{
+			Currency:       code,
+			OpeningBalance: formatMoney(code, openingBalances[code]),
+			CreditCount:    movement.CreditCount,
+			CreditTotal:    formatMoney(code, movement.CreditTotal),
+			DebitCount:     movement.DebitCount,
+			DebitTotal:     formatMoney(code, movement.DebitTotal),
+			ClosingBalance: formatMoney(code, closing),
+		})
+	}
+
+	return view
+}
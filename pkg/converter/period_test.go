@@ -0,0 +1,100 @@
+package converter
+
+import (
+	"testing"
+	"time"
+
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mdcantarini/transaction-processor-api/pkg/model"
+)
+
+func TestReportPeriodRange(t *testing.T) {
+	from := time.Date(2023, 12, 10, 0, 0, 0, 0, time.UTC)
+	to := time.Date(2023, 12, 20, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name       string
+		definition model.ReportDefinition
+		date       time.Time
+		from       time.Time
+		until      time.Time
+	}{
+		{"daily", model.ReportDefinition{Period: model.ReportPeriodDaily}, time.Date(2024, 1, 1, 6, 30, 0, 0, time.UTC), time.Date(2023, 12, 31, 0, 0, 0, 0, time.UTC), time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)},
+		// January 3rd 2024 is a Wednesday
+		{"weekly", model.ReportDefinition{Period: model.ReportPeriodWeekly}, time.Date(2024, 1, 3, 0, 0, 0, 0, time.UTC), time.Date(2023, 12, 25, 0, 0, 0, 0, time.UTC), time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)},
+		{"weekly on monday", model.ReportDefinition{Period: model.ReportPeriodWeekly}, time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC), time.Date(2023, 12, 25, 0, 0, 0, 0, time.UTC), time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)},
+		{"weekly on sunday", model.ReportDefinition{Period: model.ReportPeriodWeekly}, time.Date(2024, 1, 7, 0, 0, 0, 0, time.UTC), time.Date(2023, 12, 25, 0, 0, 0, 0, time.UTC), time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)},
+		{"monthly", model.ReportDefinition{Period: model.ReportPeriodMonthly}, time.Date(2024, 3, 15, 0, 0, 0, 0, time.UTC), time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC), time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)},
+		{"monthly across years", model.ReportDefinition{Period: model.ReportPeriodMonthly}, time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC), time.Date(2023, 12, 1, 0, 0, 0, 0, time.UTC), time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)},
+		{"custom", model.ReportDefinition{Period: model.ReportPeriodCustom, From: &from, To: &to}, time.Date(2024, 3, 15, 0, 0, 0, 0, time.UTC), from, time.Date(2023, 12, 21, 0, 0, 0, 0, time.UTC)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			from, until, err := ReportPeriodRange(tt.definition, tt.date)
+			require.NoError(t, err)
+			require.Equal(t, tt.from, from)
+			require.Equal(t, tt.until, until)
+		})
+	}
+}
+
+func TestReportPeriodRange_Errors(t *testing.T) {
+	_, _, err := ReportPeriodRange(model.ReportDefinition{Name: "Audit", Period: model.ReportPeriodCustom}, time.Now())
+	require.EqualError(t, err, "custom report Audit without date range")
+
+	_, _, err = ReportPeriodRange(model.ReportDefinition{Period: "yearly"}, time.Now())
+	require.EqualError(t, err, `unknown report period "yearly"`)
+}
+
+func newTestPeriodReportView() PeriodReportView {
+	openingConverted := decimal.RequireFromString("110")
+	opening := &model.AccountSummary{
+		BaseCurrency:     "USD",
+		ConvertedBalance: &openingConverted,
+		Currencies: []model.CurrencySummary{
+			{Currency: "EUR", Balance: decimal.RequireFromString("100")},
+		},
+	}
+
+	movementsConverted := decimal.RequireFromString("40.2")
+	movements := &model.AccountSummary{
+		BaseCurrency:     "USD",
+		ConvertedBalance: &movementsConverted,
+		TransactionCount: 3,
+		Currencies: []model.CurrencySummary{
+			{Currency: "USD", CreditTotal: decimal.RequireFromString("60.5"), CreditCount: 2, DebitTotal: decimal.RequireFromString("-20.3"), DebitCount: 1},
+		},
+	}
+
+	from := time.Date(2023, 12, 1, 0, 0, 0, 0, time.UTC)
+	return NewPeriodReportView("Monthly statement", from, from.AddDate(0, 1, 0), opening, movements, "https://example.com/logo.png")
+}
+
+func TestNewPeriodReportView(t *testing.T) {
+	view := newTestPeriodReportView()
+
+	require.Equal(t, "2023-12-01", view.From)
+	require.Equal(t, "2023-12-31", view.To)
+	require.Equal(t, "110.00 USD", view.OpeningBalance)
+	require.Equal(t, "150.20 USD", view.ClosingBalance)
+	// currencies without movements keep their opening balance
+	require.Equal(t, []PeriodCurrencyView{
+		{Currency: "EUR", OpeningBalance: "100.00 EUR", CreditTotal: "0.00 EUR", DebitTotal: "0.00 EUR", ClosingBalance: "100.00 EUR"},
+		{Currency: "USD", OpeningBalance: "0.00 USD", CreditCount: 2, CreditTotal: "60.50 USD", DebitCount: 1, DebitTotal: "-20.30 USD", ClosingBalance: "40.20 USD"},
+	}, view.Currencies)
+}
+
+func TestRenderPeriodReport(t *testing.T) {
+	renderer := DefaultReportRenderer()
+
+	html, err := renderer.RenderPeriodHTML(newTestPeriodReportView())
+	require.NoError(t, err)
+	requireGolden(t, "period_report.golden.html", html)
+
+	text, err := renderer.RenderPeriodText(newTestPeriodReportView())
+	require.NoError(t, err)
+	requireGolden(t, "period_report.golden.txt", text)
+}
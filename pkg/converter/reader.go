@@ -0,0 +1,86 @@
+package converter
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+
+	"github.com/mdcantarini/transaction-processor-api/pkg/model"
+)
+
+// CSVTransactionReader converts the rows of a CSV file into transactions one at a time,
+// so files of any size can be processed without loading them in memory
+type CSVTransactionReader struct {
+	reader  *csv.Reader
+	profile MappingProfile
+	mapping *ColumnMapping
+	line    int
+}
+
+func NewCSVTransactionReader(r io.Reader, profile MappingProfile) *CSVTransactionReader {
+	reader := csv.NewReader(r)
+	reader.Comma = profile.DelimiterRune()
+	// preamble rows usually have fewer fields than the transaction rows
+	reader.FieldsPerRecord = -1
+	// records are converted right away, so the same slice can be reused
+	reader.ReuseRecord = true
+
+	return &CSVTransactionReader{reader: reader, profile: profile}
+}
+
+// Read returns the transaction of the next row, or the errors found while converting it.
+// It returns io.EOF once there are no more rows, any other error means the file cannot be read.
+func (tr *CSVTransactionReader) Read() (model.Transaction, []RowError, error) {
+	if tr.mapping == nil {
+		err := tr.detectHeader()
+		if err != nil {
+			return model.Transaction{}, nil, err
+		}
+	}
+
+	record, err := tr.reader.Read()
+	if err != nil {
+		return model.Transaction{}, nil, err
+	}
+
+	tr.line, _ = tr.reader.FieldPos(0)
+	transaction, rowErrors := tr.mapping.RecordToTransaction(tr.line, record)
+
+	return transaction, rowErrors, nil
+}
+
+// Line returns the file line of the last row read
+func (tr *CSVTransactionReader) Line() int {
+	return tr.line
+}
+
+// detectHeader skips the leading records until finding the header
+func (tr *CSVTransactionReader) detectHeader() error {
+	var firstErr error
+	for i := 0; i < headerSearchRows; i++ {
+		record, err := tr.reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+
+		mapping, err := tr.profile.ResolveHeader(record)
+		if err == nil {
+			tr.mapping = mapping
+			return nil
+		}
+
+		// the missing columns of the first record are reported, since it is usually the header
+		if firstErr == nil {
+			firstErr = err
+		}
+	}
+
+	if firstErr == nil {
+		return fmt.Errorf("%w: the file is empty", ErrMissingColumns)
+	}
+
+	return firstErr
+}
@@ -0,0 +1,269 @@
+package converter
+
+import (
+	"bytes"
+	"embed"
+	"errors"
+	"fmt"
+	htmltemplate "html/template"
+	"io/fs"
+	"os"
+	"path/filepath"
+	texttemplate "text/template"
+	"time"
+
+	"github.com/shopspring/decimal"
+
+	"github.com/mdcantarini/transaction-processor-api/pkg/model"
+)
+
+const (
+	// ReportHTMLTemplate and ReportTextTemplate are the file names of the report templates, a templates
+	// directory overrides the embedded defaults with the files of the same name
+	ReportHTMLTemplate = "report.html"
+	ReportTextTemplate = "report.txt"
+	// PeriodReportHTMLTemplate and PeriodReportTextTemplate are the file names of the period report templates
+	PeriodReportHTMLTemplate = "period_report.html"
+	PeriodReportTextTemplate = "period_report.txt"
+)
+
+var (
+	htmlTemplateNames = []string{ReportHTMLTemplate, PeriodReportHTMLTemplate}
+	textTemplateNames = []string{ReportTextTemplate, PeriodReportTextTemplate}
+)
+
+//go:embed templates
+var embeddedTemplates embed.FS
+
+// defaultReportRenderer renders the reports with the embedded templates
+var defaultReportRenderer = mustParseReportTemplates()
+
+// ReportView is the data the report templates are rendered with, its amounts are already formatted along
+// with their currency
+type ReportView struct {
+	LogoURL      string `json:"logo_url,omitempty"`
+	BaseCurrency string `json:"base_currency"`
+	// ConvertedBalance is the balance of the whole history in the base currency, empty without base currency
+	ConvertedBalance string               `json:"converted_balance,omitempty"`
+	Currencies       []ReportCurrencyView `json:"currencies"`
+	Months           []ReportMonthView    `json:"months"`
+	// NewTransactionCount and NewCurrencies summarize the new transactions, like those inserted by an import
+	NewTransactionCount int64                `json:"new_transaction_count"`
+	NewCurrencies       []ReportMovementView `json:"new_currencies"`
+}
+
+// ReportCurrencyView is the balance and averages of the history of a currency
+type ReportCurrencyView struct {
+	Currency string `json:"currency"`
+	Balance  string `json:"balance"`
+	// ConvertedBalance is the balance in the base currency, empty for the base currency itself
+	ConvertedBalance string `json:"converted_balance,omitempty"`
+	AverageDebit     string `json:"average_debit"`
+	AverageCredit    string `json:"average_credit"`
+}
+
+// ReportMonthView is the credits, debits and number of transactions of a month in a single currency, the month
+// being named like December 2023
+type ReportMonthView struct {
+	Month       string `json:"month"`
+	Currency    string `json:"currency"`
+	CreditTotal string `json:"credit_total"`
+	DebitTotal  string `json:"debit_total"`
+	Net         string `json:"net"`
+	Count       int64  `json:"count"`
+}
+
+// ReportMovementView is the credits and debits in a currency
+type ReportMovementView struct {
+	Currency    string `json:"currency"`
+	CreditCount int64  `json:"credit_count"`
+	CreditTotal string `json:"credit_total"`
+	DebitCount  int64  `json:"debit_count"`
+	DebitTotal  string `json:"debit_total"`
+}
+
+// NewReportView builds the view of the report of an account from the completed summaries of its history and of
+// its new transactions
+func NewReportView(history, latest *model.AccountSummary, logoURL string) ReportView {
+	view := ReportView{
+		LogoURL:             logoURL,
+		BaseCurrency:        history.BaseCurrency,
+		NewTransactionCount: latest.TransactionCount,
+	}
+
+	if history.ConvertedBalance != nil {
+		view.ConvertedBalance = formatMoney(history.BaseCurrency, *history.ConvertedBalance)
+	}
+
+	// amounts in different currencies cannot be added together
+	for _, currency := range history.Currencies {
+		currencyView := ReportCurrencyView{
+			Currency:      currency.Currency,
+			Balance:       formatMoney(currency.Currency, currency.Balance),
+			AverageDebit:  formatMoney(currency.Currency, currency.AverageDebit),
+			AverageCredit: formatMoney(currency.Currency, currency.AverageCredit),
+		}
+		if currency.ConvertedBalance != nil && currency.Currency != history.BaseCurrency {
+			currencyView.ConvertedBalance = formatMoney(history.BaseCurrency, *currency.ConvertedBalance)
+		}
+
+		view.Currencies = append(view.Currencies, currencyView)
+	}
+
+	for _, month := range history.Months {
+		view.Months = append(view.Months, ReportMonthView{
+			Month:       monthName(month.Month),
+			Currency:    month.Currency,
+			CreditTotal: formatMoney(month.Currency, month.CreditTotal),
+			DebitTotal:  formatMoney(month.Currency, month.DebitTotal),
+			Net:         formatMoney(month.Currency, month.Net),
+			Count:       month.Count,
+		})
+	}
+
+	for _, currency := range latest.Currencies {
+		view.NewCurrencies = append(view.NewCurrencies, ReportMovementView{
+			Currency:    currency.Currency,
+			CreditCount: currency.CreditCount,
+			CreditTotal: formatMoney(currency.Currency, currency.CreditTotal),
+			DebitCount:  currency.DebitCount,
+			DebitTotal:  formatMoney(currency.Currency, currency.DebitTotal),
+		})
+	}
+
+	return view
+}
+
+// formatMoney formats the amount in the minor unit of its currency, followed by the currency code
+func formatMoney(code string, amount decimal.Decimal) string {
+	return fmt.Sprintf("%s %s", FormatAmount(code, amount), code)
+}
+
+// monthName turns months like 2023-12 into December 2023
+func monthName(month string) string {
+	t, err := time.Parse("2006-01", month)
+	if err != nil {
+		return month
+	}
+
+	return t.Format("January 2006")
+}
+
+// ReportRenderer renders the reports as HTML, escaping every value of the view, and as plain text
+type ReportRenderer struct {
+	html *htmltemplate.Template
+	text *texttemplate.Template
+}
+
+// DefaultReportRenderer returns the renderer of the embedded templates
+func DefaultReportRenderer() *ReportRenderer {
+	return defaultReportRenderer
+}
+
+// NewReportRenderer parses the report templates found in the directory, falling back to the embedded defaults
+// for the missing ones. The embedded templates are used alone when the directory is empty.
+func NewReportRenderer(dir string) (*ReportRenderer, error) {
+	if dir == "" {
+		return defaultReportRenderer, nil
+	}
+
+	return parseReportTemplates(func(name string) ([]byte, error) {
+		return readReportTemplate(dir, name)
+	})
+}
+
+// RenderHTML renders the HTML body of the report
+func (rr *ReportRenderer) RenderHTML(view ReportView) (string, error) {
+	return rr.renderHTML(ReportHTMLTemplate, view)
+}
+
+// RenderText renders the plain text body of the report
+func (rr *ReportRenderer) RenderText(view ReportView) (string, error) {
+	return rr.renderText(ReportTextTemplate, view)
+}
+
+// RenderPeriodHTML renders the HTML body of the period report
+func (rr *ReportRenderer) RenderPeriodHTML(view PeriodReportView) (string, error) {
+	return rr.renderHTML(PeriodReportHTMLTemplate, view)
+}
+
+// RenderPeriodText renders the plain text body of the period report
+func (rr *ReportRenderer) RenderPeriodText(view PeriodReportView) (string, error) {
+	return rr.renderText(PeriodReportTextTemplate, view)
+}
+
+func (rr *ReportRenderer) renderHTML(name string, view any) (string, error) {
+	var buf bytes.Buffer
+	err := rr.html.ExecuteTemplate(&buf, name, view)
+	if err != nil {
+		return "", fmt.Errorf("unable to render %s: %w", name, err)
+	}
+
+	return buf.String(), nil
+}
+
+func (rr *ReportRenderer) renderText(name string, view any) (string, error) {
+	var buf bytes.Buffer
+	err := rr.text.ExecuteTemplate(&buf, name, view)
+	if err != nil {
+		return "", fmt.Errorf("unable to render %s: %w", name, err)
+	}
+
+	return buf.String(), nil
+}
+
+// readReportTemplate reads the template from the directory, or the embedded one when the directory lacks it
+func readReportTemplate(dir, name string) ([]byte, error) {
+	content, err := os.ReadFile(filepath.Join(dir, name))
+	if errors.Is(err, fs.ErrNotExist) {
+		return readEmbeddedTemplate(name)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unable to read template %s: %w", name, err)
+	}
+
+	return content, nil
+}
+
+func readEmbeddedTemplate(name string) ([]byte, error) {
+	return embeddedTemplates.ReadFile("templates/" + name)
+}
+
+// parseReportTemplates parses every report template, reading them through the given function
+func parseReportTemplates(read func(name string) ([]byte, error)) (*ReportRenderer, error) {
+	renderer := &ReportRenderer{html: htmltemplate.New(""), text: texttemplate.New("")}
+	for _, name := range htmlTemplateNames {
+		content, err := read(name)
+		if err != nil {
+			return nil, err
+		}
+
+		_, err = renderer.html.New(name).Parse(string(content))
+		if err != nil {
+			return nil, fmt.Errorf("unable to parse template %s: %w", name, err)
+		}
+	}
+
+	for _, name := range textTemplateNames {
+		content, err := read(name)
+		if err != nil {
+			return nil, err
+		}
+
+		_, err = renderer.text.New(name).Parse(string(content))
+		if err != nil {
+			return nil, fmt.Errorf("unable to parse template %s: %w", name, err)
+		}
+	}
+
+	return renderer, nil
+}
+
+func mustParseReportTemplates() *ReportRenderer {
+	renderer, err := parseReportTemplates(readEmbeddedTemplate)
+	if err != nil {
+		panic(err)
+	}
+
+	return renderer
+}
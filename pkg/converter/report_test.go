@@ -0,0 +1,131 @@
+package converter
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mdcantarini/transaction-processor-api/pkg/model"
+)
+
+var update = flag.Bool("update", false, "update the golden files of the rendered reports")
+
+// requireGolden compares the rendered content with the golden file in testdata, rewriting it with -update
+func requireGolden(t *testing.T, name, content string) {
+	path := filepath.Join("testdata", name)
+	if *update {
+		require.NoError(t, os.WriteFile(path, []byte(content), 0644))
+	}
+
+	golden, err := os.ReadFile(path)
+	require.NoError(t, err)
+	require.Equal(t, string(golden), content)
+}
+
+func newTestReportView() ReportView {
+	converted := decimal.RequireFromString("60.5")
+	convertedEUR := decimal.RequireFromString("50")
+	history := &model.AccountSummary{
+		BaseCurrency:     "USD",
+		ConvertedBalance: &converted,
+		Currencies: []model.CurrencySummary{
+			{Currency: "EUR", Balance: decimal.RequireFromString("50"), AverageDebit: decimal.RequireFromString("-50"), AverageCredit: decimal.RequireFromString("100"), ConvertedBalance: &convertedEUR},
+			{Currency: "USD", Balance: decimal.RequireFromString("10.5"), AverageCredit: decimal.RequireFromString("10.5"), ConvertedBalance: &converted},
+		},
+		Months: []model.MonthlySummary{
+			{Month: "2023-01", Currency: "USD", CreditTotal: decimal.RequireFromString("10.5"), Net: decimal.RequireFromString("10.5"), Count: 1},
+			{Month: "2023-12", Currency: "EUR", CreditTotal: decimal.RequireFromString("100"), DebitTotal: decimal.RequireFromString("-50"), Net: decimal.RequireFromString("50"), Count: 2},
+			{Month: "2024-01", Currency: "USD", Count: 1},
+		},
+	}
+
+	latest := &model.AccountSummary{
+		TransactionCount: 2,
+		Currencies: []model.CurrencySummary{
+			{Currency: "EUR", CreditTotal: decimal.RequireFromString("100"), CreditCount: 1, DebitTotal: decimal.RequireFromString("-50"), DebitCount: 1},
+		},
+	}
+
+	return NewReportView(history, latest, "https://example.com/logo.png")
+}
+
+func TestNewReportView(t *testing.T) {
+	view := newTestReportView()
+
+	require.Equal(t, "60.50 USD", view.ConvertedBalance)
+	require.Equal(t, ReportCurrencyView{Currency: "EUR", Balance: "50.00 EUR", ConvertedBalance: "50.00 USD", AverageDebit: "-50.00 EUR", AverageCredit: "100.00 EUR"}, view.Currencies[0])
+	// the balance in the base currency is not converted again
+	require.Empty(t, view.Currencies[1].ConvertedBalance)
+	// months of the same name in different years are kept apart
+	require.Equal(t, []ReportMonthView{
+		{Month: "January 2023", Currency: "USD", CreditTotal: "10.50 USD", DebitTotal: "0.00 USD", Net: "10.50 USD", Count: 1},
+		{Month: "December 2023", Currency: "EUR", CreditTotal: "100.00 EUR", DebitTotal: "-50.00 EUR", Net: "50.00 EUR", Count: 2},
+		{Month: "January 2024", Currency: "USD", CreditTotal: "0.00 USD", DebitTotal: "0.00 USD", Net: "0.00 USD", Count: 1},
+	}, view.Months)
+	require.Equal(t, []ReportMovementView{{Currency: "EUR", CreditCount: 1, CreditTotal: "100.00 EUR", DebitCount: 1, DebitTotal: "-50.00 EUR"}}, view.NewCurrencies)
+}
+
+func TestRenderReport(t *testing.T) {
+	renderer := DefaultReportRenderer()
+
+	html, err := renderer.RenderHTML(newTestReportView())
+	require.NoError(t, err)
+	requireGolden(t, "report.golden.html", html)
+
+	text, err := renderer.RenderText(newTestReportView())
+	require.NoError(t, err)
+	requireGolden(t, "report.golden.txt", text)
+}
+
+func TestRenderReport_NoNewTransactions(t *testing.T) {
+	view := NewReportView(&model.AccountSummary{}, &model.AccountSummary{}, "")
+
+	html, err := DefaultReportRenderer().RenderHTML(view)
+	require.NoError(t, err)
+	requireGolden(t, "report_empty.golden.html", html)
+
+	text, err := DefaultReportRenderer().RenderText(view)
+	require.NoError(t, err)
+	requireGolden(t, "report_empty.golden.txt", text)
+}
+
+func TestRenderReportHTML_EscapesValues(t *testing.T) {
+	view := ReportView{
+		LogoURL:    `javascript:alert("logo")`,
+		Currencies: []ReportCurrencyView{{Currency: "USD", Balance: "<b>10.00 USD</b>"}},
+	}
+
+	html, err := DefaultReportRenderer().RenderHTML(view)
+	require.NoError(t, err)
+	require.Contains(t, html, "<p>Total balance is: &lt;b&gt;10.00 USD&lt;/b&gt;</p>")
+	require.Contains(t, html, `<img src="#ZgotmplZ" alt="logo">`)
+}
+
+func TestNewReportRenderer_OverridesTemplates(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, ReportTextTemplate), []byte("{{.NewTransactionCount}} new transactions"), 0644))
+
+	renderer, err := NewReportRenderer(dir)
+	require.NoError(t, err)
+
+	text, err := renderer.RenderText(newTestReportView())
+	require.NoError(t, err)
+	require.Equal(t, "2 new transactions", text)
+
+	// the HTML template missing from the directory is the embedded one
+	html, err := renderer.RenderHTML(newTestReportView())
+	require.NoError(t, err)
+	requireGolden(t, "report.golden.html", html)
+}
+
+func TestNewReportRenderer_ErrorInvalidTemplate(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, ReportHTMLTemplate), []byte("{{.Unclosed"), 0644))
+
+	_, err := NewReportRenderer(dir)
+	require.ErrorContains(t, err, "unable to parse template report.html")
+}
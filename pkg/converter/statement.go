@@ -0,0 +1,95 @@
+package converter
+
+import (
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"math"
+
+	"github.com/mdcantarini/transaction-processor-api/pkg/model"
+)
+
+// ErrUnknownBankAccount must be returned by an AccountResolver when no account owns the bank account
+var ErrUnknownBankAccount = errors.New("unknown bank account")
+
+// AccountResolver returns the ID of the account owning the given bank account number
+type AccountResolver func(bankAccount string) (int, error)
+
+// StatementEntry is a transaction read from a bank statement file, whose account is still identified
+// by the bank account number
+type StatementEntry struct {
+	Line        int
+	BankAccount string
+	Transaction model.Transaction
+	Errors      []RowError
+}
+
+// StatementTransactionReader returns the transactions of a parsed bank statement one at a time,
+// resolving the account of each one of them
+type StatementTransactionReader struct {
+	entries []StatementEntry
+	resolve AccountResolver
+	// accounts caches the resolved bank accounts, since statements usually belong to a single one
+	accounts map[string]int
+	line     int
+}
+
+func NewStatementTransactionReader(entries []StatementEntry, resolve AccountResolver) *StatementTransactionReader {
+	return &StatementTransactionReader{entries: entries, resolve: resolve, accounts: map[string]int{}}
+}
+
+// Read returns the transaction of the next statement entry, or the errors found while converting it.
+// It returns io.EOF once there are no more entries.
+func (sr *StatementTransactionReader) Read() (model.Transaction, []RowError, error) {
+	if len(sr.entries) == 0 {
+		return model.Transaction{}, nil, io.EOF
+	}
+
+	entry := sr.entries[0]
+	sr.entries = sr.entries[1:]
+	sr.line = entry.Line
+	if len(entry.Errors) > 0 {
+		return model.Transaction{}, entry.Errors, nil
+	}
+
+	accountID, ok := sr.accounts[entry.BankAccount]
+	if !ok {
+		var err error
+		accountID, err = sr.resolve(entry.BankAccount)
+		if errors.Is(err, ErrUnknownBankAccount) {
+			return model.Transaction{}, []RowError{{
+				Line:   entry.Line,
+				Column: FieldAccountID,
+				Value:  entry.BankAccount,
+				Reason: err.Error(),
+			}}, nil
+		}
+		if err != nil {
+			return model.Transaction{}, nil, err
+		}
+
+		sr.accounts[entry.BankAccount] = accountID
+	}
+
+	transaction := entry.Transaction
+	transaction.AccountID = accountID
+
+	return transaction, nil, nil
+}
+
+// Line returns the file line of the last entry read
+func (sr *StatementTransactionReader) Line() int {
+	return sr.line
+}
+
+// StatementTransactionID derives a stable transaction ID from the key identifying a statement entry within its bank
+// account, so importing the same statement twice does not duplicate its transactions. Keys must be unique, since
+// entries sharing one are dropped as duplicates.
+func StatementTransactionID(format, bankAccount, key string) int {
+	hash := fnv.New64a()
+	_, _ = fmt.Fprintf(hash, "%s|%s|%s", format, bankAccount, key)
+
+	// keep the ID positive and away from zero
+	return int(hash.Sum64()%(math.MaxInt64-1)) + 1
+}
@@ -0,0 +1,86 @@
+package converter
+
+import (
+	"sort"
+
+	"github.com/shopspring/decimal"
+
+	"github.com/mdcantarini/transaction-processor-api/pkg/model"
+)
+
+// CompleteSummary computes the balances, monthly nets and averages of a summary holding the totals and counts of
+// every currency. Balances in a currency other than the base currency are converted into it using the rate effective
+// on every date, the summary cannot be completed when any rate is missing. No conversion happens when the
+// base currency is empty.
+func CompleteSummary(summary *model.AccountSummary, baseCurrency string, findRate RateFinder) error {
+	summary.BaseCurrency = baseCurrency
+	summary.TransactionCount = 0
+
+	convertedBalances := map[string]decimal.Decimal{}
+	if baseCurrency != "" {
+		for _, daily := range summary.DailyTotals {
+			converted := daily.Total
+			if daily.Currency != baseCurrency {
+				rate, err := findRate(daily.Currency, baseCurrency, daily.Date)
+				if err != nil {
+					return err
+				}
+
+				converted = converted.Mul(rate)
+			}
+
+			convertedBalances[daily.Currency] = convertedBalances[daily.Currency].Add(converted)
+		}
+
+		convertedBalance := decimal.Zero
+		summary.ConvertedBalance = &convertedBalance
+	}
+
+	// months formatted like 2023-12 sort chronologically
+	sort.SliceStable(summary.Months, func(i, j int) bool {
+		if summary.Months[i].Month != summary.Months[j].Month {
+			return summary.Months[i].Month < summary.Months[j].Month
+		}
+
+		return summary.Months[i].Currency < summary.Months[j].Currency
+	})
+	for i := range summary.Months {
+		month := &summary.Months[i]
+		month.Net = month.CreditTotal.Add(month.DebitTotal)
+	}
+
+	for i := range summary.Currencies {
+		currency := &summary.Currencies[i]
+		currency.Balance = currency.CreditTotal.Add(currency.DebitTotal)
+		currency.AverageCredit = roundAmount(currency.Currency, average(currency.CreditTotal, currency.CreditCount))
+		currency.AverageDebit = roundAmount(currency.Currency, average(currency.DebitTotal, currency.DebitCount))
+		summary.TransactionCount += currency.CreditCount + currency.DebitCount
+
+		if summary.ConvertedBalance != nil {
+			converted := roundAmount(baseCurrency, convertedBalances[currency.Currency])
+			currency.ConvertedBalance = &converted
+			*summary.ConvertedBalance = summary.ConvertedBalance.Add(converted)
+		}
+	}
+
+	return nil
+}
+
+// average returns the mean of total over count, or zero when there are no amounts
+func average(total decimal.Decimal, count int64) decimal.Decimal {
+	if count == 0 {
+		return decimal.Zero
+	}
+
+	return total.Div(decimal.NewFromInt(count))
+}
+
+// roundAmount rounds the amount to the minor unit of its currency, unknown currencies keep the amount as is
+func roundAmount(code string, amount decimal.Decimal) decimal.Decimal {
+	units, err := CurrencyMinorUnits(code)
+	if err != nil {
+		return amount
+	}
+
+	return amount.Round(units)
+}
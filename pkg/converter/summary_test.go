@@ -0,0 +1,95 @@
+package converter
+
+import (
+	"testing"
+	"time"
+
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/require"
+
+	"github.com/mdcantarini/transaction-processor-api/pkg/model"
+)
+
+func TestCompleteSummary_TotalsByCurrency(t *testing.T) {
+	summary := &model.AccountSummary{
+		Currencies: []model.CurrencySummary{
+			{Currency: "JPY", CreditTotal: decimal.RequireFromString("1000"), CreditCount: 1},
+			{Currency: "USD", CreditTotal: decimal.RequireFromString("60.5"), CreditCount: 1, DebitTotal: decimal.RequireFromString("-20.5"), DebitCount: 3},
+		},
+	}
+
+	require.NoError(t, CompleteSummary(summary, "", nil))
+
+	require.Equal(t, int64(5), summary.TransactionCount)
+	require.Nil(t, summary.ConvertedBalance)
+	require.Equal(t, "1000", summary.Currencies[0].Balance.String())
+	require.Equal(t, "0", summary.Currencies[0].AverageDebit.String())
+	require.Nil(t, summary.Currencies[0].ConvertedBalance)
+	require.Equal(t, "40", summary.Currencies[1].Balance.String())
+	// averages are rounded to the minor unit of the currency
+	require.Equal(t, "-6.83", summary.Currencies[1].AverageDebit.String())
+	require.Equal(t, "60.5", summary.Currencies[1].AverageCredit.String())
+}
+
+func TestCompleteSummary_ConvertsIntoBaseCurrency(t *testing.T) {
+	summary := &model.AccountSummary{
+		Currencies: []model.CurrencySummary{
+			{Currency: "EUR", CreditTotal: decimal.RequireFromString("100"), CreditCount: 1, DebitTotal: decimal.RequireFromString("-50"), DebitCount: 1},
+			{Currency: "USD", CreditTotal: decimal.RequireFromString("10.5"), CreditCount: 1},
+		},
+		DailyTotals: []model.DailyTotal{
+			{Currency: "EUR", Date: time.Date(2023, 12, 14, 0, 0, 0, 0, time.UTC), Total: decimal.RequireFromString("100")},
+			{Currency: "EUR", Date: time.Date(2023, 12, 15, 0, 0, 0, 0, time.UTC), Total: decimal.RequireFromString("-50")},
+			{Currency: "USD", Date: time.Date(2023, 12, 15, 0, 0, 0, 0, time.UTC), Total: decimal.RequireFromString("10.5")},
+		},
+	}
+	findRate := func(from, to string, date time.Time) (decimal.Decimal, error) {
+		require.Equal(t, "EUR", from)
+		require.Equal(t, "USD", to)
+		if date.Day() == 14 {
+			return decimal.RequireFromString("1.1"), nil
+		}
+
+		return decimal.RequireFromString("1.2"), nil
+	}
+
+	require.NoError(t, CompleteSummary(summary, "USD", findRate))
+
+	// 100 * 1.1 - 50 * 1.2 + 10.5
+	require.Equal(t, "60.5", summary.ConvertedBalance.String())
+	require.Equal(t, "50", summary.Currencies[0].ConvertedBalance.String())
+	require.Equal(t, "10.5", summary.Currencies[1].ConvertedBalance.String())
+}
+
+func TestCompleteSummary_MonthlyBreakdown(t *testing.T) {
+	summary := &model.AccountSummary{
+		Months: []model.MonthlySummary{
+			{Month: "2024-01", Currency: "USD", CreditTotal: decimal.RequireFromString("20"), Count: 1},
+			{Month: "2023-12", Currency: "USD", CreditTotal: decimal.RequireFromString("60.5"), DebitTotal: decimal.RequireFromString("-10.3"), Count: 2},
+			{Month: "2023-12", Currency: "EUR", DebitTotal: decimal.RequireFromString("-5"), Count: 1},
+			{Month: "2023-01", Currency: "USD", CreditTotal: decimal.RequireFromString("1"), Count: 1},
+		},
+	}
+
+	require.NoError(t, CompleteSummary(summary, "", nil))
+
+	// months are ordered chronologically across years, then by currency
+	months := []string{}
+	for _, month := range summary.Months {
+		months = append(months, month.Month+" "+month.Currency)
+	}
+	require.Equal(t, []string{"2023-01 USD", "2023-12 EUR", "2023-12 USD", "2024-01 USD"}, months)
+	require.Equal(t, "-5", summary.Months[1].Net.String())
+	require.Equal(t, "50.2", summary.Months[2].Net.String())
+}
+
+func TestCompleteSummary_MissingRate(t *testing.T) {
+	summary := &model.AccountSummary{
+		DailyTotals: []model.DailyTotal{{Currency: "EUR", Total: decimal.RequireFromString("100")}},
+	}
+	findRate := func(from, to string, date time.Time) (decimal.Decimal, error) {
+		return decimal.Zero, ErrMissingFXRate
+	}
+
+	require.ErrorIs(t, CompleteSummary(summary, "USD", findRate), ErrMissingFXRate)
+}
@@ -2,7 +2,6 @@ package converter
 
 import (
 	"fmt"
-	"os"
 	"strconv"
 	"strings"
 	"time"
@@ -12,44 +11,85 @@ import (
 	"github.com/mdcantarini/transaction-processor-api/pkg/model"
 )
 
-var CSVRecordsToTransactions = csvRecordsToTransactions
-
 const (
 	convertingError = `error converting`
+	columnsError    = `unexpected number of columns`
 )
 
-func csvRecordsToTransactions(records [][]string) ([]model.Transaction, error) {
-	var transactions []model.Transaction
-	for _, record := range records {
-		transactionID, err := stringToInt(record[0])
-		if err != nil {
-			return nil, fmt.Errorf(fmt.Sprintf("%s %s", convertingError, "transactionID"))
-		}
+// RowError describes why a value of a CSV record could not be converted into a transaction
+type RowError struct {
+	Line   int    `json:"line"`
+	Column string `json:"column"`
+	Value  string `json:"value"`
+	Reason string `json:"reason"`
+}
 
-		date, err := stringToDate(record[1])
-		if err != nil {
-			return nil, fmt.Errorf(fmt.Sprintf("%s %s", convertingError, "date"))
-		}
+func (re RowError) Error() string {
+	return fmt.Sprintf("line %d: %s %s: %s", re.Line, convertingError, re.Column, re.Reason)
+}
 
-		transactionAmount, err := stringToDecimal(record[2])
-		if err != nil {
-			return nil, fmt.Errorf(fmt.Sprintf("%s %s", convertingError, "transactionAmount"))
-		}
+// RowErrorCSVHeader is the header of the CSV files listing rejected rows
+var RowErrorCSVHeader = []string{"line", "column", "value", "reason"}
 
-		accountID, err := stringToInt(record[3])
-		if err != nil {
-			return nil, fmt.Errorf(fmt.Sprintf("%s %s", convertingError, "accountID"))
+// CSVRecord returns the row error as a record of a rejected rows CSV file
+func (re RowError) CSVRecord() []string {
+	return []string{strconv.Itoa(re.Line), re.Column, re.Value, re.Reason}
+}
+
+// RecordToTransaction converts a record found in the given file line into a transaction
+func (cm ColumnMapping) RecordToTransaction(line int, record []string) (model.Transaction, []RowError) {
+	for _, index := range cm.indexes {
+		if index >= len(record) {
+			return model.Transaction{}, []RowError{{
+				Line:   line,
+				Column: "record",
+				Value:  strings.Join(record, cm.profile.Delimiter),
+				Reason: fmt.Sprintf("%s: got %d", columnsError, len(record)),
+			}}
 		}
+	}
+
+	var rowErrors []RowError
+	value := func(field string) string {
+		return strings.TrimSpace(record[cm.indexes[field]])
+	}
+	addError := func(field string, err error) {
+		rowErrors = append(rowErrors, RowError{Line: line, Column: field, Value: value(field), Reason: err.Error()})
+	}
+
+	transactionID, err := stringToInt(value(FieldTransactionID))
+	if err != nil {
+		addError(FieldTransactionID, err)
+	}
+
+	date, err := stringToDateWithFormat(value(FieldDate), cm.profile.DateFormat)
+	if err != nil {
+		addError(FieldDate, err)
+	}
+
+	transactionAmount, err := stringToDecimalWithSeparator(value(FieldTransactionAmount), cm.profile.DecimalSeparator)
+	if err != nil {
+		addError(FieldTransactionAmount, err)
+	}
 
-		transactions = append(transactions, model.Transaction{
-			TransactionID:     transactionID,
-			Date:              date,
-			TransactionAmount: transactionAmount,
-			AccountID:         accountID,
-		})
+	accountID, err := stringToInt(value(FieldAccountID))
+	if err != nil {
+		addError(FieldAccountID, err)
+	}
+
+	// the currency is validated once the transaction is known to have one
+	var currency string
+	if _, ok := cm.indexes[FieldCurrency]; ok {
+		currency = NormalizeCurrency(value(FieldCurrency))
 	}
 
-	return transactions, nil
+	return model.Transaction{
+		TransactionID:     transactionID,
+		Date:              date,
+		TransactionAmount: transactionAmount,
+		Currency:          currency,
+		AccountID:         accountID,
+	}, rowErrors
 }
 
 func stringToInt(s string) (int, error) {
@@ -70,62 +110,32 @@ func stringToDecimal(s string) (decimal.Decimal, error) {
 	return d, nil
 }
 
-const dateFormat = "2006-01-02"
+// stringToDecimalWithSeparator converts amounts using a decimal separator other than the dot, like 60,5
+func stringToDecimalWithSeparator(s, separator string) (decimal.Decimal, error) {
+	if separator == "" || separator == "." {
+		return stringToDecimal(s)
+	}
 
-func stringToDate(s string) (time.Time, error) {
-	d, err := time.Parse(dateFormat, s)
+	// a dot would be silently taken as the decimal separator
+	if strings.Contains(s, ".") {
+		return decimal.Zero, fmt.Errorf("unable to convert %s into decimal", s)
+	}
+
+	d, err := stringToDecimal(strings.Replace(s, separator, ".", 1))
 	if err != nil {
-		return time.Now(), fmt.Errorf("unable to convert %s into decimal", s)
+		return decimal.Zero, fmt.Errorf("unable to convert %s into decimal", s)
 	}
 
 	return d, nil
 }
 
-func TransactionsToEmailTemplate(transactions []model.Transaction) string {
-	debitTotal := decimal.Zero
-	debitCount := decimal.Zero
-	creditTotal := decimal.Zero
-	creditCount := decimal.Zero
-	transactionCountByMonth := map[string]int{}
-
-	for _, t := range transactions {
-		if t.TransactionAmount.IsPositive() {
-			creditCount = creditCount.Add(decimal.RequireFromString("1"))
-			creditTotal = creditTotal.Add(t.TransactionAmount)
-		} else {
-			debitCount = debitCount.Add(decimal.RequireFromString("1"))
-			debitTotal = debitTotal.Add(t.TransactionAmount)
-		}
-
-		if _, ok := transactionCountByMonth[t.Date.Month().String()]; !ok {
-			transactionCountByMonth[t.Date.Month().String()] = 0
-		}
-
-		transactionCountByMonth[t.Date.Month().String()] = transactionCountByMonth[t.Date.Month().String()] + 1
-	}
-
-	bodyRows := []string{
-		"<html>",
-		`<body style="font-family: Verdana, sans-serif; margin: 0; padding: 0;">`,
-		"<h3>Historical summary</h3>",
-		fmt.Sprintf("<p>Total balance is: %s</p>", creditTotal.Add(debitTotal).String()),
-		fmt.Sprintf("<p>Average debit amount: %s</p>", debitTotal.Add(debitCount).String()),
-		fmt.Sprintf("<p>Average credit amount: %s</p>", creditTotal.Div(creditCount).String()),
-	}
+const dateFormat = "2006-01-02"
 
-	bodyRows = append(bodyRows, "<h4>Monthly summary</h4>")
-	bodyRows = append(bodyRows, "<ul>")
-	for month, count := range transactionCountByMonth {
-		bodyRows = append(bodyRows, fmt.Sprintf("<li>Number of transactions in %s: %d</li>", month, count))
+func stringToDateWithFormat(s, format string) (time.Time, error) {
+	d, err := time.Parse(format, s)
+	if err != nil {
+		return time.Now(), fmt.Errorf("unable to convert %s into date", s)
 	}
-	bodyRows = append(bodyRows, "</ul>")
-
-	bodyRows = append(bodyRows, "<p>You will find the latest processed report attached to this email<p>")
 
-	bodyRows = append(bodyRows, `<hr>`)
-	bodyRows = append(bodyRows, fmt.Sprintf(`<p><img src="%s" alt="logo"><p>`, os.Getenv("EMAIL_LOGO_URL")))
-	bodyRows = append(bodyRows, "</body>")
-	bodyRows = append(bodyRows, "</html>")
-
-	return strings.Join(bodyRows, "")
+	return d, nil
 }
@@ -2,18 +2,23 @@ package converter
 
 import (
 	"fmt"
+	"io"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/shopspring/decimal"
 	"github.com/stretchr/testify/require"
+
+	"github.com/mdcantarini/transaction-processor-api/pkg/model"
 )
 
-func TestCSVRecordsToTransactions_Success(t *testing.T) {
-	records := [][]string{{"1", "2023-12-15", "60.5", "1"}, {"2", "2023-12-16", "-10.3", "2"}}
+func TestCSVTransactionReader_Success(t *testing.T) {
+	content := "Id,Date,Transaction,Account\n1,2023-12-15,60.5,1\n2,2023-12-16,-10.3,2\n"
 
-	transactions, err := CSVRecordsToTransactions(records)
+	transactions, rowErrors, err := readAllTransactions(content, DefaultMappingProfile)
 	require.NoError(t, err)
+	require.Empty(t, rowErrors)
 
 	require.Equal(t, transactions[0].TransactionID, 1)
 	date, err := time.Parse(dateFormat, "2023-12-15")
@@ -30,30 +35,112 @@ func TestCSVRecordsToTransactions_Success(t *testing.T) {
 	require.Equal(t, transactions[1].AccountID, 2)
 }
 
-func TestCSVRecordsToTransactions_ErrorConvertingTransactionID(t *testing.T) {
-	records := [][]string{{"a", "2023-12-15", "60.5", "1"}}
+func TestCSVTransactionReader_ErrorConvertingTransactionID(t *testing.T) {
+	content := "Id,Date,Transaction,Account\na,2023-12-15,60.5,1\n"
+
+	_, rowErrors, err := readAllTransactions(content, DefaultMappingProfile)
+	require.NoError(t, err)
+	require.ErrorContains(t, rowErrors[0], fmt.Sprintf("%s %s", convertingError, "transactionID"))
+}
+
+func TestCSVTransactionReader_ErrorConvertingTransactionDate(t *testing.T) {
+	content := "Id,Date,Transaction,Account\n1,202a-12-15,60.5,1\n"
+
+	_, rowErrors, err := readAllTransactions(content, DefaultMappingProfile)
+	require.NoError(t, err)
+	require.ErrorContains(t, rowErrors[0], fmt.Sprintf("%s %s", convertingError, "date"))
+}
+
+func TestCSVTransactionReader_ErrorConvertingTransactionAmount(t *testing.T) {
+	content := "Id,Date,Transaction,Account\n1,2023-12-15,60.a,1\n"
+
+	_, rowErrors, err := readAllTransactions(content, DefaultMappingProfile)
+	require.NoError(t, err)
+	require.ErrorContains(t, rowErrors[0], fmt.Sprintf("%s %s", convertingError, "transactionAmount"))
+}
+
+func TestCSVTransactionReader_ErrorConvertingAccountID(t *testing.T) {
+	content := "Id,Date,Transaction,Account\n1,2023-12-15,60.5,a\n"
+
+	_, rowErrors, err := readAllTransactions(content, DefaultMappingProfile)
+	require.NoError(t, err)
+	require.ErrorContains(t, rowErrors[0], fmt.Sprintf("%s %s", convertingError, "accountID"))
+}
+
+func TestCSVTransactionReader_CollectsRowErrors(t *testing.T) {
+	content := "Id,Date,Transaction,Account\n" +
+		"1,2023-12-15,60.5,1\n" +
+		"a,2023-12-15,60.a,1\n" +
+		"3,2023-12-17,-10.3,2\n" +
+		"4,2023-12-18\n"
+
+	transactions, rowErrors, err := readAllTransactions(content, DefaultMappingProfile)
+	require.NoError(t, err)
+	require.Len(t, transactions, 2)
+	require.Equal(t, transactions[0].TransactionID, 1)
+	require.Equal(t, transactions[1].TransactionID, 3)
 
-	_, err := CSVRecordsToTransactions(records)
-	require.ErrorContains(t, err, fmt.Sprintf("%s %s", convertingError, "transactionID"))
+	require.Equal(t, []RowError{
+		{Line: 3, Column: "transactionID", Value: "a", Reason: "unable to convert a into int"},
+		{Line: 3, Column: "transactionAmount", Value: "60.a", Reason: "unable to convert 60.a into decimal"},
+		{Line: 5, Column: "record", Value: "4,2023-12-18", Reason: "unexpected number of columns: got 2"},
+	}, rowErrors)
 }
 
-func TestCSVRecordsToTransactions_ErrorConvertingTransactionDate(t *testing.T) {
-	records := [][]string{{"1", "202a-12-15", "60.5", "1"}}
+func TestCSVTransactionReader_LineNumbersWithMultilineFields(t *testing.T) {
+	content := "Id,Date,Transaction,Account,Description\n" +
+		"1,2023-12-15,60.5,1,\"first line\nsecond line\"\n" +
+		"2,2023-12-1a,-10.3,1,\n"
+
+	_, rowErrors, err := readAllTransactions(content, DefaultMappingProfile)
+	require.NoError(t, err)
+	require.Len(t, rowErrors, 1)
+	require.Equal(t, 4, rowErrors[0].Line)
+}
 
-	_, err := CSVRecordsToTransactions(records)
-	require.ErrorContains(t, err, fmt.Sprintf("%s %s", convertingError, "date"))
+func TestCSVTransactionReader_EmptyFile(t *testing.T) {
+	_, _, err := readAllTransactions("", DefaultMappingProfile)
+	require.ErrorIs(t, err, ErrMissingColumns)
 }
 
-func TestCSVRecordsToTransactions_ErrorConvertingTransactionAmount(t *testing.T) {
-	records := [][]string{{"1", "2023-12-15", "60.a", "1"}}
+func TestCSVTransactionReader_CurrencyColumn(t *testing.T) {
+	content := "Id,Date,Transaction,Account,Currency\n1,2023-12-15,60.5,1, eur\n2,2023-12-16,-10.3,2,\n"
 
-	_, err := CSVRecordsToTransactions(records)
-	require.ErrorContains(t, err, fmt.Sprintf("%s %s", convertingError, "transactionAmount"))
+	transactions, rowErrors, err := readAllTransactions(content, DefaultMappingProfile)
+	require.NoError(t, err)
+	require.Empty(t, rowErrors)
+
+	require.Equal(t, "EUR", transactions[0].Currency)
+	// rows without currency take the base currency of their account later on
+	require.Empty(t, transactions[1].Currency)
 }
 
-func TestCSVRecordsToTransactions_ErrorConvertingAccountID(t *testing.T) {
-	records := [][]string{{"1", "2023-12-15", "60.5", "a"}}
+func TestRowErrorCSVRecord(t *testing.T) {
+	rowError := RowError{Line: 3, Column: "date", Value: "202a-12-15", Reason: "unable to convert 202a-12-15 into date"}
+
+	require.Equal(t, []string{"3", "date", "202a-12-15", "unable to convert 202a-12-15 into date"}, rowError.CSVRecord())
+}
+
+// readAllTransactions reads every row of the given CSV content
+func readAllTransactions(content string, profile MappingProfile) ([]model.Transaction, []RowError, error) {
+	reader := NewCSVTransactionReader(strings.NewReader(content), profile)
+
+	var transactions []model.Transaction
+	var rowErrors []RowError
+	for {
+		transaction, errs, err := reader.Read()
+		if err == io.EOF {
+			return transactions, rowErrors, nil
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+
+		if len(errs) > 0 {
+			rowErrors = append(rowErrors, errs...)
+			continue
+		}
 
-	_, err := CSVRecordsToTransactions(records)
-	require.ErrorContains(t, err, fmt.Sprintf("%s %s", convertingError, "accountID"))
+		transactions = append(transactions, transaction)
+	}
 }
@@ -6,12 +6,25 @@ import (
 )
 
 type Account struct {
-	ID    int
-	Email string `gorm:"unique"`
+	ID    int    `json:"id"`
+	Email string `gorm:"unique" json:"email"`
+	// BankAccount is the account number, like an IBAN, used by bank statement files to refer to this account
+	BankAccount *string `gorm:"unique" json:"bank_account"`
+	// BaseCurrency is the ISO 4217 code given to the imported transactions which do not state their currency
+	BaseCurrency string `gorm:"size:3" json:"base_currency"`
 }
 
 type IAccount interface {
 	GetAccount(accountID int) (*Account, error)
+	GetAccountByBankAccount(bankAccount string) (*Account, error)
+	// ListAccounts returns a page of accounts ordered by ID along with the total number of accounts
+	ListAccounts(limit, offset int) ([]Account, int64, error)
+	CreateAccount(account *Account) error
+	UpdateAccount(account *Account) error
+	DeleteAccount(accountID int) error
+	// UpsertAccounts creates the given accounts, matched by email, and fills the base currency of the existing ones
+	// lacking it, like the accounts created before base currencies were introduced. Base currencies already set are
+	// kept, so the ones updated through the API are not overwritten.
 	UpsertAccounts([]Account) error
 }
 
@@ -29,6 +42,68 @@ func (ar AccountRepository) GetAccount(accountID int) (*Account, error) {
 	return &account, nil
 }
 
+func (ar AccountRepository) GetAccountByBankAccount(bankAccount string) (*Account, error) {
+	account := Account{}
+	err := ar.DB.First(&account, "bank_account = ?", bankAccount).Error
+	if err != nil {
+		return nil, err
+	}
+
+	return &account, nil
+}
+
+func (ar AccountRepository) ListAccounts(limit, offset int) ([]Account, int64, error) {
+	var total int64
+	err := ar.DB.Model(&Account{}).Count(&total).Error
+	if err != nil {
+		return nil, 0, err
+	}
+
+	accounts := []Account{}
+	err = ar.DB.Order("id").Limit(limit).Offset(offset).Find(&accounts).Error
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return accounts, total, nil
+}
+
+func (ar AccountRepository) CreateAccount(account *Account) error {
+	return ar.DB.Create(account).Error
+}
+
+// UpdateAccount saves every field of the account, it returns gorm.ErrRecordNotFound when the account does not exist
+func (ar AccountRepository) UpdateAccount(account *Account) error {
+	res := ar.DB.Model(account).Select("*").Updates(account)
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+
+	return nil
+}
+
+// DeleteAccount removes the account, it returns gorm.ErrRecordNotFound when the account does not exist
+func (ar AccountRepository) DeleteAccount(accountID int) error {
+	res := ar.DB.Delete(&Account{}, accountID)
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+
+	return nil
+}
+
 func (ar AccountRepository) UpsertAccounts(accounts []Account) error {
-	return ar.DB.Clauses(clause.OnConflict{DoNothing: true}).Create(&accounts).Error
+	return ar.DB.Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "email"}},
+		DoUpdates: clause.Set{{
+			Column: clause.Column{Name: "base_currency"},
+			Value:  gorm.Expr("COALESCE(NULLIF(accounts.base_currency, ''), excluded.base_currency)"),
+		}},
+	}).Create(&accounts).Error
 }
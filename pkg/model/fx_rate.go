@@ -0,0 +1,61 @@
+package model
+
+import (
+	"time"
+
+	"github.com/shopspring/decimal"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// FXRate is the amount of quote currency bought by one unit of base currency, effective from its date
+// until the next rate of the same pair
+type FXRate struct {
+	ID            int             `json:"-"`
+	BaseCurrency  string          `gorm:"size:3;uniqueIndex:idx_fx_rates_pair_date" json:"base_currency"`
+	QuoteCurrency string          `gorm:"size:3;uniqueIndex:idx_fx_rates_pair_date" json:"quote_currency"`
+	Date          time.Time       `gorm:"type:date;uniqueIndex:idx_fx_rates_pair_date" json:"date"`
+	Rate          decimal.Decimal `gorm:"type:numeric" json:"rate"`
+	// Source names the provider of the rate, like ECB
+	Source string `json:"source"`
+}
+
+// Pair returns the currency pair of the rate, like EUR/USD
+func (r FXRate) Pair() string {
+	return r.BaseCurrency + "/" + r.QuoteCurrency
+}
+
+type IFXRate interface {
+	// UpsertFXRates stores the given rates, replacing the existing rates of the same pair and date
+	UpsertFXRates(rates []FXRate) error
+	// GetEffectiveFXRate returns the latest rate of the pair whose date is not after the given one
+	GetEffectiveFXRate(baseCurrency, quoteCurrency string, date time.Time) (*FXRate, error)
+}
+
+type FXRateRepository struct {
+	DB *gorm.DB
+}
+
+func (fr FXRateRepository) UpsertFXRates(rates []FXRate) error {
+	if len(rates) == 0 {
+		return nil
+	}
+
+	return fr.DB.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "base_currency"}, {Name: "quote_currency"}, {Name: "date"}},
+		DoUpdates: clause.AssignmentColumns([]string{"rate", "source"}),
+	}).Create(&rates).Error
+}
+
+func (fr FXRateRepository) GetEffectiveFXRate(baseCurrency, quoteCurrency string, date time.Time) (*FXRate, error) {
+	rate := FXRate{}
+	err := fr.DB.
+		Where("base_currency = ? AND quote_currency = ? AND date <= ?", baseCurrency, quoteCurrency, date).
+		Order("date desc").
+		First(&rate).Error
+	if err != nil {
+		return nil, err
+	}
+
+	return &rate, nil
+}
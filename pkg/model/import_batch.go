@@ -0,0 +1,90 @@
+package model
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const (
+	ImportBatchStatusProcessing = "processing"
+	ImportBatchStatusCompleted  = "completed"
+	ImportBatchStatusFailed     = "failed"
+)
+
+const (
+	// LoadMethodInsert stores the transactions through batched insert statements
+	LoadMethodInsert = "insert"
+	// LoadMethodCopy stores the transactions through the Postgres COPY protocol, used for large files
+	LoadMethodCopy = "copy"
+)
+
+const (
+	// ImportModeStrict rejects the whole file when any of its rows is invalid
+	ImportModeStrict = "strict"
+	// ImportModeLenient ingests the valid rows and reports the invalid ones
+	ImportModeLenient = "lenient"
+)
+
+// ImportBatch keeps track of every file ingested by the service and the outcome of its rows.
+// Inserted rows are linked to the batch through Transaction.ImportBatchID, duplicates keep
+// pointing to the batch which originally inserted them.
+type ImportBatch struct {
+	ID             string     `gorm:"primaryKey" json:"id"`
+	FileName       string     `json:"file_name"`
+	SHA256         string     `gorm:"index" json:"sha256"`
+	Format         string     `json:"format"`
+	Mode           string     `json:"mode"`
+	MappingProfile string     `json:"mapping_profile"`
+	LoadMethod     string     `json:"load_method"`
+	Status         string     `json:"status"`
+	Error          string     `json:"error,omitempty"`
+	StartedAt      time.Time  `json:"started_at"`
+	FinishedAt     *time.Time `json:"finished_at"`
+	RowCount       int        `json:"row_count"`
+	InsertedCount  int        `json:"inserted_count"`
+	DuplicateCount int        `json:"duplicate_count"`
+	RejectedCount  int        `json:"rejected_count"`
+	// Balances are only reported by statement formats including them
+	Balances []StatementBalance `json:"balances,omitempty"`
+}
+
+type IImportBatch interface {
+	CreateImportBatch(batch *ImportBatch) error
+	UpdateImportBatch(batch *ImportBatch) error
+	GetImportBatch(batchID string) (*ImportBatch, error)
+	ListImportBatches(limit int) ([]ImportBatch, error)
+}
+
+type ImportBatchRepository struct {
+	DB *gorm.DB
+}
+
+func (ibr ImportBatchRepository) CreateImportBatch(batch *ImportBatch) error {
+	return ibr.DB.Create(batch).Error
+}
+
+func (ibr ImportBatchRepository) UpdateImportBatch(batch *ImportBatch) error {
+	return ibr.DB.Save(batch).Error
+}
+
+func (ibr ImportBatchRepository) GetImportBatch(batchID string) (*ImportBatch, error) {
+	batch := ImportBatch{}
+	err := ibr.DB.Preload("Balances").First(&batch, "id = ?", batchID).Error
+	if err != nil {
+		return nil, err
+	}
+
+	return &batch, nil
+}
+
+// ListImportBatches returns the latest import batches, most recent first
+func (ibr ImportBatchRepository) ListImportBatches(limit int) ([]ImportBatch, error) {
+	var batches []ImportBatch
+	err := ibr.DB.Order("started_at desc").Limit(limit).Find(&batches).Error
+	if err != nil {
+		return nil, err
+	}
+
+	return batches, nil
+}
@@ -0,0 +1,190 @@
+package model
+
+import (
+	"sort"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	// OutboxKindDailyReport messages are delivered as the daily report of their account over their import batch
+	OutboxKindDailyReport = "daily_report"
+	// OutboxKindPeriodReport messages are delivered as the report of their definition over their period
+	OutboxKindPeriodReport = "period_report"
+)
+
+const (
+	OutboxStatusPending = "pending"
+	// OutboxStatusSending is the status of the messages claimed by a worker delivering them
+	OutboxStatusSending = "sending"
+	OutboxStatusSent    = "sent"
+	// OutboxStatusDead is the status of the messages which ran out of delivery attempts, they are never retried
+	OutboxStatusDead = "dead"
+)
+
+// OutboxMessage is an email waiting to be delivered by the outbox worker. Messages are enqueued within the
+// database transaction producing them, so they are only delivered once it is committed. Their content is
+// built by the worker according to their kind, so enqueueing them is cheap.
+type OutboxMessage struct {
+	ID            uint      `gorm:"primaryKey" json:"id"`
+	CreatedAt     time.Time `json:"created_at"`
+	UpdatedAt     time.Time `json:"updated_at"`
+	Kind          string    `json:"kind"`
+	ImportBatchID *string   `gorm:"index" json:"import_batch_id"`
+	AccountID     int       `gorm:"uniqueIndex:idx_outbox_messages_period_report,priority:2" json:"account_id"`
+	// ReportDefinitionID, PeriodFrom and PeriodUntil are the report and the dates covered by period reports, the
+	// first date included and the first date excluded. A period report is only enqueued once per account.
+	ReportDefinitionID *uint      `gorm:"uniqueIndex:idx_outbox_messages_period_report,priority:1" json:"report_definition_id,omitempty"`
+	PeriodFrom         *time.Time `gorm:"uniqueIndex:idx_outbox_messages_period_report,priority:3" json:"period_from,omitempty"`
+	PeriodUntil        *time.Time `gorm:"uniqueIndex:idx_outbox_messages_period_report,priority:4" json:"period_until,omitempty"`
+	// Recipient and Subject are set once the content of the message is built
+	Recipient string `json:"recipient"`
+	Subject   string `json:"subject"`
+	Status    string `gorm:"index:idx_outbox_messages_status_next_attempt_at,priority:1" json:"status"`
+	Attempts  int    `json:"attempts"`
+	LastError string `json:"last_error,omitempty"`
+	// NextAttemptAt is the time from which a pending message is delivered
+	NextAttemptAt time.Time `gorm:"index:idx_outbox_messages_status_next_attempt_at,priority:2" json:"next_attempt_at"`
+	// ClaimedAt is the time a sending message was claimed by the worker delivering it
+	ClaimedAt *time.Time `json:"claimed_at,omitempty"`
+	SentAt    *time.Time `json:"sent_at"`
+}
+
+// OutboxFilter narrows the messages returned by ListOutboxMessages, empty fields do not filter
+type OutboxFilter struct {
+	Status        string
+	ImportBatchID *string
+	Limit         int
+}
+
+type IOutbox interface {
+	// EnqueueOutboxMessages stores the given messages, setting their IDs
+	EnqueueOutboxMessages(messages []OutboxMessage) error
+	// EnqueuePeriodReports stores the given period report messages, skipping the ones already enqueued for the
+	// same report definition, account and period. It returns the stored messages along with their IDs.
+	EnqueuePeriodReports(messages []OutboxMessage) ([]OutboxMessage, error)
+	// ClaimDueOutboxMessages marks as sending, claimed at the given time, the pending messages whose next attempt
+	// is not after it, along with the sending messages claimed before staleBefore, and returns them oldest first.
+	// Messages are claimed by a single worker, even across services sharing the database.
+	ClaimDueOutboxMessages(now, staleBefore time.Time, limit int) ([]OutboxMessage, error)
+	// ReleaseOutboxMessages marks the given sending messages as pending again, so they are delivered on the next poll
+	ReleaseOutboxMessages(messageIDs []uint) error
+	// UpdateOutboxMessage stores the delivery status of the message
+	UpdateOutboxMessage(message *OutboxMessage) error
+	ListOutboxMessages(filter OutboxFilter) ([]OutboxMessage, error)
+	GetOutboxMessage(messageID uint) (*OutboxMessage, error)
+}
+
+type OutboxRepository struct {
+	DB *gorm.DB
+}
+
+func (or OutboxRepository) EnqueueOutboxMessages(messages []OutboxMessage) error {
+	if len(messages) == 0 {
+		return nil
+	}
+
+	return or.DB.Create(&messages).Error
+}
+
+func (or OutboxRepository) EnqueuePeriodReports(messages []OutboxMessage) ([]OutboxMessage, error) {
+	enqueued := []OutboxMessage{}
+	// messages are stored one at a time, since the IDs returned by a batch insert skipping conflicts cannot be
+	// matched with the messages
+	err := or.DB.Transaction(func(tx *gorm.DB) error {
+		for _, message := range messages {
+			res := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&message)
+			if res.Error != nil {
+				return res.Error
+			}
+
+			if res.RowsAffected == 1 {
+				enqueued = append(enqueued, message)
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return enqueued, nil
+}
+
+func (or OutboxRepository) ClaimDueOutboxMessages(now, staleBefore time.Time, limit int) ([]OutboxMessage, error) {
+	messages := []OutboxMessage{}
+	// a single statement skipping the rows locked by concurrent claims, so two workers never claim the same message
+	err := or.DB.Raw(`
+		UPDATE outbox_messages SET status = ?, claimed_at = ?, updated_at = ?
+		WHERE id IN (
+			SELECT id FROM outbox_messages
+			WHERE (status = ? AND next_attempt_at <= ?) OR (status = ? AND claimed_at < ?)
+			ORDER BY next_attempt_at, id
+			LIMIT ?
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING *`,
+		OutboxStatusSending, now, now,
+		OutboxStatusPending, now, OutboxStatusSending, staleBefore,
+		limit,
+	).Scan(&messages).Error
+	if err != nil {
+		return nil, err
+	}
+
+	// the rows returned by an update are not ordered
+	sort.Slice(messages, func(i, j int) bool {
+		if !messages[i].NextAttemptAt.Equal(messages[j].NextAttemptAt) {
+			return messages[i].NextAttemptAt.Before(messages[j].NextAttemptAt)
+		}
+
+		return messages[i].ID < messages[j].ID
+	})
+
+	return messages, nil
+}
+
+func (or OutboxRepository) ReleaseOutboxMessages(messageIDs []uint) error {
+	if len(messageIDs) == 0 {
+		return nil
+	}
+
+	return or.DB.Model(&OutboxMessage{}).
+		Where("id IN ? AND status = ?", messageIDs, OutboxStatusSending).
+		Updates(map[string]any{"status": OutboxStatusPending, "claimed_at": nil}).Error
+}
+
+func (or OutboxRepository) UpdateOutboxMessage(message *OutboxMessage) error {
+	return or.DB.Save(message).Error
+}
+
+func (or OutboxRepository) ListOutboxMessages(filter OutboxFilter) ([]OutboxMessage, error) {
+	query := or.DB
+	if filter.Status != "" {
+		query = query.Where("status = ?", filter.Status)
+	}
+	if filter.ImportBatchID != nil {
+		query = query.Where("import_batch_id = ?", *filter.ImportBatchID)
+	}
+
+	messages := []OutboxMessage{}
+	err := query.Order("id desc").Limit(filter.Limit).Find(&messages).Error
+	if err != nil {
+		return nil, err
+	}
+
+	return messages, nil
+}
+
+func (or OutboxRepository) GetOutboxMessage(messageID uint) (*OutboxMessage, error) {
+	message := OutboxMessage{}
+	err := or.DB.First(&message, messageID).Error
+	if err != nil {
+		return nil, err
+	}
+
+	return &message, nil
+}
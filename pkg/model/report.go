@@ -0,0 +1,108 @@
+package model
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	ReportPeriodDaily   = "daily"
+	ReportPeriodWeekly  = "weekly"
+	ReportPeriodMonthly = "monthly"
+	// ReportPeriodCustom reports always cover the date range of their definition
+	ReportPeriodCustom = "custom"
+)
+
+// ReportDefinition describes a periodic report, like a monthly statement, sent to the accounts subscribed to it
+type ReportDefinition struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+	Name      string    `gorm:"unique" json:"name"`
+	Period    string    `json:"period"`
+	// From and To are the inclusive dates covered by custom reports
+	From *time.Time `json:"from,omitempty"`
+	To   *time.Time `json:"to,omitempty"`
+}
+
+// ReportSubscription subscribes an account to a report definition, subscriptions are removed along with their
+// account or definition
+type ReportSubscription struct {
+	ReportDefinitionID uint             `gorm:"primaryKey" json:"report_definition_id"`
+	ReportDefinition   ReportDefinition `gorm:"constraint:OnDelete:CASCADE" json:"-"`
+	AccountID          int              `gorm:"primaryKey" json:"account_id"`
+	Account            Account          `gorm:"constraint:OnDelete:CASCADE" json:"-"`
+	CreatedAt          time.Time        `json:"created_at"`
+}
+
+type IReport interface {
+	CreateReportDefinition(definition *ReportDefinition) error
+	ListReportDefinitions() ([]ReportDefinition, error)
+	GetReportDefinition(definitionID uint) (*ReportDefinition, error)
+	// Subscribe subscribes the account to the report definition, subscribing it again does nothing
+	Subscribe(definitionID uint, accountID int) error
+	// Unsubscribe removes the subscription, it returns gorm.ErrRecordNotFound when the account is not subscribed
+	Unsubscribe(definitionID uint, accountID int) error
+	// ListSubscribedAccountIDs returns the IDs of the accounts subscribed to the report definition, ordered
+	ListSubscribedAccountIDs(definitionID uint) ([]int, error)
+}
+
+type ReportRepository struct {
+	DB *gorm.DB
+}
+
+func (rr ReportRepository) CreateReportDefinition(definition *ReportDefinition) error {
+	return rr.DB.Create(definition).Error
+}
+
+func (rr ReportRepository) ListReportDefinitions() ([]ReportDefinition, error) {
+	definitions := []ReportDefinition{}
+	err := rr.DB.Order("id").Find(&definitions).Error
+	if err != nil {
+		return nil, err
+	}
+
+	return definitions, nil
+}
+
+func (rr ReportRepository) GetReportDefinition(definitionID uint) (*ReportDefinition, error) {
+	definition := ReportDefinition{}
+	err := rr.DB.First(&definition, definitionID).Error
+	if err != nil {
+		return nil, err
+	}
+
+	return &definition, nil
+}
+
+func (rr ReportRepository) Subscribe(definitionID uint, accountID int) error {
+	subscription := ReportSubscription{ReportDefinitionID: definitionID, AccountID: accountID}
+	return rr.DB.Omit(clause.Associations).Clauses(clause.OnConflict{DoNothing: true}).Create(&subscription).Error
+}
+
+func (rr ReportRepository) Unsubscribe(definitionID uint, accountID int) error {
+	res := rr.DB.Delete(&ReportSubscription{}, "report_definition_id = ? AND account_id = ?", definitionID, accountID)
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+
+	return nil
+}
+
+func (rr ReportRepository) ListSubscribedAccountIDs(definitionID uint) ([]int, error) {
+	accountIDs := []int{}
+	err := rr.DB.Model(&ReportSubscription{}).
+		Where("report_definition_id = ?", definitionID).
+		Order("account_id").
+		Pluck("account_id", &accountIDs).Error
+	if err != nil {
+		return nil, err
+	}
+
+	return accountIDs, nil
+}
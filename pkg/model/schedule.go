@@ -0,0 +1,102 @@
+package model
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	// ScheduleTargetDailyReport schedules import the transactions file and enqueue the daily reports
+	ScheduleTargetDailyReport = "daily_report"
+	// ScheduleTargetReport schedules run their report definition
+	ScheduleTargetReport = "report"
+)
+
+// Schedule runs its target on every activation of its cron expression, evaluated in its timezone
+type Schedule struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+	Name      string    `gorm:"unique" json:"name"`
+	Cron      string    `json:"cron"`
+	Timezone  string    `json:"timezone"`
+	Target    string    `json:"target"`
+	// ReportDefinitionID is the report run by report schedules, which are removed along with it
+	ReportDefinitionID *uint             `json:"report_definition_id,omitempty"`
+	ReportDefinition   *ReportDefinition `gorm:"constraint:OnDelete:CASCADE" json:"-"`
+	LastRunAt          *time.Time        `json:"last_run_at"`
+	// NextRunAt is the next activation to run, it stays in the past until the runs missed while the service was
+	// down are caught up
+	NextRunAt time.Time `gorm:"index" json:"next_run_at"`
+	// RunningSince is set while the schedule is claimed by a run, so runs of the same schedule never overlap
+	RunningSince *time.Time `json:"running_since,omitempty"`
+	LastError    string     `json:"last_error,omitempty"`
+}
+
+type ISchedule interface {
+	CreateSchedule(schedule *Schedule) error
+	ListSchedules() ([]Schedule, error)
+	// ListDueSchedules returns the schedules whose next run is not after the given time, oldest first
+	ListDueSchedules(now time.Time) ([]Schedule, error)
+	// ClaimSchedule marks the schedule as running since the given time, unless it is already running since
+	// staleBefore or later. It reports whether the schedule was claimed.
+	ClaimSchedule(scheduleID uint, now, staleBefore time.Time) (bool, error)
+	// RenewScheduleClaim marks the claimed schedule as running since the given time, so its claim does not time out
+	RenewScheduleClaim(scheduleID uint, now time.Time) error
+	// UpdateScheduleRun stores the last and next runs, last error and claim of the schedule
+	UpdateScheduleRun(schedule *Schedule) error
+}
+
+type ScheduleRepository struct {
+	DB *gorm.DB
+}
+
+func (sr ScheduleRepository) CreateSchedule(schedule *Schedule) error {
+	return sr.DB.Omit(clause.Associations).Create(schedule).Error
+}
+
+func (sr ScheduleRepository) ListSchedules() ([]Schedule, error) {
+	schedules := []Schedule{}
+	err := sr.DB.Order("id").Find(&schedules).Error
+	if err != nil {
+		return nil, err
+	}
+
+	return schedules, nil
+}
+
+func (sr ScheduleRepository) ListDueSchedules(now time.Time) ([]Schedule, error) {
+	schedules := []Schedule{}
+	err := sr.DB.Where("next_run_at <= ?", now).Order("next_run_at, id").Find(&schedules).Error
+	if err != nil {
+		return nil, err
+	}
+
+	return schedules, nil
+}
+
+func (sr ScheduleRepository) ClaimSchedule(scheduleID uint, now, staleBefore time.Time) (bool, error) {
+	// a single statement, so two services never claim the same schedule
+	res := sr.DB.Model(&Schedule{}).
+		Where("id = ? AND (running_since IS NULL OR running_since < ?)", scheduleID, staleBefore).
+		Update("running_since", now)
+	if res.Error != nil {
+		return false, res.Error
+	}
+
+	return res.RowsAffected == 1, nil
+}
+
+func (sr ScheduleRepository) RenewScheduleClaim(scheduleID uint, now time.Time) error {
+	return sr.DB.Model(&Schedule{}).
+		Where("id = ? AND running_since IS NOT NULL", scheduleID).
+		Update("running_since", now).Error
+}
+
+func (sr ScheduleRepository) UpdateScheduleRun(schedule *Schedule) error {
+	return sr.DB.Model(schedule).
+		Select("LastRunAt", "NextRunAt", "RunningSince", "LastError").
+		Updates(schedule).Error
+}
@@ -0,0 +1,21 @@
+package model
+
+import (
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+// StatementBalance holds the balances reported by a bank statement, like an MT940 file,
+// for one of the bank accounts included in an import batch
+type StatementBalance struct {
+	ID             int             `json:"-"`
+	ImportBatchID  string          `gorm:"index" json:"-"`
+	Reference      string          `json:"reference"`
+	BankAccount    string          `json:"bank_account"`
+	Currency       string          `json:"currency"`
+	OpeningDate    time.Time       `json:"opening_date"`
+	OpeningBalance decimal.Decimal `gorm:"type:numeric" json:"opening_balance"`
+	ClosingDate    time.Time       `json:"closing_date"`
+	ClosingBalance decimal.Decimal `gorm:"type:numeric" json:"closing_balance"`
+}
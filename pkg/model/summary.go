@@ -0,0 +1,81 @@
+package model
+
+import (
+	"time"
+
+	"github.com/shopspring/decimal"
+	"gorm.io/gorm"
+)
+
+// SummaryFilter selects the transactions of an account aggregated by SummarizeTransactions
+type SummaryFilter struct {
+	AccountID int
+	// From is the first date included, Until is the first date excluded
+	From  *time.Time
+	Until *time.Time
+	// ImportBatchID restricts the summary to the transactions inserted by an import batch
+	ImportBatchID *string
+}
+
+// CurrencySummary aggregates the transactions of an account in a single currency
+type CurrencySummary struct {
+	Currency      string          `json:"currency"`
+	Balance       decimal.Decimal `json:"balance"`
+	CreditTotal   decimal.Decimal `json:"credit_total"`
+	CreditCount   int64           `json:"credit_count"`
+	DebitTotal    decimal.Decimal `json:"debit_total"`
+	DebitCount    int64           `json:"debit_count"`
+	AverageCredit decimal.Decimal `json:"average_credit"`
+	AverageDebit  decimal.Decimal `json:"average_debit"`
+	// ConvertedBalance is the balance in the base currency of the account, if it has one
+	ConvertedBalance *decimal.Decimal `json:"converted_balance,omitempty"`
+}
+
+// MonthlySummary aggregates the transactions of a calendar month, formatted like 2023-12, in a single currency
+type MonthlySummary struct {
+	Month       string          `json:"month"`
+	Currency    string          `json:"currency"`
+	CreditTotal decimal.Decimal `json:"credit_total"`
+	DebitTotal  decimal.Decimal `json:"debit_total"`
+	// Net is the sum of the credit and debit totals
+	Net   decimal.Decimal `json:"net"`
+	Count int64           `json:"count"`
+}
+
+// DailyTotal is the sum of the amounts in a currency on a single date
+type DailyTotal struct {
+	Currency string
+	Date     time.Time
+	Total    decimal.Decimal
+}
+
+// AccountSummary holds the statistics of the transactions of an account
+type AccountSummary struct {
+	AccountID        int    `json:"account_id"`
+	TransactionCount int64  `json:"transaction_count"`
+	BaseCurrency     string `json:"base_currency,omitempty"`
+	// ConvertedBalance is the balance of every currency converted into the base currency
+	ConvertedBalance *decimal.Decimal  `json:"converted_balance,omitempty"`
+	Currencies       []CurrencySummary `json:"currencies"`
+	// Months are ordered chronologically, then by currency
+	Months []MonthlySummary `json:"months"`
+	// DailyTotals allow converting the balances with the rate effective on every date
+	DailyTotals []DailyTotal `json:"-"`
+}
+
+func summaryScope(filter SummaryFilter) func(db *gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		db = db.Where("account_id = ?", filter.AccountID)
+		if filter.From != nil {
+			db = db.Where("date >= ?", *filter.From)
+		}
+		if filter.Until != nil {
+			db = db.Where("date < ?", *filter.Until)
+		}
+		if filter.ImportBatchID != nil {
+			db = db.Where("import_batch_id = ?", *filter.ImportBatchID)
+		}
+
+		return db
+	}
+}
@@ -1,30 +1,322 @@
 package model
 
 import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
 	"time"
 
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/jackc/pgx/v5/stdlib"
 	"github.com/shopspring/decimal"
 	"gorm.io/gorm"
 	"gorm.io/gorm/clause"
 )
 
 type Transaction struct {
-	gorm.Model
-	TransactionID     int `gorm:"unique"`
-	Date              time.Time
-	TransactionAmount decimal.Decimal
-	AccountID         int
-	Account           Account
+	gorm.Model    `json:"-"`
+	TransactionID int `gorm:"unique;index:idx_transactions_date_transaction_id,priority:2" json:"transaction_id"`
+	// ExternalID is the reference given to the transaction by the bank statement it was imported from
+	ExternalID string `json:"external_id,omitempty"`
+	// Description is the narrative given to the transaction by the bank statement it was imported from
+	Description       string          `json:"description,omitempty"`
+	Date              time.Time       `gorm:"index:idx_transactions_date_transaction_id,priority:1" json:"date"`
+	TransactionAmount decimal.Decimal `gorm:"type:numeric" json:"transaction_amount"`
+	Currency          string          `json:"currency"`
+	AccountID         int             `json:"account_id"`
+	Account           Account         `json:"-"`
+	ImportBatchID     *string         `json:"import_batch_id"`
+	ImportBatch       *ImportBatch    `json:"-"`
 }
 
 type ITransaction interface {
-	UpsertTransactions(transactions []Transaction) error
+	// UpsertTransactions stores the given transactions skipping the already existing ones.
+	// It returns the number of inserted transactions.
+	UpsertTransactions(transactions []Transaction) (int, error)
+	// BulkLoadTransactions behaves like UpsertTransactions, but it is meant for large amounts of transactions
+	BulkLoadTransactions(transactions []Transaction) (int, error)
+	// RunInDBTransaction runs fn within a database transaction, which is rolled back when fn fails.
+	// The repository received by fn must be used for every operation belonging to the transaction.
+	RunInDBTransaction(fn func(repo ITransaction) error) error
+	// OutboxRepo returns the outbox repository sharing the database, or the database transaction, of the
+	// repository, so messages can be enqueued within the transaction producing them
+	OutboxRepo() IOutbox
+	// ListTransactions returns the transactions matching the filter ordered by date and transaction ID
+	ListTransactions(filter TransactionFilter) ([]Transaction, error)
+	GetTransaction(transactionID int) (*Transaction, error)
+	// ListImportedAccountIDs returns the accounts of the transactions inserted by the import batch, in order
+	ListImportedAccountIDs(importBatchID string) ([]int, error)
+	// LatestImportBatchID returns the last import batch which inserted transactions of the account, started before
+	// until when it is given, or gorm.ErrRecordNotFound when none did
+	LatestImportBatchID(accountID int, until *time.Time) (string, error)
+	SummarizeTransactions(filter SummaryFilter) (*AccountSummary, error)
+}
+
+const (
+	SignCredit = "credit"
+	SignDebit  = "debit"
+)
+
+// TransactionCursor is the position of a transaction within the transactions ordered by date and transaction ID
+type TransactionCursor struct {
+	Date          time.Time
+	TransactionID int
+}
+
+// TransactionFilter narrows the transactions returned by ListTransactions, nil and empty fields do not filter
+type TransactionFilter struct {
+	AccountID *int
+	// From is the first date included, Until is the first date excluded
+	From  *time.Time
+	Until *time.Time
+	// MinAmount and MaxAmount are inclusive bounds of the signed amount
+	MinAmount *decimal.Decimal
+	MaxAmount *decimal.Decimal
+	// Sign is either SignCredit, for positive amounts, or SignDebit for the rest of them
+	Sign string
+	// ImportBatchID restricts the transactions to the ones inserted by the import batch
+	ImportBatchID *string
+	// After is the position of the last transaction already read, only the following ones are returned
+	After *TransactionCursor
+	Limit int
 }
 
 type TransactionRepository struct {
 	DB *gorm.DB
+	// conn is the connection running the database transaction started by RunInDBTransaction,
+	// the COPY protocol is only available through it
+	conn *sql.Conn
 }
 
-func (tr TransactionRepository) UpsertTransactions(transactions []Transaction) error {
-	return tr.DB.Clauses(clause.OnConflict{DoNothing: true}).Create(&transactions).Error
+func (tr TransactionRepository) UpsertTransactions(transactions []Transaction) (int, error) {
+	if len(transactions) == 0 {
+		return 0, nil
+	}
+
+	// conflicting rows are skipped, so the affected rows are the inserted ones
+	res := tr.DB.Omit(clause.Associations).Clauses(clause.OnConflict{DoNothing: true}).Create(&transactions)
+	if res.Error != nil {
+		return 0, res.Error
+	}
+
+	return int(res.RowsAffected), nil
+}
+
+const stagingTable = "transactions_staging"
+
+// stagingColumns are the columns loaded through the COPY protocol, the rest of them take their default values
+var stagingColumns = []string{"created_at", "updated_at", "transaction_id", "external_id", "description", "date", "transaction_amount", "currency", "account_id", "import_batch_id"}
+
+// BulkLoadTransactions copies the transactions into a staging table using the COPY protocol, then merges them
+// into the transactions table skipping the already existing ones, just like UpsertTransactions does.
+// It returns the number of inserted transactions.
+func (tr TransactionRepository) BulkLoadTransactions(transactions []Transaction) (int, error) {
+	if len(transactions) == 0 {
+		return 0, nil
+	}
+
+	// the staging table only lives within a database transaction
+	if tr.conn == nil {
+		inserted := 0
+		err := tr.RunInDBTransaction(func(repo ITransaction) error {
+			var err error
+			inserted, err = repo.BulkLoadTransactions(transactions)
+			return err
+		})
+
+		return inserted, err
+	}
+
+	columns := strings.Join(stagingColumns, ", ")
+	err := tr.DB.Exec(fmt.Sprintf(
+		"CREATE TEMP TABLE IF NOT EXISTS %s ON COMMIT DROP AS SELECT %s FROM transactions WITH NO DATA",
+		stagingTable, columns,
+	)).Error
+	if err != nil {
+		return 0, err
+	}
+
+	// the staging table is reused by every call within the same database transaction
+	err = tr.DB.Exec(fmt.Sprintf("TRUNCATE %s", stagingTable)).Error
+	if err != nil {
+		return 0, err
+	}
+
+	now := time.Now()
+	err = tr.conn.Raw(func(driverConn any) error {
+		pgxConn := driverConn.(*stdlib.Conn).Conn()
+		_, err := pgxConn.CopyFrom(context.Background(), pgx.Identifier{stagingTable}, stagingColumns, pgx.CopyFromSlice(len(transactions), func(i int) ([]any, error) {
+			t := transactions[i]
+			// the binary COPY format needs the amount as a numeric value rather than as text
+			amount := pgtype.Numeric{Int: t.TransactionAmount.Coefficient(), Exp: t.TransactionAmount.Exponent(), Valid: true}
+			return []any{now, now, t.TransactionID, t.ExternalID, t.Description, t.Date, amount, t.Currency, t.AccountID, t.ImportBatchID}, nil
+		}))
+
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	// conflicting rows are skipped, so the affected rows are the inserted ones
+	res := tr.DB.Exec(fmt.Sprintf(
+		"INSERT INTO transactions (%s) SELECT %s FROM %s ON CONFLICT DO NOTHING",
+		columns, columns, stagingTable,
+	))
+	if res.Error != nil {
+		return 0, res.Error
+	}
+
+	return int(res.RowsAffected), nil
+}
+
+func (tr TransactionRepository) ListTransactions(filter TransactionFilter) ([]Transaction, error) {
+	query := tr.DB.Model(&Transaction{})
+	if filter.AccountID != nil {
+		query = query.Where("account_id = ?", *filter.AccountID)
+	}
+	if filter.From != nil {
+		query = query.Where("date >= ?", *filter.From)
+	}
+	if filter.Until != nil {
+		query = query.Where("date < ?", *filter.Until)
+	}
+	if filter.MinAmount != nil {
+		query = query.Where("transaction_amount >= ?", *filter.MinAmount)
+	}
+	if filter.MaxAmount != nil {
+		query = query.Where("transaction_amount <= ?", *filter.MaxAmount)
+	}
+
+	if filter.ImportBatchID != nil {
+		query = query.Where("import_batch_id = ?", *filter.ImportBatchID)
+	}
+
+	switch filter.Sign {
+	case SignCredit:
+		query = query.Where("transaction_amount > 0")
+	case SignDebit:
+		query = query.Where("transaction_amount <= 0")
+	}
+
+	// the row comparison matches the ordering, so pages neither skip nor repeat transactions sharing a date
+	if filter.After != nil {
+		query = query.Where("(date, transaction_id) > (?, ?)", filter.After.Date, filter.After.TransactionID)
+	}
+
+	transactions := []Transaction{}
+	err := query.Order("date, transaction_id").Limit(filter.Limit).Find(&transactions).Error
+	if err != nil {
+		return nil, err
+	}
+
+	return transactions, nil
+}
+
+func (tr TransactionRepository) GetTransaction(transactionID int) (*Transaction, error) {
+	transaction := Transaction{}
+	err := tr.DB.First(&transaction, "transaction_id = ?", transactionID).Error
+	if err != nil {
+		return nil, err
+	}
+
+	return &transaction, nil
+}
+
+func (tr TransactionRepository) ListImportedAccountIDs(importBatchID string) ([]int, error) {
+	accountIDs := []int{}
+	err := tr.DB.Model(&Transaction{}).
+		Where("import_batch_id = ?", importBatchID).
+		Distinct("account_id").
+		Order("account_id").
+		Pluck("account_id", &accountIDs).Error
+	if err != nil {
+		return nil, err
+	}
+
+	return accountIDs, nil
+}
+
+func (tr TransactionRepository) LatestImportBatchID(accountID int, until *time.Time) (string, error) {
+	query := tr.DB.Select("transactions.import_batch_id").
+		Joins("JOIN import_batches ON import_batches.id = transactions.import_batch_id").
+		Where("transactions.account_id = ?", accountID)
+
+	if until != nil {
+		query = query.Where("import_batches.started_at < ?", *until)
+	}
+
+	transaction := Transaction{}
+	err := query.Order("import_batches.started_at DESC, transactions.id DESC").
+		Take(&transaction).Error
+	if err != nil {
+		return "", err
+	}
+
+	return *transaction.ImportBatchID, nil
+}
+
+// SummarizeTransactions aggregates the transactions matching the filter within the database, so the size of the
+// history does not matter. Balances and averages are left to be completed from the totals and counts.
+func (tr TransactionRepository) SummarizeTransactions(filter SummaryFilter) (*AccountSummary, error) {
+	summary := &AccountSummary{AccountID: filter.AccountID, Currencies: []CurrencySummary{}, Months: []MonthlySummary{}}
+
+	err := tr.DB.Model(&Transaction{}).Scopes(summaryScope(filter)).
+		Select(`currency,
+			COALESCE(SUM(transaction_amount) FILTER (WHERE transaction_amount > 0), 0) AS credit_total,
+			COUNT(*) FILTER (WHERE transaction_amount > 0) AS credit_count,
+			COALESCE(SUM(transaction_amount) FILTER (WHERE transaction_amount <= 0), 0) AS debit_total,
+			COUNT(*) FILTER (WHERE transaction_amount <= 0) AS debit_count`).
+		Group("currency").
+		Order("currency").
+		Scan(&summary.Currencies).Error
+	if err != nil {
+		return nil, err
+	}
+
+	// dates are stored at midnight UTC, so months are taken in UTC whatever the time zone of the session
+	month := `to_char(date AT TIME ZONE 'UTC', 'YYYY-MM')`
+	err = tr.DB.Model(&Transaction{}).Scopes(summaryScope(filter)).
+		Select(month + ` AS month, currency,
+			COALESCE(SUM(transaction_amount) FILTER (WHERE transaction_amount > 0), 0) AS credit_total,
+			COALESCE(SUM(transaction_amount) FILTER (WHERE transaction_amount <= 0), 0) AS debit_total,
+			COUNT(*) AS count`).
+		Group(month + ", currency").
+		Order("month, currency").
+		Scan(&summary.Months).Error
+	if err != nil {
+		return nil, err
+	}
+
+	err = tr.DB.Model(&Transaction{}).Scopes(summaryScope(filter)).
+		Select("currency, date, SUM(transaction_amount) AS total").
+		Group("currency, date").
+		Order("date, currency").
+		Scan(&summary.DailyTotals).Error
+	if err != nil {
+		return nil, err
+	}
+
+	return summary, nil
+}
+
+func (tr TransactionRepository) OutboxRepo() IOutbox {
+	return OutboxRepository{DB: tr.DB}
+}
+
+// RunInDBTransaction pins a connection for the whole database transaction, so operations like
+// BulkLoadTransactions can reach the driver connection running it
+func (tr TransactionRepository) RunInDBTransaction(fn func(repo ITransaction) error) error {
+	return tr.DB.Connection(func(connDB *gorm.DB) error {
+		conn, ok := connDB.Statement.ConnPool.(*sql.Conn)
+		if !ok {
+			return fmt.Errorf("unexpected connection type %T", connDB.Statement.ConnPool)
+		}
+
+		return connDB.Transaction(func(tx *gorm.DB) error {
+			return fn(TransactionRepository{DB: tx, conn: conn})
+		})
+	})
 }
@@ -0,0 +1,217 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/mail"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"github.com/mdcantarini/transaction-processor-api/pkg/converter"
+	"github.com/mdcantarini/transaction-processor-api/pkg/model"
+)
+
+const defaultAccountsLimit = 50
+
+// AccountsPage is a page of the accounts list
+type AccountsPage struct {
+	Accounts []model.Account `json:"accounts"`
+	Total    int64           `json:"total"`
+	Limit    int             `json:"limit"`
+	Offset   int             `json:"offset"`
+}
+
+// AccountRequest holds the fields of an account sent to create or update it,
+// fields left out of an update keep their value
+type AccountRequest struct {
+	Email        *string `json:"email"`
+	BankAccount  *string `json:"bank_account"`
+	BaseCurrency *string `json:"base_currency"`
+}
+
+// apply sets the fields of the request into the account, validating them
+func (ar AccountRequest) apply(account *model.Account) error {
+	if ar.Email != nil {
+		address, err := mail.ParseAddress(*ar.Email)
+		// display names like "John <john@doe.com>" are not valid account emails
+		if err != nil || address.Address != *ar.Email {
+			return fmt.Errorf("invalid email %s", *ar.Email)
+		}
+
+		account.Email = *ar.Email
+	}
+
+	if ar.BankAccount != nil {
+		bankAccount := strings.TrimSpace(*ar.BankAccount)
+		account.BankAccount = &bankAccount
+		// an empty bank account unlinks the account from bank statement files
+		if bankAccount == "" {
+			account.BankAccount = nil
+		}
+	}
+
+	if ar.BaseCurrency != nil {
+		baseCurrency := converter.NormalizeCurrency(*ar.BaseCurrency)
+		if _, err := converter.CurrencyMinorUnits(baseCurrency); err != nil {
+			return err
+		}
+
+		account.BaseCurrency = baseCurrency
+	}
+
+	if account.Email == "" {
+		return fmt.Errorf("email is required")
+	}
+
+	return nil
+}
+
+func (s *Service) ListAccounts(c *gin.Context) {
+	limit := defaultAccountsLimit
+	if c.Query("limit") != "" {
+		l, err := strconv.Atoi(c.Query("limit"))
+		if err != nil || l <= 0 {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("%s: %s", invalidLimitErr, c.Query("limit"))})
+			return
+		}
+
+		limit = l
+	}
+
+	offset := 0
+	if c.Query("offset") != "" {
+		o, err := strconv.Atoi(c.Query("offset"))
+		if err != nil || o < 0 {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("%s: %s", invalidOffsetErr, c.Query("offset"))})
+			return
+		}
+
+		offset = o
+	}
+
+	accounts, total, err := s.AccountRepo().ListAccounts(limit, offset)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("%s: %s", fetchAccountErr, err.Error())})
+		return
+	}
+
+	c.JSON(http.StatusOK, AccountsPage{Accounts: accounts, Total: total, Limit: limit, Offset: offset})
+}
+
+func (s *Service) GetAccount(c *gin.Context) {
+	account, ok := s.accountFromPath(c)
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, account)
+}
+
+func (s *Service) CreateAccount(c *gin.Context) {
+	var request AccountRequest
+	err := c.ShouldBindJSON(&request)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("%s: %s", invalidAccountErr, err.Error())})
+		return
+	}
+
+	account := &model.Account{}
+	err = request.apply(account)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("%s: %s", invalidAccountErr, err.Error())})
+		return
+	}
+
+	err = s.AccountRepo().CreateAccount(account)
+	if err != nil {
+		abortWithAccountStoreError(c, createAccountErr, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, account)
+}
+
+func (s *Service) UpdateAccount(c *gin.Context) {
+	account, ok := s.accountFromPath(c)
+	if !ok {
+		return
+	}
+
+	var request AccountRequest
+	err := c.ShouldBindJSON(&request)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("%s: %s", invalidAccountErr, err.Error())})
+		return
+	}
+
+	err = request.apply(account)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("%s: %s", invalidAccountErr, err.Error())})
+		return
+	}
+
+	err = s.AccountRepo().UpdateAccount(account)
+	if err != nil {
+		abortWithAccountStoreError(c, updateAccountErr, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, account)
+}
+
+func (s *Service) DeleteAccount(c *gin.Context) {
+	accountID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": accountNotFoundErr})
+		return
+	}
+
+	err = s.AccountRepo().DeleteAccount(accountID)
+	if err != nil {
+		abortWithAccountStoreError(c, deleteAccountErr, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// accountFromPath fetches the account identified by the id path parameter, aborting the request when
+// it cannot be found
+func (s *Service) accountFromPath(c *gin.Context) (*model.Account, bool) {
+	accountID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": accountNotFoundErr})
+		return nil, false
+	}
+
+	account, err := s.AccountRepo().GetAccount(accountID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": accountNotFoundErr})
+			return nil, false
+		}
+
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("%s: %s", fetchAccountErr, err.Error())})
+		return nil, false
+	}
+
+	return account, true
+}
+
+// abortWithAccountStoreError maps the errors returned while storing an account into response statuses
+func abortWithAccountStoreError(c *gin.Context, message string, err error) {
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": accountNotFoundErr})
+	case errors.Is(err, gorm.ErrDuplicatedKey):
+		c.AbortWithStatusJSON(http.StatusConflict, gin.H{"error": fmt.Sprintf("%s: %s", message, accountConflictErr)})
+	case errors.Is(err, gorm.ErrForeignKeyViolated):
+		c.AbortWithStatusJSON(http.StatusConflict, gin.H{"error": fmt.Sprintf("%s: %s", message, accountInUseErr)})
+	default:
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("%s: %s", message, err.Error())})
+	}
+}
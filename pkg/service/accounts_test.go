@@ -0,0 +1,221 @@
+package service
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+
+	"github.com/mdcantarini/transaction-processor-api/pkg/model"
+)
+
+func TestListAccounts_Success(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	// mock account repo
+	mockAccountRepo := new(MockAccountRepo)
+	mockAccountRepo.On("ListAccounts", 10, 20).
+		Return([]model.Account{{ID: 21, Email: "test@email.com", BaseCurrency: "EUR"}}, int64(21), nil).
+		Times(1)
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodGet, "/accounts?limit=10&offset=20", nil)
+
+	service := &Service{accountRepo: mockAccountRepo}
+	service.ListAccounts(c)
+
+	require.Equal(t, http.StatusOK, w.Code)
+	require.JSONEq(t, `{
+		"accounts": [{"id": 21, "email": "test@email.com", "bank_account": null, "base_currency": "EUR"}],
+		"total": 21,
+		"limit": 10,
+		"offset": 20
+	}`, w.Body.String())
+}
+
+func TestListAccounts_InvalidOffset(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodGet, "/accounts?offset=-1", nil)
+
+	service := &Service{}
+	service.ListAccounts(c)
+
+	require.Equal(t, http.StatusBadRequest, w.Code)
+	require.Contains(t, w.Body.String(), invalidOffsetErr)
+}
+
+func TestCreateAccount_Success(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	// mock account repo
+	mockAccountRepo := new(MockAccountRepo)
+	mockAccountRepo.On("CreateAccount", mock.MatchedBy(func(account *model.Account) bool {
+		return account.Email == "test@email.com" && *account.BankAccount == "DE89370400440532013000" && account.BaseCurrency == "EUR"
+	})).
+		Run(func(args mock.Arguments) {
+			args.Get(0).(*model.Account).ID = 2
+		}).
+		Return(nil).
+		Times(1)
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = newJSONRequest(http.MethodPost, "/accounts", `{"email": "test@email.com", "bank_account": "DE89370400440532013000", "base_currency": "eur"}`)
+
+	service := &Service{accountRepo: mockAccountRepo}
+	service.CreateAccount(c)
+
+	require.Equal(t, http.StatusCreated, w.Code)
+	require.Contains(t, w.Body.String(), `"id":2`)
+	mockAccountRepo.AssertExpectations(t)
+}
+
+func TestCreateAccount_InvalidFields(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	for body, expected := range map[string]string{
+		`{"email": "not an email"}`:                           "invalid email not an email",
+		`{"email": "John <john@doe.com>"}`:                    "invalid email John",
+		`{"bank_account": "DE89370400440532013000"}`:          "email is required",
+		`{"email": "test@email.com", "base_currency": 1}`:     "cannot unmarshal number",
+		`{"email": "test@email.com", "base_currency": "ABC"}`: "unknown currency ABC",
+	} {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = newJSONRequest(http.MethodPost, "/accounts", body)
+
+		service := &Service{accountRepo: new(MockAccountRepo)}
+		service.CreateAccount(c)
+
+		require.Equal(t, http.StatusBadRequest, w.Code)
+		require.Contains(t, w.Body.String(), invalidAccountErr)
+		require.Contains(t, w.Body.String(), expected)
+	}
+}
+
+func TestCreateAccount_DuplicatedEmail(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	// mock account repo, the email is already in use
+	mockAccountRepo := new(MockAccountRepo)
+	mockAccountRepo.On("CreateAccount", mock.Anything).
+		Return(gorm.ErrDuplicatedKey).
+		Times(1)
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = newJSONRequest(http.MethodPost, "/accounts", `{"email": "test@email.com"}`)
+
+	service := &Service{accountRepo: mockAccountRepo}
+	service.CreateAccount(c)
+
+	require.Equal(t, http.StatusConflict, w.Code)
+	require.Contains(t, w.Body.String(), accountConflictErr)
+}
+
+func TestUpdateAccount_Success(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	bankAccount := "DE89370400440532013000"
+
+	// mock account repo, fields left out of the request keep their value
+	mockAccountRepo := new(MockAccountRepo)
+	mockAccountRepo.On("GetAccount", 1).
+		Return(&model.Account{ID: 1, Email: "test@email.com", BankAccount: &bankAccount, BaseCurrency: "EUR"}, nil).
+		Times(1)
+	mockAccountRepo.On("UpdateAccount", mock.MatchedBy(func(account *model.Account) bool {
+		return account.Email == "test@email.com" && account.BankAccount == nil && account.BaseCurrency == "USD"
+	})).
+		Return(nil).
+		Times(1)
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = newJSONRequest(http.MethodPatch, "/accounts/1", `{"bank_account": "", "base_currency": "USD"}`)
+	c.Params = gin.Params{{Key: "id", Value: "1"}}
+
+	service := &Service{accountRepo: mockAccountRepo}
+	service.UpdateAccount(c)
+
+	require.Equal(t, http.StatusOK, w.Code)
+	mockAccountRepo.AssertExpectations(t)
+}
+
+func TestUpdateAccount_NotFound(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	// mock account repo
+	mockAccountRepo := new(MockAccountRepo)
+	mockAccountRepo.On("GetAccount", 1).
+		Return((*model.Account)(nil), gorm.ErrRecordNotFound).
+		Times(1)
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = newJSONRequest(http.MethodPatch, "/accounts/1", `{"base_currency": "USD"}`)
+	c.Params = gin.Params{{Key: "id", Value: "1"}}
+
+	service := &Service{accountRepo: mockAccountRepo}
+	service.UpdateAccount(c)
+
+	require.Equal(t, http.StatusNotFound, w.Code)
+	require.Contains(t, w.Body.String(), accountNotFoundErr)
+}
+
+func TestDeleteAccount_Success(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	// mock account repo
+	mockAccountRepo := new(MockAccountRepo)
+	mockAccountRepo.On("DeleteAccount", 1).
+		Return(nil).
+		Times(1)
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodDelete, "/accounts/1", nil)
+	c.Params = gin.Params{{Key: "id", Value: "1"}}
+
+	service := &Service{accountRepo: mockAccountRepo}
+	service.DeleteAccount(c)
+
+	require.Equal(t, http.StatusNoContent, c.Writer.Status())
+	mockAccountRepo.AssertExpectations(t)
+}
+
+func TestDeleteAccount_WithTransactions(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	// mock account repo, the transactions of the account reference it
+	mockAccountRepo := new(MockAccountRepo)
+	mockAccountRepo.On("DeleteAccount", 1).
+		Return(gorm.ErrForeignKeyViolated).
+		Times(1)
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodDelete, "/accounts/1", nil)
+	c.Params = gin.Params{{Key: "id", Value: "1"}}
+
+	service := &Service{accountRepo: mockAccountRepo}
+	service.DeleteAccount(c)
+
+	require.Equal(t, http.StatusConflict, w.Code)
+	require.Contains(t, w.Body.String(), accountInUseErr)
+}
+
+func newJSONRequest(method, target, body string) *http.Request {
+	request := httptest.NewRequest(method, target, strings.NewReader(body))
+	request.Header.Set("Content-Type", "application/json")
+
+	return request
+}
@@ -0,0 +1,97 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/shopspring/decimal"
+	"gorm.io/gorm"
+
+	"github.com/mdcantarini/transaction-processor-api/pkg/converter"
+)
+
+// ImportFXRates stores the rates of a CSV or JSON file uploaded as multipart form data under the "file" field,
+// replacing the existing rates of the same pair and date
+func (s *Service) ImportFXRates(c *gin.Context) {
+	fileHeader, err := c.FormFile("file")
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("%s: %s", missingFileErr, err.Error())})
+		return
+	}
+
+	file, err := fileHeader.Open()
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("%s: %s", parseFXRatesErr, err.Error())})
+		return
+	}
+	defer file.Close()
+
+	rates, err := converter.ParseFXRates(file)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("%s: %s", parseFXRatesErr, err.Error())})
+		return
+	}
+
+	err = s.FXRateRepo().UpsertFXRates(rates)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("%s: %s", upsertFXRatesErr, err.Error())})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"imported": len(rates)})
+}
+
+// rateFinder returns a converter.RateFinder looking up the rates stored in the database. Rates are cached
+// by pair and date, since reports usually convert many transactions of the same day. The finder is safe for
+// concurrent use, so reports built in parallel can share it.
+func (s *Service) rateFinder() converter.RateFinder {
+	cache := map[string]decimal.Decimal{}
+	var mu sync.Mutex
+
+	return func(from, to string, date time.Time) (decimal.Decimal, error) {
+		key := fmt.Sprintf("%s/%s %s", from, to, date.Format(time.DateOnly))
+		mu.Lock()
+		rate, ok := cache[key]
+		mu.Unlock()
+		if ok {
+			return rate, nil
+		}
+
+		rate, err := s.effectiveRate(from, to, date)
+		if err != nil {
+			return decimal.Zero, err
+		}
+
+		mu.Lock()
+		cache[key] = rate
+		mu.Unlock()
+
+		return rate, nil
+	}
+}
+
+// effectiveRate returns the rate of the pair effective on the given date, the inverse pair is used
+// when there is no rate for the pair itself
+func (s *Service) effectiveRate(from, to string, date time.Time) (decimal.Decimal, error) {
+	rate, err := s.FXRateRepo().GetEffectiveFXRate(from, to, date)
+	if err == nil {
+		return rate.Rate, nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return decimal.Zero, fmt.Errorf("%s: %w", fetchFXRateErr, err)
+	}
+
+	inverse, err := s.FXRateRepo().GetEffectiveFXRate(to, from, date)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return decimal.Zero, fmt.Errorf("%w from %s to %s on %s", converter.ErrMissingFXRate, from, to, date.Format(time.DateOnly))
+	}
+	if err != nil {
+		return decimal.Zero, fmt.Errorf("%s: %w", fetchFXRateErr, err)
+	}
+
+	return decimal.NewFromInt(1).Div(inverse.Rate), nil
+}
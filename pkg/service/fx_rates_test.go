@@ -0,0 +1,76 @@
+package service
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+
+	"github.com/mdcantarini/transaction-processor-api/pkg/model"
+)
+
+func TestImportFXRates_Success(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	// mock fx rate repo
+	mockFXRateRepo := new(MockFXRateRepo)
+	mockFXRateRepo.On("UpsertFXRates", mock.MatchedBy(func(rates []model.FXRate) bool {
+		return len(rates) == 2 && rates[0].Pair() == "EUR/USD" && rates[1].Source == "ECB"
+	})).
+		Return(nil).
+		Times(1)
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = newMultipartRequest(t, "rates.csv", "pair,date,rate,source\nEUR/USD,2023-12-15,1.0912,ECB\nEUR/GBP,2023-12-15,0.86,ECB\n")
+
+	service := &Service{fxRateRepo: mockFXRateRepo}
+	service.ImportFXRates(c)
+
+	require.Equal(t, http.StatusCreated, w.Code)
+	require.JSONEq(t, `{"imported":2}`, w.Body.String())
+	mockFXRateRepo.AssertExpectations(t)
+}
+
+func TestImportFXRates_InvalidRate(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = newMultipartRequest(t, "rates.json", `[{"pair": "EUR/USD", "date": "2023-12-15", "rate": -1}]`)
+
+	service := &Service{fxRateRepo: new(MockFXRateRepo)}
+	service.ImportFXRates(c)
+
+	require.Equal(t, http.StatusBadRequest, w.Code)
+	require.Contains(t, w.Body.String(), parseFXRatesErr)
+}
+
+func TestRateFinder_UsesInversePairAndCaches(t *testing.T) {
+	date := time.Date(2023, 12, 15, 0, 0, 0, 0, time.UTC)
+
+	// mock fx rate repo, only the dollar to euro rate is known
+	mockFXRateRepo := new(MockFXRateRepo)
+	mockFXRateRepo.On("GetEffectiveFXRate", "EUR", "USD", date).
+		Return((*model.FXRate)(nil), gorm.ErrRecordNotFound).
+		Times(1)
+	mockFXRateRepo.On("GetEffectiveFXRate", "USD", "EUR", date).
+		Return(&model.FXRate{Rate: decimal.RequireFromString("0.8")}, nil).
+		Times(1)
+
+	service := &Service{fxRateRepo: mockFXRateRepo}
+	findRate := service.rateFinder()
+
+	for i := 0; i < 2; i++ {
+		rate, err := findRate("EUR", "USD", date)
+		require.NoError(t, err)
+		require.Equal(t, "1.25", rate.String())
+	}
+	mockFXRateRepo.AssertExpectations(t)
+}
@@ -0,0 +1,503 @@
+package service
+
+import (
+	"bufio"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"github.com/mdcantarini/transaction-processor-api/pkg/converter"
+	"github.com/mdcantarini/transaction-processor-api/pkg/model"
+	"github.com/mdcantarini/transaction-processor-api/pkg/utils"
+)
+
+const defaultImportBatchesLimit = 50
+
+// defaultInsertBatchSize keeps every insert statement well below the Postgres limit of 65535 parameters
+const defaultInsertBatchSize = 1000
+
+// copyBatchSize is the number of transactions sent on every COPY, which is not bound by the parameters limit
+const copyBatchSize = 50000
+
+// defaultBulkLoadThreshold is the file size from which transactions are loaded through the COPY protocol
+const defaultBulkLoadThreshold = 100 << 20
+
+// maxReportedRejects bounds the rejected rows returned by the API, the rejects file lists all of them
+const maxReportedRejects = 1000
+
+type ImportResult struct {
+	*model.ImportBatch
+	Rejects []converter.RowError `json:"rejects,omitempty"`
+}
+
+// ImportTransactions ingests a transactions file uploaded as multipart form data under the "file" field,
+// its format (CSV, OFX, camt.053 or MT940) is detected from the content. The optional "mode" field selects between the
+// lenient (default) and strict import modes, while the optional "profile" field selects the mapping
+// profile used to read the columns of CSV files.
+func (s *Service) ImportTransactions(c *gin.Context) {
+	mode := c.DefaultPostForm("mode", model.ImportModeLenient)
+	if mode != model.ImportModeLenient && mode != model.ImportModeStrict {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("%s: %s", invalidImportModeErr, mode)})
+		return
+	}
+
+	profileName := c.DefaultPostForm("profile", converter.DefaultMappingProfileName)
+	if _, ok := s.mappingProfile(profileName); !ok {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("%s: %s", unknownMappingProfileErr, profileName)})
+		return
+	}
+
+	fileHeader, err := c.FormFile("file")
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("%s: %s", missingFileErr, err.Error())})
+		return
+	}
+
+	importID, err := utils.GenerateID()
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("%s: %s", generateImportIDErr, err.Error())})
+		return
+	}
+
+	// every upload is kept under its import ID, so it can be inspected later on
+	filePath := filepath.Join(s.importsDir, importID+filepath.Ext(fileHeader.Filename))
+	err = c.SaveUploadedFile(fileHeader, filePath)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("%s: %s", saveFileErr, err.Error())})
+		return
+	}
+
+	batch := &model.ImportBatch{ID: importID, FileName: fileHeader.Filename, Mode: mode, MappingProfile: profileName}
+	rowErrors, err := s.importTransactionsFile(batch, filePath, nil)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error(), "import": batch})
+		return
+	}
+
+	c.JSON(http.StatusCreated, ImportResult{ImportBatch: batch, Rejects: rowErrors})
+}
+
+func (s *Service) GetImportBatch(c *gin.Context) {
+	batch, err := s.ImportBatchRepo().GetImportBatch(c.Param("id"))
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": importBatchNotFoundErr})
+			return
+		}
+
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("%s: %s", fetchImportBatchErr, err.Error())})
+		return
+	}
+
+	c.JSON(http.StatusOK, batch)
+}
+
+// GetImportBatchRejects downloads the rows rejected by a lenient import as a CSV file
+func (s *Service) GetImportBatchRejects(c *gin.Context) {
+	batch, err := s.ImportBatchRepo().GetImportBatch(c.Param("id"))
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": importBatchNotFoundErr})
+			return
+		}
+
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("%s: %s", fetchImportBatchErr, err.Error())})
+		return
+	}
+
+	if batch.RejectedCount == 0 {
+		c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": noRejectsErr})
+		return
+	}
+
+	c.FileAttachment(s.rejectsFilePath(batch), batch.ID+"-rejects.csv")
+}
+
+func (s *Service) ListImportBatches(c *gin.Context) {
+	limit := defaultImportBatchesLimit
+	if c.Query("limit") != "" {
+		l, err := strconv.Atoi(c.Query("limit"))
+		if err != nil || l <= 0 {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("%s: %s", invalidLimitErr, c.Query("limit"))})
+			return
+		}
+
+		limit = l
+	}
+
+	batches, err := s.ImportBatchRepo().ListImportBatches(limit)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("%s: %s", fetchImportBatchErr, err.Error())})
+		return
+	}
+
+	c.JSON(http.StatusOK, batches)
+}
+
+// importTransactionsFile streams the transactions of the CSV file located at filePath into the database,
+// recording the whole process in the given import batch. Once every transaction is stored, beforeCommit runs
+// within the same database transaction, whose failure rolls back the whole import. It returns the errors of the rejected rows, up to maxReportedRejects.
+func (s *Service) importTransactionsFile(batch *model.ImportBatch, filePath string, beforeCommit func(repo model.ITransaction) error) ([]converter.RowError, error) {
+	checksum, err := utils.FileSHA256(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", hashFileErr, err)
+	}
+
+	batch.SHA256 = checksum
+	batch.Status = model.ImportBatchStatusProcessing
+	batch.StartedAt = time.Now()
+	err = s.ImportBatchRepo().CreateImportBatch(batch)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", createImportBatchErr, err)
+	}
+
+	rowErrors, err := s.processTransactionsFile(batch, filePath, beforeCommit)
+	if err != nil {
+		batch.Status = model.ImportBatchStatusFailed
+		batch.Error = err.Error()
+	} else {
+		batch.Status = model.ImportBatchStatusCompleted
+	}
+
+	finishedAt := time.Now()
+	batch.FinishedAt = &finishedAt
+	updateErr := s.ImportBatchRepo().UpdateImportBatch(batch)
+	if err != nil {
+		return rowErrors, err
+	}
+	if updateErr != nil {
+		return nil, fmt.Errorf("%s: %w", updateImportBatchErr, updateErr)
+	}
+
+	return rowErrors, nil
+}
+
+func (s *Service) processTransactionsFile(batch *model.ImportBatch, filePath string, beforeCommit func(repo model.ITransaction) error) ([]converter.RowError, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", parseCSVErr, err)
+	}
+	defer file.Close()
+
+	fileInfo, err := file.Stat()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", parseCSVErr, err)
+	}
+
+	batch.LoadMethod = model.LoadMethodInsert
+	if fileInfo.Size() >= s.bulkLoadThresholdBytes() {
+		batch.LoadMethod = model.LoadMethodCopy
+	}
+
+	return s.processTransactions(batch, file, beforeCommit)
+}
+
+// processTransactions converts the rows read from r into transactions and stores them in fixed size batches,
+// all of them within a single database transaction, so memory usage does not depend on the file size.
+// Batches are stored through the COPY protocol when the import batch load method requires it.
+func (s *Service) processTransactions(batch *model.ImportBatch, r io.Reader, beforeCommit func(repo model.ITransaction) error) ([]converter.RowError, error) {
+	reader, err := s.newTransactionReader(batch, r)
+	if err != nil {
+		return nil, err
+	}
+
+	// bank statements are imported whole, since rejecting some of their entries would leave their balances
+	// unreconciled, so they are always imported in strict mode
+	if batch.Format != converter.FormatCSV {
+		batch.Mode = model.ImportModeStrict
+	}
+
+	rejects := &rejectsWriter{filePath: s.rejectsFilePath(batch)}
+	var reportedRowErrors []converter.RowError
+	// accounts caches the accounts found in the file, nil when they do not exist
+	accounts := map[int]*model.Account{}
+
+	err = s.TransactionRepo().RunInDBTransaction(func(repo model.ITransaction) error {
+		storeTransactions, batchSize := repo.UpsertTransactions, s.batchSize()
+		if batch.LoadMethod == model.LoadMethodCopy {
+			storeTransactions, batchSize = repo.BulkLoadTransactions, copyBatchSize
+		}
+
+		pending := make([]model.Transaction, 0, batchSize)
+		store := func() error {
+			if len(pending) == 0 {
+				return nil
+			}
+
+			inserted, err := storeTransactions(pending)
+			if err != nil {
+				return fmt.Errorf("%s: %w", insertTransactionErr, err)
+			}
+
+			batch.InsertedCount += inserted
+			batch.DuplicateCount += len(pending) - inserted
+			pending = pending[:0]
+
+			return nil
+		}
+
+		for {
+			transaction, rowErrors, err := reader.Read()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				if errors.Is(err, converter.ErrMissingColumns) {
+					return fmt.Errorf("%s: %w", transactionConversionErr, err)
+				}
+
+				return fmt.Errorf("%s: %w", parseCSVErr, err)
+			}
+
+			batch.RowCount++
+
+			if len(rowErrors) == 0 {
+				rowErrors, err = s.validateTransaction(&transaction, reader.Line(), accounts)
+				if err != nil {
+					return err
+				}
+			}
+
+			if len(rowErrors) > 0 {
+				if batch.Mode == model.ImportModeStrict {
+					return fmt.Errorf("%s: %w", transactionConversionErr, rowErrors[0])
+				}
+
+				batch.RejectedCount++
+				err = rejects.Write(rowErrors)
+				if err != nil {
+					return fmt.Errorf("%s: %w", writeRejectsErr, err)
+				}
+
+				for _, re := range rowErrors {
+					if len(reportedRowErrors) < maxReportedRejects {
+						reportedRowErrors = append(reportedRowErrors, re)
+					}
+				}
+
+				continue
+			}
+
+			transaction.ImportBatchID = &batch.ID
+			pending = append(pending, transaction)
+			if len(pending) == cap(pending) {
+				err = store()
+				if err != nil {
+					return err
+				}
+			}
+		}
+
+		err = store()
+		if err != nil || beforeCommit == nil {
+			return err
+		}
+
+		return beforeCommit(repo)
+	})
+
+	closeErr := rejects.Close()
+	if err != nil {
+		// nothing was stored, since the database transaction was rolled back
+		batch.InsertedCount = 0
+		batch.DuplicateCount = 0
+
+		return reportedRowErrors, err
+	}
+	if closeErr != nil {
+		return reportedRowErrors, fmt.Errorf("%s: %w", writeRejectsErr, closeErr)
+	}
+
+	return reportedRowErrors, nil
+}
+
+// transactionReader is implemented by the readers of every supported file format
+type transactionReader interface {
+	Read() (model.Transaction, []converter.RowError, error)
+	Line() int
+}
+
+// newTransactionReader detects the format of the file read from r and returns the reader for it
+func (s *Service) newTransactionReader(batch *model.ImportBatch, r io.Reader) (transactionReader, error) {
+	buffered := bufio.NewReader(r)
+	// a shorter head only means the file is small, any actual failure is reported while reading it
+	head, _ := buffered.Peek(converter.FormatDetectionBytes)
+	batch.Format = converter.DetectFormat(head)
+
+	switch batch.Format {
+	case converter.FormatOFX:
+		entries, err := converter.ParseOFX(buffered)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", parseFileErr, err)
+		}
+
+		return converter.NewStatementTransactionReader(entries, s.resolveBankAccount), nil
+	case converter.FormatCAMT053:
+		entries, err := converter.ParseCAMT053(buffered)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", parseFileErr, err)
+		}
+
+		return converter.NewStatementTransactionReader(entries, s.resolveBankAccount), nil
+	case converter.FormatMT940:
+		entries, balances, err := converter.ParseMT940(buffered)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", parseFileErr, err)
+		}
+
+		// balances are stored along with the import batch
+		batch.Balances = balances
+
+		return converter.NewStatementTransactionReader(entries, s.resolveBankAccount), nil
+	default:
+		profile, ok := s.mappingProfile(batch.MappingProfile)
+		if !ok {
+			return nil, fmt.Errorf("%s: %s", unknownMappingProfileErr, batch.MappingProfile)
+		}
+
+		return converter.NewCSVTransactionReader(buffered, profile), nil
+	}
+}
+
+// resolveBankAccount returns the ID of the account owning the bank account of a statement
+func (s *Service) resolveBankAccount(bankAccount string) (int, error) {
+	account, err := s.AccountRepo().GetAccountByBankAccount(bankAccount)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return 0, fmt.Errorf("%w %s", converter.ErrUnknownBankAccount, bankAccount)
+	}
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", fetchAccountErr, err)
+	}
+
+	return account.ID, nil
+}
+
+// validateTransaction checks the account of a transaction exists, gives the base currency of its account to a
+// transaction without currency, then checks the currency is known and the amount fits its minor unit. Unknown
+// accounts are rejected here, since the foreign key violation would abort the whole database transaction.
+func (s *Service) validateTransaction(transaction *model.Transaction, line int, accounts map[int]*model.Account) ([]converter.RowError, error) {
+	account, ok := accounts[transaction.AccountID]
+	if !ok {
+		var err error
+		account, err = s.AccountRepo().GetAccount(transaction.AccountID)
+		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, fmt.Errorf("%s: %w", fetchAccountErr, err)
+		}
+
+		// unknown accounts are cached as nil
+		accounts[transaction.AccountID] = account
+	}
+
+	if account == nil {
+		return []converter.RowError{{
+			Line:   line,
+			Column: converter.FieldAccountID,
+			Value:  strconv.Itoa(transaction.AccountID),
+			Reason: "unknown account",
+		}}, nil
+	}
+
+	if transaction.Currency == "" {
+		if account.BaseCurrency == "" {
+			return []converter.RowError{{
+				Line:   line,
+				Column: converter.FieldCurrency,
+				Reason: fmt.Sprintf("missing currency and account %d has no base currency", transaction.AccountID),
+			}}, nil
+		}
+
+		transaction.Currency = account.BaseCurrency
+	}
+
+	err := converter.ValidateCurrencyAmount(transaction.Currency, transaction.TransactionAmount)
+	if errors.Is(err, converter.ErrUnknownCurrency) {
+		return []converter.RowError{{Line: line, Column: converter.FieldCurrency, Value: transaction.Currency, Reason: err.Error()}}, nil
+	}
+	if err != nil {
+		return []converter.RowError{{
+			Line:   line,
+			Column: converter.FieldTransactionAmount,
+			Value:  transaction.TransactionAmount.String(),
+			Reason: err.Error(),
+		}}, nil
+	}
+
+	return nil, nil
+}
+
+func (s *Service) batchSize() int {
+	if s.insertBatchSize <= 0 {
+		return defaultInsertBatchSize
+	}
+
+	return s.insertBatchSize
+}
+
+func (s *Service) bulkLoadThresholdBytes() int64 {
+	if s.bulkLoadThreshold <= 0 {
+		return defaultBulkLoadThreshold
+	}
+
+	return s.bulkLoadThreshold
+}
+
+func (s *Service) rejectsFilePath(batch *model.ImportBatch) string {
+	return filepath.Join(s.importsDir, batch.ID+".rejects.csv")
+}
+
+// rejectsWriter writes the rejected rows of an import into a CSV file, which is only created
+// when there is at least one rejected row
+type rejectsWriter struct {
+	filePath string
+	file     *os.File
+	writer   *csv.Writer
+}
+
+func (rw *rejectsWriter) Write(rowErrors []converter.RowError) error {
+	if rw.file == nil {
+		file, err := os.Create(rw.filePath)
+		if err != nil {
+			return err
+		}
+
+		rw.file = file
+		rw.writer = csv.NewWriter(file)
+		err = rw.writer.Write(converter.RowErrorCSVHeader)
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, re := range rowErrors {
+		err := rw.writer.Write(re.CSVRecord())
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (rw *rejectsWriter) Close() error {
+	if rw.file == nil {
+		return nil
+	}
+
+	rw.writer.Flush()
+	err := rw.writer.Error()
+	if err != nil {
+		rw.file.Close()
+		return err
+	}
+
+	return rw.file.Close()
+}
@@ -0,0 +1,688 @@
+package service
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+
+	"github.com/mdcantarini/transaction-processor-api/pkg/converter"
+	"github.com/mdcantarini/transaction-processor-api/pkg/model"
+)
+
+const invalidTransactionsFile = "Id,Date,Transaction,Account\n1,2023-12-15,60.5,1\n2,2023-12-1a,-10.3,1\n"
+
+func TestImportTransactions_Success(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	// mock transaction repo, one of the transactions was already stored
+	mockTransactionRepo := new(MockTransactionRepo)
+	mockTransactionRepo.On("UpsertTransactions", mock.Anything).
+		Return(1, nil).
+		Times(1)
+
+	// mock import batch repo
+	mockImportBatchRepo := new(MockImportBatchRepo)
+	mockImportBatchRepo.On("CreateImportBatch", mock.MatchedBy(func(batch *model.ImportBatch) bool {
+		return batch.FileName == "transactions.csv" && batch.SHA256 != ""
+	})).
+		Return(nil).
+		Times(1)
+	mockImportBatchRepo.On("UpdateImportBatch", mock.MatchedBy(func(batch *model.ImportBatch) bool {
+		return batch.Status == model.ImportBatchStatusCompleted
+	})).
+		Return(nil).
+		Times(1)
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = newMultipartRequest(t, "transactions.csv", validTransactionsFile)
+
+	service := &Service{accountRepo: newMockAccountRepo(), transactionRepo: mockTransactionRepo, importBatchRepo: mockImportBatchRepo, importsDir: t.TempDir()}
+	service.ImportTransactions(c)
+
+	require.Equal(t, http.StatusCreated, w.Code)
+	require.Contains(t, w.Body.String(), `"row_count":2`)
+	require.Contains(t, w.Body.String(), `"load_method":"insert"`)
+	require.Contains(t, w.Body.String(), `"inserted_count":1`)
+	require.Contains(t, w.Body.String(), `"duplicate_count":1`)
+	mockTransactionRepo.AssertExpectations(t)
+	mockImportBatchRepo.AssertExpectations(t)
+}
+
+func TestImportTransactions_InsertsInBatches(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	// mock transaction repo, 5 transactions must be stored in batches of 2
+	mockTransactionRepo := new(MockTransactionRepo)
+	mockTransactionRepo.On("UpsertTransactions", mock.MatchedBy(func(transactions []model.Transaction) bool {
+		return len(transactions) == 2
+	})).
+		Return(2, nil).
+		Times(2)
+	mockTransactionRepo.On("UpsertTransactions", mock.MatchedBy(func(transactions []model.Transaction) bool {
+		return len(transactions) == 1 && transactions[0].TransactionID == 5
+	})).
+		Return(1, nil).
+		Times(1)
+
+	content := "Id,Date,Transaction,Account\n"
+	for i := 1; i <= 5; i++ {
+		content += fmt.Sprintf("%d,2023-12-15,60.5,1\n", i)
+	}
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = newMultipartRequest(t, "transactions.csv", content)
+
+	service := &Service{
+		accountRepo:     newMockAccountRepo(),
+		transactionRepo: mockTransactionRepo,
+		importBatchRepo: newMockImportBatchRepo(),
+		importsDir:      t.TempDir(),
+		insertBatchSize: 2,
+	}
+	service.ImportTransactions(c)
+
+	require.Equal(t, http.StatusCreated, w.Code)
+	require.Contains(t, w.Body.String(), `"row_count":5`)
+	require.Contains(t, w.Body.String(), `"inserted_count":5`)
+	mockTransactionRepo.AssertExpectations(t)
+}
+
+func TestImportTransactions_BulkLoadsLargeFiles(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	// mock transaction repo, the file exceeds the threshold so the COPY protocol must be used
+	mockTransactionRepo := new(MockTransactionRepo)
+	mockTransactionRepo.On("BulkLoadTransactions", mock.Anything).
+		Return(1, nil).
+		Times(1)
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = newMultipartRequest(t, "transactions.csv", validTransactionsFile)
+
+	service := &Service{
+		accountRepo:       newMockAccountRepo(),
+		transactionRepo:   mockTransactionRepo,
+		importBatchRepo:   newMockImportBatchRepo(),
+		importsDir:        t.TempDir(),
+		bulkLoadThreshold: 10,
+	}
+	service.ImportTransactions(c)
+
+	require.Equal(t, http.StatusCreated, w.Code)
+	require.Contains(t, w.Body.String(), `"load_method":"copy"`)
+	require.Contains(t, w.Body.String(), `"inserted_count":1`)
+	require.Contains(t, w.Body.String(), `"duplicate_count":1`)
+	mockTransactionRepo.AssertExpectations(t)
+	mockTransactionRepo.AssertNotCalled(t, "UpsertTransactions", mock.Anything)
+}
+
+func TestImportTransactions_OFXFile(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	content, err := os.ReadFile("../converter/testdata/statement_v1.ofx")
+	require.NoError(t, err)
+	// the invalid date of the last transaction is fixed, since statements are imported whole
+	content = bytes.ReplaceAll(content, []byte("2023121a"), []byte("20231216"))
+
+	// mock account repo
+	mockAccountRepo := new(MockAccountRepo)
+	mockAccountRepo.On("GetAccountByBankAccount", "000123456789").
+		Return(&model.Account{ID: 1, Email: "test@email.com"}, nil).
+		Times(1)
+	mockAccountRepo.On("GetAccount", 1).
+		Return(&model.Account{ID: 1, Email: "test@email.com"}, nil).
+		Times(1)
+
+	// mock transaction repo
+	mockTransactionRepo := new(MockTransactionRepo)
+	mockTransactionRepo.On("UpsertTransactions", mock.MatchedBy(func(transactions []model.Transaction) bool {
+		return len(transactions) == 3 && transactions[0].AccountID == 1 && transactions[0].ExternalID == "202312150001"
+	})).
+		Return(3, nil).
+		Times(1)
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = newMultipartRequest(t, "statement.ofx", string(content))
+
+	service := &Service{
+		accountRepo:     mockAccountRepo,
+		transactionRepo: mockTransactionRepo,
+		importBatchRepo: newMockImportBatchRepo(),
+		importsDir:      t.TempDir(),
+	}
+	service.ImportTransactions(c)
+
+	require.Equal(t, http.StatusCreated, w.Code)
+	require.Contains(t, w.Body.String(), `"format":"ofx"`)
+	require.Contains(t, w.Body.String(), `"inserted_count":3`)
+	require.Contains(t, w.Body.String(), `"rejected_count":0`)
+	mockAccountRepo.AssertExpectations(t)
+	mockTransactionRepo.AssertExpectations(t)
+}
+
+func TestImportTransactions_CAMT053File(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	content, err := os.ReadFile("../converter/testdata/camt053_v02.xml")
+	require.NoError(t, err)
+	// the unknown credit debit indicator of the last entry is fixed, since statements are imported whole
+	content = bytes.ReplaceAll(content, []byte("<CdtDbtInd>DEBIT</CdtDbtInd>"), []byte("<CdtDbtInd>DBIT</CdtDbtInd>"))
+
+	// mock account repo
+	mockAccountRepo := new(MockAccountRepo)
+	mockAccountRepo.On("GetAccountByBankAccount", "DE89370400440532013000").
+		Return(&model.Account{ID: 2, Email: "test@email.com"}, nil).
+		Times(1)
+	mockAccountRepo.On("GetAccount", 2).
+		Return(&model.Account{ID: 2, Email: "test@email.com"}, nil).
+		Times(1)
+
+	// mock transaction repo, the pending entry is not imported
+	mockTransactionRepo := new(MockTransactionRepo)
+	mockTransactionRepo.On("UpsertTransactions", mock.MatchedBy(func(transactions []model.Transaction) bool {
+		return len(transactions) == 3 && transactions[1].AccountID == 2 && transactions[1].Currency == "EUR"
+	})).
+		Return(3, nil).
+		Times(1)
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = newMultipartRequest(t, "statement.xml", string(content), "mode", model.ImportModeLenient)
+
+	service := &Service{
+		accountRepo:     mockAccountRepo,
+		transactionRepo: mockTransactionRepo,
+		importBatchRepo: newMockImportBatchRepo(),
+		importsDir:      t.TempDir(),
+	}
+	service.ImportTransactions(c)
+
+	require.Equal(t, http.StatusCreated, w.Code)
+	require.Contains(t, w.Body.String(), `"format":"camt.053"`)
+	require.Contains(t, w.Body.String(), `"inserted_count":3`)
+	mockAccountRepo.AssertExpectations(t)
+	mockTransactionRepo.AssertExpectations(t)
+}
+
+func TestImportTransactions_StatementsAreImportedWhole(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	content, err := os.ReadFile("../converter/testdata/camt053_v02.xml")
+	require.NoError(t, err)
+
+	// mock account repo
+	mockAccountRepo := new(MockAccountRepo)
+	mockAccountRepo.On("GetAccountByBankAccount", "DE89370400440532013000").
+		Return(&model.Account{ID: 2, Email: "test@email.com"}, nil)
+	mockAccountRepo.On("GetAccount", 2).
+		Return(&model.Account{ID: 2, Email: "test@email.com"}, nil)
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = newMultipartRequest(t, "statement.xml", string(content), "mode", model.ImportModeLenient)
+
+	service := &Service{
+		accountRepo:     mockAccountRepo,
+		transactionRepo: new(MockTransactionRepo),
+		importBatchRepo: newMockImportBatchRepo(),
+		importsDir:      t.TempDir(),
+	}
+	service.ImportTransactions(c)
+
+	// the statement holds an invalid entry, so none of its entries is imported, even in lenient mode
+	require.Equal(t, http.StatusInternalServerError, w.Code)
+	require.Contains(t, w.Body.String(), "line 47")
+	require.Contains(t, w.Body.String(), `"mode":"strict"`)
+	require.Contains(t, w.Body.String(), `"status":"failed"`)
+	require.Contains(t, w.Body.String(), `"inserted_count":0`)
+}
+
+func TestImportTransactions_MT940File(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	content, err := os.ReadFile("../converter/testdata/statement.mt940")
+	require.NoError(t, err)
+
+	// mock account repo
+	mockAccountRepo := new(MockAccountRepo)
+	mockAccountRepo.On("GetAccountByBankAccount", "DE89370400440532013000").
+		Return(&model.Account{ID: 2, Email: "test@email.com"}, nil).
+		Times(1)
+	mockAccountRepo.On("GetAccount", 2).
+		Return(&model.Account{ID: 2, Email: "test@email.com"}, nil).
+		Times(1)
+
+	// mock transaction repo, both statements have four lines in total
+	mockTransactionRepo := new(MockTransactionRepo)
+	mockTransactionRepo.On("UpsertTransactions", mock.MatchedBy(func(transactions []model.Transaction) bool {
+		return len(transactions) == 4 && transactions[0].AccountID == 2 && transactions[0].Description == "Invoice 42 payment Customer ACME Corp"
+	})).
+		Return(4, nil).
+		Times(1)
+
+	// mock import batch repo, the statement balances are stored along with the batch
+	mockImportBatchRepo := new(MockImportBatchRepo)
+	mockImportBatchRepo.On("CreateImportBatch", mock.Anything).Return(nil)
+	mockImportBatchRepo.On("UpdateImportBatch", mock.MatchedBy(func(batch *model.ImportBatch) bool {
+		return len(batch.Balances) == 2 && batch.Balances[1].ClosingBalance.Equal(decimal.NewFromInt(1000))
+	})).
+		Return(nil).
+		Times(1)
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = newMultipartRequest(t, "statement.sta", string(content))
+
+	service := &Service{
+		accountRepo:     mockAccountRepo,
+		transactionRepo: mockTransactionRepo,
+		importBatchRepo: mockImportBatchRepo,
+		importsDir:      t.TempDir(),
+	}
+	service.ImportTransactions(c)
+
+	require.Equal(t, http.StatusCreated, w.Code)
+	require.Contains(t, w.Body.String(), `"format":"mt940"`)
+	require.Contains(t, w.Body.String(), `"closing_balance":"1055.2"`)
+	mockTransactionRepo.AssertExpectations(t)
+	mockImportBatchRepo.AssertExpectations(t)
+}
+
+func TestImportTransactions_UnbalancedMT940File(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = newMultipartRequest(t, "statement.sta", ":20:STMT\n:25:123\n:60F:C231214EUR100,00\n:61:2312151215C60,50NTRFREF\n:62F:C231215EUR150,00\n")
+
+	service := &Service{
+		transactionRepo: new(MockTransactionRepo),
+		importBatchRepo: newMockImportBatchRepo(),
+		importsDir:      t.TempDir(),
+	}
+	service.ImportTransactions(c)
+
+	require.Equal(t, http.StatusInternalServerError, w.Code)
+	require.Contains(t, w.Body.String(), parseFileErr)
+	require.Contains(t, w.Body.String(), "closing balance does not match")
+	require.Contains(t, w.Body.String(), `"status":"failed"`)
+}
+
+func TestImportTransactions_RejectsInvalidCurrencies(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	// mock account repo, account 2 has no base currency
+	mockAccountRepo := new(MockAccountRepo)
+	mockAccountRepo.On("GetAccount", 1).
+		Return(&model.Account{ID: 1, BaseCurrency: "JPY"}, nil).
+		Times(1)
+	mockAccountRepo.On("GetAccount", 2).
+		Return(&model.Account{ID: 2}, nil).
+		Times(1)
+	mockAccountRepo.On("GetAccount", 3).
+		Return((*model.Account)(nil), gorm.ErrRecordNotFound).
+		Times(1)
+
+	// mock transaction repo, only the rows with a valid currency are stored
+	mockTransactionRepo := new(MockTransactionRepo)
+	mockTransactionRepo.On("UpsertTransactions", mock.MatchedBy(func(transactions []model.Transaction) bool {
+		return len(transactions) == 2 && transactions[0].Currency == "EUR" && transactions[1].Currency == "JPY"
+	})).
+		Return(2, nil).
+		Times(1)
+
+	content := "Id,Date,Transaction,Account,Currency\n" +
+		"1,2023-12-15,60.50,1,EUR\n" +
+		"2,2023-12-15,500,1,\n" +
+		"3,2023-12-15,5.5,1,\n" +
+		"4,2023-12-15,10.001,1,EUR\n" +
+		"5,2023-12-15,10,1,ABC\n" +
+		"6,2023-12-15,10,2,\n" +
+		"7,2023-12-15,10,3,\n" +
+		"8,2023-12-15,10,3,EUR\n"
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = newMultipartRequest(t, "transactions.csv", content)
+
+	service := &Service{
+		accountRepo:     mockAccountRepo,
+		transactionRepo: mockTransactionRepo,
+		importBatchRepo: newMockImportBatchRepo(),
+		importsDir:      t.TempDir(),
+	}
+	service.ImportTransactions(c)
+
+	require.Equal(t, http.StatusCreated, w.Code)
+
+	var result ImportResult
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &result))
+	require.Equal(t, 6, result.RejectedCount)
+	require.Equal(t, []converter.RowError{
+		{Line: 4, Column: converter.FieldTransactionAmount, Value: "5.5", Reason: "amount 5.5 has more than 0 decimal places allowed by JPY"},
+		{Line: 5, Column: converter.FieldTransactionAmount, Value: "10.001", Reason: "amount 10.001 has more than 2 decimal places allowed by EUR"},
+		{Line: 6, Column: converter.FieldCurrency, Value: "ABC", Reason: "unknown currency ABC"},
+		{Line: 7, Column: converter.FieldCurrency, Reason: "missing currency and account 2 has no base currency"},
+		{Line: 8, Column: converter.FieldAccountID, Value: "3", Reason: "unknown account"},
+		// unknown accounts are rejected even with a currency
+		{Line: 9, Column: converter.FieldAccountID, Value: "3", Reason: "unknown account"},
+	}, result.Rejects)
+	mockAccountRepo.AssertExpectations(t)
+	mockTransactionRepo.AssertExpectations(t)
+}
+
+func TestImportTransactions_MissingFile(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodPost, "/transactions/imports", nil)
+
+	service := &Service{importsDir: t.TempDir()}
+	service.ImportTransactions(c)
+
+	require.Equal(t, http.StatusBadRequest, w.Code)
+	require.Contains(t, w.Body.String(), missingFileErr)
+}
+
+func TestImportTransactions_ErrorParsingCsvFile(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	// mock import batch repo, the batch must be flagged as failed
+	mockImportBatchRepo := new(MockImportBatchRepo)
+	mockImportBatchRepo.On("CreateImportBatch", mock.Anything).
+		Return(nil).
+		Times(1)
+	mockImportBatchRepo.On("UpdateImportBatch", mock.MatchedBy(func(batch *model.ImportBatch) bool {
+		return batch.Status == model.ImportBatchStatusFailed
+	})).
+		Return(nil).
+		Times(1)
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = newMultipartRequest(t, "transactions.csv", "Id,Date,Transaction,Account\n\"1,2023-12-15,60.5,1\n")
+
+	service := &Service{accountRepo: newMockAccountRepo(), transactionRepo: new(MockTransactionRepo), importBatchRepo: mockImportBatchRepo, importsDir: t.TempDir()}
+	service.ImportTransactions(c)
+
+	require.Equal(t, http.StatusInternalServerError, w.Code)
+	require.Contains(t, w.Body.String(), parseCSVErr)
+	mockImportBatchRepo.AssertExpectations(t)
+}
+
+func TestImportTransactions_LenientModeRejectsInvalidRows(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	// mock transaction repo, only the valid transaction must be stored
+	mockTransactionRepo := new(MockTransactionRepo)
+	mockTransactionRepo.On("UpsertTransactions", mock.MatchedBy(func(transactions []model.Transaction) bool {
+		return len(transactions) == 1 && transactions[0].TransactionID == 1
+	})).
+		Return(1, nil).
+		Times(1)
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = newMultipartRequest(t, "transactions.csv", invalidTransactionsFile)
+
+	importsDir := t.TempDir()
+	service := &Service{accountRepo: newMockAccountRepo(), transactionRepo: mockTransactionRepo, importBatchRepo: newMockImportBatchRepo(), importsDir: importsDir}
+	service.ImportTransactions(c)
+
+	require.Equal(t, http.StatusCreated, w.Code)
+	require.Contains(t, w.Body.String(), `"mode":"lenient"`)
+	require.Contains(t, w.Body.String(), `"rejected_count":1`)
+	require.Contains(t, w.Body.String(), `{"line":3,"column":"date","value":"2023-12-1a","reason":"unable to convert 2023-12-1a into date"}`)
+	mockTransactionRepo.AssertExpectations(t)
+
+	// the rejected rows must be available as a CSV file
+	var result ImportResult
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &result))
+	rejects, err := os.ReadFile(filepath.Join(importsDir, result.ID+".rejects.csv"))
+	require.NoError(t, err)
+	require.Equal(t, "line,column,value,reason\n3,date,2023-12-1a,unable to convert 2023-12-1a into date\n", string(rejects))
+}
+
+func TestImportTransactions_StrictModeFailsOnInvalidRow(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = newMultipartRequest(t, "transactions.csv", invalidTransactionsFile, "mode", model.ImportModeStrict)
+
+	service := &Service{accountRepo: newMockAccountRepo(), transactionRepo: new(MockTransactionRepo), importBatchRepo: newMockImportBatchRepo(), importsDir: t.TempDir()}
+	service.ImportTransactions(c)
+
+	require.Equal(t, http.StatusInternalServerError, w.Code)
+	require.Contains(t, w.Body.String(), transactionConversionErr)
+	require.Contains(t, w.Body.String(), "line 3: error converting date")
+}
+
+func TestImportTransactions_InvalidMode(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = newMultipartRequest(t, "transactions.csv", "Id,Date,Transaction,Account\n", "mode", "relaxed")
+
+	service := &Service{importsDir: t.TempDir()}
+	service.ImportTransactions(c)
+
+	require.Equal(t, http.StatusBadRequest, w.Code)
+	require.Contains(t, w.Body.String(), invalidImportModeErr)
+}
+
+func TestImportTransactions_UnknownMappingProfile(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = newMultipartRequest(t, "transactions.csv", "Id,Date,Transaction,Account\n", "profile", "unknown")
+
+	service := &Service{importsDir: t.TempDir()}
+	service.ImportTransactions(c)
+
+	require.Equal(t, http.StatusBadRequest, w.Code)
+	require.Contains(t, w.Body.String(), unknownMappingProfileErr)
+}
+
+func TestGetImportBatchRejects_NoRejects(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	// mock import batch repo
+	mockImportBatchRepo := new(MockImportBatchRepo)
+	mockImportBatchRepo.On("GetImportBatch", "abc").
+		Return(&model.ImportBatch{ID: "abc", Status: model.ImportBatchStatusCompleted}, nil).
+		Times(1)
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Params = gin.Params{{Key: "id", Value: "abc"}}
+
+	service := &Service{importBatchRepo: mockImportBatchRepo}
+	service.GetImportBatchRejects(c)
+
+	require.Equal(t, http.StatusNotFound, w.Code)
+	require.Contains(t, w.Body.String(), noRejectsErr)
+}
+
+func TestGetImportBatch_Success(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	// mock import batch repo
+	mockImportBatchRepo := new(MockImportBatchRepo)
+	mockImportBatchRepo.On("GetImportBatch", "abc").
+		Return(&model.ImportBatch{ID: "abc", Status: model.ImportBatchStatusCompleted}, nil).
+		Times(1)
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Params = gin.Params{{Key: "id", Value: "abc"}}
+
+	service := &Service{importBatchRepo: mockImportBatchRepo}
+	service.GetImportBatch(c)
+
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Contains(t, w.Body.String(), `"id":"abc"`)
+}
+
+func TestGetImportBatch_NotFound(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	// mock import batch repo
+	mockImportBatchRepo := new(MockImportBatchRepo)
+	mockImportBatchRepo.On("GetImportBatch", "abc").
+		Return((*model.ImportBatch)(nil), gorm.ErrRecordNotFound).
+		Times(1)
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Params = gin.Params{{Key: "id", Value: "abc"}}
+
+	service := &Service{importBatchRepo: mockImportBatchRepo}
+	service.GetImportBatch(c)
+
+	require.Equal(t, http.StatusNotFound, w.Code)
+	require.Contains(t, w.Body.String(), importBatchNotFoundErr)
+}
+
+func TestListImportBatches_InvalidLimit(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodGet, "/imports?limit=abc", nil)
+
+	service := &Service{}
+	service.ListImportBatches(c)
+
+	require.Equal(t, http.StatusBadRequest, w.Code)
+	require.Contains(t, w.Body.String(), invalidLimitErr)
+}
+
+// newMultipartRequest builds an upload request for the given file, fields are provided as key value pairs
+func newMultipartRequest(t *testing.T, fileName, content string, fields ...string) *http.Request {
+	body := &bytes.Buffer{}
+	writer := multipart.NewWriter(body)
+
+	for i := 0; i+1 < len(fields); i += 2 {
+		require.NoError(t, writer.WriteField(fields[i], fields[i+1]))
+	}
+
+	part, err := writer.CreateFormFile("file", fileName)
+	require.NoError(t, err)
+	_, err = part.Write([]byte(content))
+	require.NoError(t, err)
+	require.NoError(t, writer.Close())
+
+	req := httptest.NewRequest(http.MethodPost, "/transactions/imports", body)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+
+	return req
+}
+
+// discardTransactionRepo drops every transaction, so benchmarks only measure the import pipeline. It counts
+// the stored transactions and samples the heap every 100 batches. The methods unrelated to imports are left
+// unimplemented.
+type discardTransactionRepo struct {
+	model.ITransaction
+	stored   int
+	peakHeap uint64
+}
+
+func (r *discardTransactionRepo) UpsertTransactions(transactions []model.Transaction) (int, error) {
+	r.store(len(transactions))
+	return len(transactions), nil
+}
+
+func (r *discardTransactionRepo) BulkLoadTransactions(transactions []model.Transaction) (int, error) {
+	r.store(len(transactions))
+	return len(transactions), nil
+}
+
+func (r *discardTransactionRepo) RunInDBTransaction(fn func(repo model.ITransaction) error) error {
+	return fn(r)
+}
+
+func (r *discardTransactionRepo) store(count int) {
+	r.stored += count
+	if r.stored%(100*defaultInsertBatchSize) != 0 {
+		return
+	}
+
+	var stats runtime.MemStats
+	runtime.ReadMemStats(&stats)
+	if stats.HeapInuse > r.peakHeap {
+		r.peakHeap = stats.HeapInuse
+	}
+}
+
+// generatedTransactionsFile produces the content of a transactions CSV file with the given number of rows
+// without keeping it in memory
+type generatedTransactionsFile struct {
+	rows    int
+	current int
+	buffer  []byte
+}
+
+func (g *generatedTransactionsFile) Read(p []byte) (int, error) {
+	for len(g.buffer) == 0 {
+		if g.current > g.rows {
+			return 0, io.EOF
+		}
+
+		if g.current == 0 {
+			g.buffer = []byte("Id,Date,Transaction,Account\n")
+		} else {
+			g.buffer = fmt.Appendf(g.buffer, "%d,2023-12-15,%d.%02d,%d\n", g.current, g.current%1000-500, g.current%100, g.current%50)
+		}
+		g.current++
+	}
+
+	n := copy(p, g.buffer)
+	g.buffer = g.buffer[n:]
+
+	return n, nil
+}
+
+// BenchmarkProcessTransactions_5MRows reports the peak heap while importing a 5 million rows file,
+// which must stay flat regardless of the number of rows
+func BenchmarkProcessTransactions_5MRows(b *testing.B) {
+	const rows = 5_000_000
+
+	for i := 0; i < b.N; i++ {
+		repo := &discardTransactionRepo{}
+		service := &Service{accountRepo: newMockAccountRepo(), transactionRepo: repo, importsDir: b.TempDir()}
+
+		runtime.GC()
+		var baseline runtime.MemStats
+		runtime.ReadMemStats(&baseline)
+
+		batch := &model.ImportBatch{ID: "benchmark", Mode: model.ImportModeStrict, MappingProfile: converter.DefaultMappingProfileName}
+		_, err := service.processTransactions(batch, &generatedTransactionsFile{rows: rows}, nil)
+		require.NoError(b, err)
+		require.Equal(b, rows, batch.InsertedCount)
+		require.Equal(b, rows, repo.stored)
+
+		b.ReportMetric(float64(repo.peakHeap-min(repo.peakHeap, baseline.HeapInuse))/(1<<20), "peak-heap-MB")
+	}
+}
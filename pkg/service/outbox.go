@@ -0,0 +1,332 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cenkalti/backoff/v4"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"github.com/mdcantarini/transaction-processor-api/pkg/converter"
+	"github.com/mdcantarini/transaction-processor-api/pkg/model"
+)
+
+const (
+	defaultOutboxMessagesLimit = 50
+	defaultOutboxMaxAttempts   = 5
+	defaultOutboxPollInterval  = 5 * time.Second
+	defaultEmailWorkers        = 4
+	// outboxDeliveryBatchSize is the number of due messages fetched on every poll
+	outboxDeliveryBatchSize = 100
+	// the delay before retrying a failed delivery doubles on every attempt, from a minute up to an hour
+	outboxInitialRetryDelay = time.Minute
+	outboxMaxRetryDelay     = time.Hour
+	// outboxClaimTimeout is the time after which the messages claimed by a worker which crashed are claimed again,
+	// well above the time taken to deliver a batch of messages
+	outboxClaimTimeout = 15 * time.Minute
+)
+
+// errDeliveryCancelled is returned when the delivery of a message is cancelled before it is sent
+var errDeliveryCancelled = errors.New("delivery cancelled")
+
+// ListOutboxMessages lists the report emails, newest first, optionally filtered by status and import batch
+func (s *Service) ListOutboxMessages(c *gin.Context) {
+	filter := model.OutboxFilter{Status: c.Query("status"), Limit: defaultOutboxMessagesLimit}
+	switch filter.Status {
+	case "", model.OutboxStatusPending, model.OutboxStatusSending, model.OutboxStatusSent, model.OutboxStatusDead:
+	default:
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("%s: unknown status %s", invalidOutboxFilterErr, filter.Status)})
+		return
+	}
+
+	if c.Query("import_batch_id") != "" {
+		importBatchID := c.Query("import_batch_id")
+		filter.ImportBatchID = &importBatchID
+	}
+
+	if c.Query("limit") != "" {
+		limit, err := strconv.Atoi(c.Query("limit"))
+		if err != nil || limit <= 0 {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("%s: %s", invalidLimitErr, c.Query("limit"))})
+			return
+		}
+
+		filter.Limit = limit
+	}
+
+	messages, err := s.OutboxRepo().ListOutboxMessages(filter)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("%s: %s", fetchOutboxMessageErr, err.Error())})
+		return
+	}
+
+	c.JSON(http.StatusOK, messages)
+}
+
+func (s *Service) GetOutboxMessage(c *gin.Context) {
+	messageID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": outboxMessageNotFoundErr})
+		return
+	}
+
+	message, err := s.OutboxRepo().GetOutboxMessage(uint(messageID))
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": outboxMessageNotFoundErr})
+			return
+		}
+
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("%s: %s", fetchOutboxMessageErr, err.Error())})
+		return
+	}
+
+	c.JSON(http.StatusOK, message)
+}
+
+// RunOutboxWorker delivers the due outbox messages every poll interval until the context is done. Messages are
+// claimed before being delivered, so several services can share the outbox.
+func (s *Service) RunOutboxWorker(ctx context.Context) {
+	pollInterval := s.outboxPollInterval
+	if pollInterval <= 0 {
+		pollInterval = defaultOutboxPollInterval
+	}
+
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+
+	for {
+		err := s.deliverOutboxMessages(ctx, time.Now())
+		logDeliveryErrors(err)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// logDeliveryErrors logs the errors of a delivery run, on a line per account for the failures of accounts
+func logDeliveryErrors(err error) {
+	accountErrors, ok := err.(AccountErrors)
+	if !ok {
+		if err != nil {
+			log.Printf("%s: %s", sendEmailErr, err.Error())
+		}
+		return
+	}
+
+	for _, accountID := range accountErrors.accountIDs() {
+		log.Printf("%s for account %d: %s", sendEmailErr, accountID, accountErrors[accountID].Error())
+	}
+}
+
+// AccountErrors aggregates the errors of several accounts by account ID
+type AccountErrors map[int]error
+
+// accountIDs returns the IDs of the accounts with errors, in order
+func (ae AccountErrors) accountIDs() []int {
+	accountIDs := make([]int, 0, len(ae))
+	for accountID := range ae {
+		accountIDs = append(accountIDs, accountID)
+	}
+	sort.Ints(accountIDs)
+
+	return accountIDs
+}
+
+func (ae AccountErrors) Error() string {
+	accountIDs := ae.accountIDs()
+	messages := make([]string, 0, len(accountIDs))
+	for _, accountID := range accountIDs {
+		messages = append(messages, fmt.Sprintf("account %d: %s", accountID, ae[accountID].Error()))
+	}
+
+	return strings.Join(messages, "; ")
+}
+
+// orNil returns nil when no account has errors, so an empty AccountErrors is not returned as an error
+func (ae AccountErrors) orNil() error {
+	if len(ae) == 0 {
+		return nil
+	}
+
+	return ae
+}
+
+// deliverOutboxMessages claims the messages due at the given time, then builds and sends them through a pool of
+// workers, sharing the rate limit of the email provider. Failed deliveries are retried with an exponential backoff,
+// until the message runs out of attempts and is dead-lettered. The failures of every account are returned as
+// AccountErrors. Once the context is done no more messages are delivered, the rest of them are released.
+//
+// Delivery is at least once: the messages of a worker which crashed after sending them, before storing their
+// status, are claimed again once their claim times out and sent a second time.
+func (s *Service) deliverOutboxMessages(ctx context.Context, now time.Time) error {
+	messages, err := s.OutboxRepo().ClaimDueOutboxMessages(now, now.Add(-outboxClaimTimeout), outboxDeliveryBatchSize)
+	if err != nil {
+		return fmt.Errorf("%s: %w", fetchOutboxMessageErr, err)
+	}
+
+	// the rates are shared by every report of the run
+	findRate := s.rateFinder()
+	accountErrors := AccountErrors{}
+	var released []uint
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+
+	jobs := make(chan *model.OutboxMessage)
+	for i := 0; i < s.deliveryWorkers(); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for message := range jobs {
+				err := s.deliverOutboxMessage(ctx, message, findRate)
+				mu.Lock()
+				if errors.Is(err, errDeliveryCancelled) {
+					released = append(released, message.ID)
+				} else if err != nil {
+					accountErrors[message.AccountID] = errors.Join(accountErrors[message.AccountID], err)
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+
+	fed := 0
+feed:
+	for ; fed < len(messages); fed++ {
+		// a worker might be ready as well, which select would choose at random
+		if ctx.Err() != nil {
+			break
+		}
+
+		select {
+		case <-ctx.Done():
+			break feed
+		case jobs <- &messages[fed]:
+		}
+	}
+	close(jobs)
+	wg.Wait()
+
+	for _, message := range messages[fed:] {
+		released = append(released, message.ID)
+	}
+
+	if len(released) > 0 {
+		err = s.OutboxRepo().ReleaseOutboxMessages(released)
+		if err != nil {
+			// the messages are claimed again once their claim times out
+			return errors.Join(accountErrors.orNil(), fmt.Errorf("unable to release outbox messages: %w", err))
+		}
+	}
+
+	return accountErrors.orNil()
+}
+
+// deliverOutboxMessage builds and sends the message, then stores its delivery status. It returns
+// errDeliveryCancelled, leaving the message as it was, when the delivery is cancelled by the context.
+func (s *Service) deliverOutboxMessage(ctx context.Context, message *model.OutboxMessage, findRate converter.RateFinder) error {
+	report, err := s.buildOutboxEmail(message, findRate)
+	if err == nil {
+		message.Recipient = report.To
+		message.Subject = report.Subject
+
+		err = s.emailLimiter.Wait(ctx)
+		if err != nil {
+			return errDeliveryCancelled
+		}
+
+		err = s.emailSender.SendEmail(report.To, report.Subject, report.Body, report.Attachments...)
+	}
+
+	recordDeliveryAttempt(message, err, s.maxDeliveryAttempts(), time.Now())
+	updateErr := s.OutboxRepo().UpdateOutboxMessage(message)
+	if updateErr != nil {
+		// the message stays claimed, so it is sent again once its claim times out
+		return errors.Join(err, fmt.Errorf("unable to update outbox message %d: %w", message.ID, updateErr))
+	}
+
+	return err
+}
+
+// buildOutboxEmail builds the content of the message according to its kind
+func (s *Service) buildOutboxEmail(message *model.OutboxMessage, findRate converter.RateFinder) (*reportEmail, error) {
+	switch message.Kind {
+	case model.OutboxKindDailyReport:
+		if message.ImportBatchID == nil {
+			return nil, fmt.Errorf("daily report message %d without import batch", message.ID)
+		}
+
+		return s.buildDailyReport(message.AccountID, *message.ImportBatchID, findRate)
+	case model.OutboxKindPeriodReport:
+		return s.buildPeriodReport(message, findRate)
+	}
+
+	return nil, fmt.Errorf("unknown outbox message kind %q", message.Kind)
+}
+
+// recordDeliveryAttempt updates the status of the message after trying to deliver it, releasing its claim
+func recordDeliveryAttempt(message *model.OutboxMessage, sendErr error, maxAttempts int, now time.Time) {
+	message.Attempts++
+	message.ClaimedAt = nil
+	if sendErr == nil {
+		message.Status = model.OutboxStatusSent
+		message.LastError = ""
+		message.SentAt = &now
+		return
+	}
+
+	message.LastError = sendErr.Error()
+	if message.Attempts >= maxAttempts {
+		message.Status = model.OutboxStatusDead
+		return
+	}
+
+	message.Status = model.OutboxStatusPending
+	message.NextAttemptAt = now.Add(retryDelay(message.Attempts))
+}
+
+// retryDelay returns the delay before the next delivery attempt of a message which already failed the given
+// number of attempts, randomized so messages failing together are not retried together
+func retryDelay(attempts int) time.Duration {
+	policy := backoff.NewExponentialBackOff()
+	policy.InitialInterval = outboxInitialRetryDelay
+	policy.MaxInterval = outboxMaxRetryDelay
+	policy.Multiplier = 2
+	policy.MaxElapsedTime = 0
+	policy.Reset()
+
+	delay := policy.NextBackOff()
+	for i := 1; i < attempts; i++ {
+		delay = policy.NextBackOff()
+	}
+
+	return delay
+}
+
+func (s *Service) maxDeliveryAttempts() int {
+	if s.outboxMaxAttempts <= 0 {
+		return defaultOutboxMaxAttempts
+	}
+
+	return s.outboxMaxAttempts
+}
+
+func (s *Service) deliveryWorkers() int {
+	if s.emailWorkers <= 0 {
+		return defaultEmailWorkers
+	}
+
+	return s.emailWorkers
+}
@@ -0,0 +1,377 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+
+	"github.com/mdcantarini/transaction-processor-api/pkg/model"
+	"github.com/mdcantarini/transaction-processor-api/pkg/utils/email"
+)
+
+// newMockOutboxMessage returns a daily report message claimed by the worker
+func newMockOutboxMessage(accountID, attempts int) model.OutboxMessage {
+	importBatchID := "batch"
+	claimedAt := time.Date(2023, 12, 16, 8, 0, 0, 0, time.UTC)
+	return model.OutboxMessage{
+		ID:            uint(accountID),
+		Kind:          model.OutboxKindDailyReport,
+		ImportBatchID: &importBatchID,
+		AccountID:     accountID,
+		Status:        model.OutboxStatusSending,
+		ClaimedAt:     &claimedAt,
+		Attempts:      attempts,
+	}
+}
+
+// newMockReportTransactionRepo returns a transaction repo holding a single transaction in dollars for every account
+func newMockReportTransactionRepo() *MockTransactionRepo {
+	mockTransactionRepo := new(MockTransactionRepo)
+	mockTransactionRepo.On("SummarizeTransactions", mock.Anything).
+		Return(newMockAccountSummary(), nil)
+	mockTransactionRepo.On("ListTransactions", mock.Anything).
+		Return([]model.Transaction{
+			{TransactionID: 1, Date: time.Date(2023, 12, 15, 0, 0, 0, 0, time.UTC), TransactionAmount: decimal.RequireFromString("60.5"), Currency: "USD", AccountID: 1},
+		}, nil)
+
+	return mockTransactionRepo
+}
+
+func TestDeliverOutboxMessages_Sent(t *testing.T) {
+	now := time.Date(2023, 12, 16, 8, 0, 0, 0, time.UTC)
+
+	// mock outbox repo with a due message
+	mockOutboxRepo := new(MockOutboxRepo)
+	mockOutboxRepo.On("ClaimDueOutboxMessages", now, now.Add(-outboxClaimTimeout), outboxDeliveryBatchSize).
+		Return([]model.OutboxMessage{newMockOutboxMessage(1, 0)}, nil).
+		Times(1)
+	mockOutboxRepo.On("UpdateOutboxMessage", mock.MatchedBy(func(message model.OutboxMessage) bool {
+		return message.Status == model.OutboxStatusSent &&
+			message.ClaimedAt == nil &&
+			message.Attempts == 1 &&
+			message.SentAt != nil &&
+			message.Recipient == "test@email.com" &&
+			message.Subject == "Daily report for Account 1"
+	})).
+		Return(nil).
+		Times(1)
+
+	// mock email sender, the report attaches the transactions of the account inserted by the import batch
+	mockEmailSender := new(MockEmailSender)
+	body := mock.MatchedBy(func(body email.Body) bool {
+		return strings.Contains(body.HTML, "<p>Number of new transactions: 1</p>") &&
+			strings.Contains(body.Text, "Number of new transactions: 1\n")
+	})
+	mockEmailSender.On("SendEmail", "test@email.com", "Daily report for Account 1", body, []email.Attachment{{
+		FileName:    "transactions-account-1.csv",
+		ContentType: "text/csv",
+		Content:     []byte("Id,Date,Transaction,Account,Currency\n1,2023-12-15,60.5,1,USD\n"),
+	}}).
+		Return(nil).
+		Times(1)
+
+	service := &Service{
+		accountRepo:     newMockAccountRepo(),
+		transactionRepo: newMockReportTransactionRepo(),
+		outboxRepo:      mockOutboxRepo,
+		emailSender:     mockEmailSender,
+	}
+	require.NoError(t, service.deliverOutboxMessages(context.Background(), now))
+
+	mockOutboxRepo.AssertExpectations(t)
+	mockEmailSender.AssertExpectations(t)
+}
+
+func TestDeliverOutboxMessages_RetriedWithBackoff(t *testing.T) {
+	now := time.Date(2023, 12, 16, 8, 0, 0, 0, time.UTC)
+
+	// mock outbox repo with a message which already failed once
+	mockOutboxRepo := new(MockOutboxRepo)
+	mockOutboxRepo.On("ClaimDueOutboxMessages", now, now.Add(-outboxClaimTimeout), outboxDeliveryBatchSize).
+		Return([]model.OutboxMessage{newMockOutboxMessage(1, 1)}, nil).
+		Times(1)
+	mockOutboxRepo.On("UpdateOutboxMessage", mock.MatchedBy(func(message model.OutboxMessage) bool {
+		// the claim is released and the second retry waits around two minutes, give or take the randomization
+		return message.Status == model.OutboxStatusPending &&
+			message.ClaimedAt == nil &&
+			message.Attempts == 2 &&
+			message.LastError == "error sending email" &&
+			message.NextAttemptAt.After(time.Now().Add(time.Minute)) &&
+			message.NextAttemptAt.Before(time.Now().Add(3*time.Minute))
+	})).
+		Return(nil).
+		Times(1)
+
+	// mock error response in email sender
+	mockEmailSender := new(MockEmailSender)
+	mockEmailSender.On("SendEmail", mock.Anything, mock.Anything, mock.Anything, mock.Anything).
+		Return(fmt.Errorf("error sending email")).
+		Times(1)
+
+	service := &Service{
+		accountRepo:     newMockAccountRepo(),
+		transactionRepo: newMockReportTransactionRepo(),
+		outboxRepo:      mockOutboxRepo,
+		emailSender:     mockEmailSender,
+	}
+	err := service.deliverOutboxMessages(context.Background(), now)
+	require.EqualError(t, err, "account 1: error sending email")
+
+	mockOutboxRepo.AssertExpectations(t)
+}
+
+func TestDeliverOutboxMessages_DeadLettered(t *testing.T) {
+	now := time.Date(2023, 12, 16, 8, 0, 0, 0, time.UTC)
+
+	// mock outbox repo with a message on its last attempt
+	mockOutboxRepo := new(MockOutboxRepo)
+	mockOutboxRepo.On("ClaimDueOutboxMessages", now, now.Add(-outboxClaimTimeout), outboxDeliveryBatchSize).
+		Return([]model.OutboxMessage{newMockOutboxMessage(1, 2)}, nil).
+		Times(1)
+	mockOutboxRepo.On("UpdateOutboxMessage", mock.MatchedBy(func(message model.OutboxMessage) bool {
+		return message.Status == model.OutboxStatusDead && message.Attempts == 3 && message.SentAt == nil
+	})).
+		Return(nil).
+		Times(1)
+
+	// mock error response in email sender
+	mockEmailSender := new(MockEmailSender)
+	mockEmailSender.On("SendEmail", mock.Anything, mock.Anything, mock.Anything, mock.Anything).
+		Return(fmt.Errorf("error sending email")).
+		Times(1)
+
+	service := &Service{
+		accountRepo:       newMockAccountRepo(),
+		transactionRepo:   newMockReportTransactionRepo(),
+		outboxRepo:        mockOutboxRepo,
+		emailSender:       mockEmailSender,
+		outboxMaxAttempts: 3,
+	}
+	require.Error(t, service.deliverOutboxMessages(context.Background(), now))
+
+	mockOutboxRepo.AssertExpectations(t)
+}
+
+func TestDeliverOutboxMessages_ErrorMissingFXRate(t *testing.T) {
+	now := time.Date(2023, 12, 16, 8, 0, 0, 0, time.UTC)
+
+	// mock outbox repo with a due message
+	mockOutboxRepo := new(MockOutboxRepo)
+	mockOutboxRepo.On("ClaimDueOutboxMessages", now, now.Add(-outboxClaimTimeout), outboxDeliveryBatchSize).
+		Return([]model.OutboxMessage{newMockOutboxMessage(1, 0)}, nil).
+		Times(1)
+	mockOutboxRepo.On("UpdateOutboxMessage", mock.MatchedBy(func(message model.OutboxMessage) bool {
+		return message.Status == model.OutboxStatusPending &&
+			strings.Contains(message.LastError, "missing fx rate from EUR to USD on 2023-12-15")
+	})).
+		Return(nil).
+		Times(1)
+
+	// mock transaction repo with transactions in euros
+	mockTransactionRepo := new(MockTransactionRepo)
+	mockTransactionRepo.On("SummarizeTransactions", mock.Anything).
+		Return(&model.AccountSummary{
+			AccountID:   1,
+			DailyTotals: []model.DailyTotal{{Currency: "EUR", Date: time.Date(2023, 12, 15, 0, 0, 0, 0, time.UTC), Total: decimal.RequireFromString("60.5")}},
+		}, nil)
+
+	// mock fx rate repo without rates between euros and dollars
+	mockFXRateRepo := new(MockFXRateRepo)
+	mockFXRateRepo.On("GetEffectiveFXRate", mock.Anything, mock.Anything, mock.Anything).
+		Return((*model.FXRate)(nil), gorm.ErrRecordNotFound)
+
+	// the report cannot be built, so nothing is sent
+	mockEmailSender := new(MockEmailSender)
+	service := &Service{
+		accountRepo:     newMockAccountRepo(),
+		transactionRepo: mockTransactionRepo,
+		fxRateRepo:      mockFXRateRepo,
+		outboxRepo:      mockOutboxRepo,
+		emailSender:     mockEmailSender,
+	}
+	err := service.deliverOutboxMessages(context.Background(), now)
+	require.ErrorContains(t, err, "account 1: unable to build report: missing fx rate from EUR to USD on 2023-12-15")
+
+	mockOutboxRepo.AssertExpectations(t)
+	mockEmailSender.AssertNotCalled(t, "SendEmail")
+}
+
+func TestDeliverOutboxMessages_AggregatesAccountErrors(t *testing.T) {
+	now := time.Date(2023, 12, 16, 8, 0, 0, 0, time.UTC)
+
+	// mock outbox repo with the reports of ten accounts
+	messages := []model.OutboxMessage{}
+	for accountID := 1; accountID <= 10; accountID++ {
+		messages = append(messages, newMockOutboxMessage(accountID, 0))
+	}
+	mockOutboxRepo := new(MockOutboxRepo)
+	mockOutboxRepo.On("ClaimDueOutboxMessages", now, now.Add(-outboxClaimTimeout), outboxDeliveryBatchSize).
+		Return(messages, nil).
+		Times(1)
+	mockOutboxRepo.On("UpdateOutboxMessage", mock.Anything).
+		Return(nil).
+		Times(10)
+
+	// mock account repo, where accounts 3 and 7 cannot be fetched
+	mockAccountRepo := new(MockAccountRepo)
+	for accountID := 1; accountID <= 10; accountID++ {
+		if accountID == 3 || accountID == 7 {
+			mockAccountRepo.On("GetAccount", accountID).Return((*model.Account)(nil), fmt.Errorf("connection reset"))
+			continue
+		}
+
+		mockAccountRepo.On("GetAccount", accountID).
+			Return(&model.Account{ID: accountID, Email: fmt.Sprintf("account%d@email.com", accountID), BaseCurrency: "USD"}, nil)
+	}
+
+	// mock email sender
+	mockEmailSender := new(MockEmailSender)
+	mockEmailSender.On("SendEmail", mock.Anything, mock.Anything, mock.Anything, mock.Anything).
+		Return(nil).
+		Times(8)
+
+	service := &Service{
+		accountRepo:     mockAccountRepo,
+		transactionRepo: newMockReportTransactionRepo(),
+		outboxRepo:      mockOutboxRepo,
+		emailSender:     mockEmailSender,
+		emailWorkers:    3,
+	}
+	err := service.deliverOutboxMessages(context.Background(), now)
+
+	var accountErrors AccountErrors
+	require.ErrorAs(t, err, &accountErrors)
+	require.Len(t, accountErrors, 2)
+	require.EqualError(t, err, "account 3: unable to fetch account 3; account 7: unable to fetch account 7")
+	mockEmailSender.AssertExpectations(t)
+}
+
+func TestDeliverOutboxMessages_ContextCancelled(t *testing.T) {
+	now := time.Date(2023, 12, 16, 8, 0, 0, 0, time.UTC)
+
+	// mock outbox repo with a due message, which is released when the delivery is cancelled
+	mockOutboxRepo := new(MockOutboxRepo)
+	mockOutboxRepo.On("ClaimDueOutboxMessages", now, now.Add(-outboxClaimTimeout), outboxDeliveryBatchSize).
+		Return([]model.OutboxMessage{newMockOutboxMessage(1, 0)}, nil).
+		Times(1)
+	mockOutboxRepo.On("ReleaseOutboxMessages", []uint{1}).
+		Return(nil).
+		Times(1)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	// the message is left pending, without sending nor updating it
+	mockEmailSender := new(MockEmailSender)
+	service := &Service{
+		accountRepo:     newMockAccountRepo(),
+		transactionRepo: newMockReportTransactionRepo(),
+		outboxRepo:      mockOutboxRepo,
+		emailSender:     mockEmailSender,
+	}
+	require.NoError(t, service.deliverOutboxMessages(ctx, now))
+
+	mockEmailSender.AssertNotCalled(t, "SendEmail")
+	mockOutboxRepo.AssertNotCalled(t, "UpdateOutboxMessage", mock.Anything)
+	mockOutboxRepo.AssertExpectations(t)
+}
+
+func TestDeliverOutboxMessages_ErrorUnknownKind(t *testing.T) {
+	now := time.Date(2023, 12, 16, 8, 0, 0, 0, time.UTC)
+
+	// mock outbox repo with a message of an unknown kind
+	message := newMockOutboxMessage(1, 0)
+	message.Kind = "unknown"
+	mockOutboxRepo := new(MockOutboxRepo)
+	mockOutboxRepo.On("ClaimDueOutboxMessages", now, now.Add(-outboxClaimTimeout), outboxDeliveryBatchSize).
+		Return([]model.OutboxMessage{message}, nil).
+		Times(1)
+	mockOutboxRepo.On("UpdateOutboxMessage", mock.MatchedBy(func(message model.OutboxMessage) bool {
+		return message.Status == model.OutboxStatusPending && message.LastError == `unknown outbox message kind "unknown"`
+	})).
+		Return(nil).
+		Times(1)
+
+	mockEmailSender := new(MockEmailSender)
+	service := &Service{
+		outboxRepo:  mockOutboxRepo,
+		emailSender: mockEmailSender,
+	}
+	require.Error(t, service.deliverOutboxMessages(context.Background(), now))
+
+	mockOutboxRepo.AssertExpectations(t)
+	mockEmailSender.AssertNotCalled(t, "SendEmail")
+}
+
+func TestRetryDelay(t *testing.T) {
+	// delays double on every attempt, randomized by half of their value, up to an hour
+	require.InDelta(t, time.Minute, retryDelay(1), float64(30*time.Second))
+	require.InDelta(t, 8*time.Minute, retryDelay(4), float64(4*time.Minute))
+	require.InDelta(t, time.Hour, retryDelay(20), float64(30*time.Minute))
+}
+
+func TestListOutboxMessages(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	// mock outbox repo
+	mockOutboxRepo := new(MockOutboxRepo)
+	mockOutboxRepo.On("ListOutboxMessages", mock.MatchedBy(func(filter model.OutboxFilter) bool {
+		return filter.Status == model.OutboxStatusDead && *filter.ImportBatchID == "batch" && filter.Limit == 10
+	})).
+		Return([]model.OutboxMessage{newMockOutboxMessage(1, 5)}, nil).
+		Times(1)
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodGet, "/outbox?status=dead&import_batch_id=batch&limit=10", nil)
+
+	service := &Service{outboxRepo: mockOutboxRepo}
+	service.ListOutboxMessages(c)
+
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Contains(t, w.Body.String(), `"attempts":5`)
+}
+
+func TestListOutboxMessages_ErrorUnknownStatus(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodGet, "/outbox?status=lost", nil)
+
+	service := &Service{outboxRepo: new(MockOutboxRepo)}
+	service.ListOutboxMessages(c)
+
+	require.Equal(t, http.StatusBadRequest, w.Code)
+	require.Contains(t, w.Body.String(), invalidOutboxFilterErr)
+}
+
+func TestGetOutboxMessage_NotFound(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	// mock outbox repo without messages
+	mockOutboxRepo := new(MockOutboxRepo)
+	mockOutboxRepo.On("GetOutboxMessage", uint(7)).
+		Return((*model.OutboxMessage)(nil), gorm.ErrRecordNotFound).
+		Times(1)
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Params = gin.Params{{Key: "id", Value: "7"}}
+
+	service := &Service{outboxRepo: mockOutboxRepo}
+	service.GetOutboxMessage(c)
+
+	require.Equal(t, http.StatusNotFound, w.Code)
+	require.Contains(t, w.Body.String(), outboxMessageNotFoundErr)
+}
@@ -0,0 +1,340 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"github.com/mdcantarini/transaction-processor-api/pkg/converter"
+	"github.com/mdcantarini/transaction-processor-api/pkg/model"
+	"github.com/mdcantarini/transaction-processor-api/pkg/utils/email"
+)
+
+// ReportDefinitionRequest holds the fields of a report definition sent to create it, the dates of custom reports
+// are formatted like 2006-01-02
+type ReportDefinitionRequest struct {
+	Name   string  `json:"name"`
+	Period string  `json:"period"`
+	From   *string `json:"from"`
+	To     *string `json:"to"`
+}
+
+// definition validates the request, returning the report definition it describes
+func (rr ReportDefinitionRequest) definition() (*model.ReportDefinition, error) {
+	definition := &model.ReportDefinition{Name: strings.TrimSpace(rr.Name), Period: rr.Period}
+	if definition.Name == "" {
+		return nil, fmt.Errorf("name is required")
+	}
+
+	switch rr.Period {
+	case model.ReportPeriodDaily, model.ReportPeriodWeekly, model.ReportPeriodMonthly:
+		if rr.From != nil || rr.To != nil {
+			return nil, fmt.Errorf("only custom reports have a date range")
+		}
+
+		return definition, nil
+	case model.ReportPeriodCustom:
+	default:
+		return nil, fmt.Errorf("unknown period %q", rr.Period)
+	}
+
+	if rr.From == nil || rr.To == nil {
+		return nil, fmt.Errorf("custom reports require from and to dates")
+	}
+
+	from, err := time.Parse(time.DateOnly, *rr.From)
+	if err != nil {
+		return nil, fmt.Errorf("invalid from date %s", *rr.From)
+	}
+
+	to, err := time.Parse(time.DateOnly, *rr.To)
+	if err != nil {
+		return nil, fmt.Errorf("invalid to date %s", *rr.To)
+	}
+
+	if to.Before(from) {
+		return nil, fmt.Errorf("from date %s is after to date %s", *rr.From, *rr.To)
+	}
+
+	definition.From = &from
+	definition.To = &to
+
+	return definition, nil
+}
+
+// SubscriptionRequest holds the account subscribed to a report definition
+type SubscriptionRequest struct {
+	AccountID int `json:"account_id"`
+}
+
+// ReportRun is the outcome of a report run, the reports are built and delivered by the outbox worker. Emails only
+// lists the reports enqueued by the run.
+type ReportRun struct {
+	Report *model.ReportDefinition `json:"report"`
+	// PeriodFrom is the first date covered by the reports, PeriodUntil is the first date excluded
+	PeriodFrom  time.Time             `json:"period_from"`
+	PeriodUntil time.Time             `json:"period_until"`
+	Emails      []model.OutboxMessage `json:"emails"`
+}
+
+func (s *Service) CreateReportDefinition(c *gin.Context) {
+	var request ReportDefinitionRequest
+	err := c.ShouldBindJSON(&request)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("%s: %s", invalidReportDefinitionErr, err.Error())})
+		return
+	}
+
+	definition, err := request.definition()
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("%s: %s", invalidReportDefinitionErr, err.Error())})
+		return
+	}
+
+	err = s.ReportRepo().CreateReportDefinition(definition)
+	if err != nil {
+		if errors.Is(err, gorm.ErrDuplicatedKey) {
+			c.AbortWithStatusJSON(http.StatusConflict, gin.H{"error": fmt.Sprintf("%s: %s", createReportDefinitionErr, reportNameConflictErr)})
+			return
+		}
+
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("%s: %s", createReportDefinitionErr, err.Error())})
+		return
+	}
+
+	c.JSON(http.StatusCreated, definition)
+}
+
+func (s *Service) ListReportDefinitions(c *gin.Context) {
+	definitions, err := s.ReportRepo().ListReportDefinitions()
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("%s: %s", fetchReportDefinitionErr, err.Error())})
+		return
+	}
+
+	c.JSON(http.StatusOK, definitions)
+}
+
+func (s *Service) GetReportDefinition(c *gin.Context) {
+	definition, ok := s.reportDefinitionFromPath(c)
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, definition)
+}
+
+// SubscribeAccount subscribes an account to the report definition, subscribing it again does nothing
+func (s *Service) SubscribeAccount(c *gin.Context) {
+	definition, ok := s.reportDefinitionFromPath(c)
+	if !ok {
+		return
+	}
+
+	var request SubscriptionRequest
+	err := c.ShouldBindJSON(&request)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("%s: %s", subscribeAccountErr, err.Error())})
+		return
+	}
+
+	_, err = s.AccountRepo().GetAccount(request.AccountID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": accountNotFoundErr})
+			return
+		}
+
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("%s: %s", fetchAccountErr, err.Error())})
+		return
+	}
+
+	err = s.ReportRepo().Subscribe(definition.ID, request.AccountID)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("%s: %s", subscribeAccountErr, err.Error())})
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+func (s *Service) UnsubscribeAccount(c *gin.Context) {
+	definitionID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": reportDefinitionNotFoundErr})
+		return
+	}
+
+	accountID, err := strconv.Atoi(c.Param("accountId"))
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": subscriptionNotFoundErr})
+		return
+	}
+
+	err = s.ReportRepo().Unsubscribe(uint(definitionID), accountID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": subscriptionNotFoundErr})
+			return
+		}
+
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("%s: %s", unsubscribeAccountErr, err.Error())})
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// RunReport enqueues the report of every account subscribed to the definition, over the latest complete period
+// before the date query parameter, today by default
+func (s *Service) RunReport(c *gin.Context) {
+	definition, ok := s.reportDefinitionFromPath(c)
+	if !ok {
+		return
+	}
+
+	date := time.Now().UTC()
+	if c.Query("date") != "" {
+		var err error
+		date, err = time.Parse(time.DateOnly, c.Query("date"))
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("%s: invalid date %s", invalidReportRunErr, c.Query("date"))})
+			return
+		}
+	}
+
+	run, err := s.runReport(definition, date)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, run)
+}
+
+// runReport enqueues the report of every account subscribed to the definition, over the latest complete period
+// before the given date, unless it was already enqueued
+func (s *Service) runReport(definition *model.ReportDefinition, date time.Time) (*ReportRun, error) {
+	from, until, err := converter.ReportPeriodRange(*definition, date)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", invalidReportRunErr, err)
+	}
+
+	accountIDs, err := s.ReportRepo().ListSubscribedAccountIDs(definition.ID)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", enqueueEmailsErr, err)
+	}
+
+	messages := make([]model.OutboxMessage, 0, len(accountIDs))
+	for _, accountID := range accountIDs {
+		messages = append(messages, model.OutboxMessage{
+			Kind:               model.OutboxKindPeriodReport,
+			AccountID:          accountID,
+			ReportDefinitionID: &definition.ID,
+			PeriodFrom:         &from,
+			PeriodUntil:        &until,
+			Status:             model.OutboxStatusPending,
+			NextAttemptAt:      time.Now(),
+		})
+	}
+
+	// the reports already enqueued for the period are not enqueued again, so running the definition twice over
+	// the same period does not send them twice
+	enqueued, err := s.OutboxRepo().EnqueuePeriodReports(messages)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", enqueueEmailsErr, err)
+	}
+
+	return &ReportRun{Report: definition, PeriodFrom: from, PeriodUntil: until, Emails: enqueued}, nil
+}
+
+// buildPeriodReport builds the email with the opening balance, movements and closing balance of the account over
+// the period of the message, attaching the transactions of the period
+func (s *Service) buildPeriodReport(message *model.OutboxMessage, findRate converter.RateFinder) (*reportEmail, error) {
+	if message.ReportDefinitionID == nil || message.PeriodFrom == nil || message.PeriodUntil == nil {
+		return nil, fmt.Errorf("period report message %d without report definition or period", message.ID)
+	}
+
+	account, err := s.AccountRepo().GetAccount(message.AccountID)
+	if err != nil {
+		return nil, fmt.Errorf("unable to fetch account %d", message.AccountID)
+	}
+
+	definition, err := s.ReportRepo().GetReportDefinition(*message.ReportDefinitionID)
+	if err != nil {
+		return nil, fmt.Errorf("unable to fetch report definition %d", *message.ReportDefinitionID)
+	}
+
+	// the opening balance sums every transaction before the period
+	opening, err := s.summarizeAccount(s.TransactionRepo(), account, model.SummaryFilter{AccountID: account.ID, Until: message.PeriodFrom}, findRate)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", buildReportErr, err)
+	}
+
+	movements, err := s.summarizeAccount(s.TransactionRepo(), account, model.SummaryFilter{AccountID: account.ID, From: message.PeriodFrom, Until: message.PeriodUntil}, findRate)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", buildReportErr, err)
+	}
+
+	attachment, err := s.transactionsAttachment(account.ID, model.TransactionFilter{AccountID: &account.ID, From: message.PeriodFrom, Until: message.PeriodUntil})
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", buildReportErr, err)
+	}
+
+	view := converter.NewPeriodReportView(definition.Name, *message.PeriodFrom, *message.PeriodUntil, opening, movements, s.emailLogoURL)
+	body, err := s.renderPeriodReport(view)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", buildReportErr, err)
+	}
+
+	return &reportEmail{
+		To:          account.Email,
+		Subject:     fmt.Sprintf("%s for Account %d from %s to %s", definition.Name, account.ID, view.From, view.To),
+		Body:        body,
+		Attachments: []email.Attachment{attachment},
+	}, nil
+}
+
+// renderPeriodReport renders the HTML body of the period report along with its plain text alternative
+func (s *Service) renderPeriodReport(view converter.PeriodReportView) (email.Body, error) {
+	html, err := s.renderer().RenderPeriodHTML(view)
+	if err != nil {
+		return email.Body{}, err
+	}
+
+	text, err := s.renderer().RenderPeriodText(view)
+	if err != nil {
+		return email.Body{}, err
+	}
+
+	return email.Body{HTML: html, Text: text}, nil
+}
+
+// reportDefinitionFromPath fetches the report definition identified by the id path parameter, aborting the
+// request when it cannot be found
+func (s *Service) reportDefinitionFromPath(c *gin.Context) (*model.ReportDefinition, bool) {
+	definitionID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": reportDefinitionNotFoundErr})
+		return nil, false
+	}
+
+	definition, err := s.ReportRepo().GetReportDefinition(uint(definitionID))
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": reportDefinitionNotFoundErr})
+			return nil, false
+		}
+
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("%s: %s", fetchReportDefinitionErr, err.Error())})
+		return nil, false
+	}
+
+	return definition, true
+}
@@ -0,0 +1,312 @@
+package service
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+
+	"github.com/mdcantarini/transaction-processor-api/pkg/model"
+	"github.com/mdcantarini/transaction-processor-api/pkg/utils/email"
+)
+
+func newMockReportRepo() *MockReportRepo {
+	mockReportRepo := new(MockReportRepo)
+	mockReportRepo.On("GetReportDefinition", uint(1)).
+		Return(&model.ReportDefinition{ID: 1, Name: "Monthly statement", Period: model.ReportPeriodMonthly}, nil)
+
+	return mockReportRepo
+}
+
+func TestCreateReportDefinition_Success(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	// mock report repo
+	mockReportRepo := new(MockReportRepo)
+	mockReportRepo.On("CreateReportDefinition", mock.MatchedBy(func(definition *model.ReportDefinition) bool {
+		return definition.Name == "Year end" &&
+			definition.Period == model.ReportPeriodCustom &&
+			definition.From.Equal(time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)) &&
+			definition.To.Equal(time.Date(2023, 12, 31, 0, 0, 0, 0, time.UTC))
+	})).
+		Return(nil).
+		Times(1)
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodPost, "/reports", strings.NewReader(`{"name": " Year end ", "period": "custom", "from": "2023-01-01", "to": "2023-12-31"}`))
+
+	service := &Service{reportRepo: mockReportRepo}
+	service.CreateReportDefinition(c)
+
+	require.Equal(t, http.StatusCreated, w.Code)
+	require.Contains(t, w.Body.String(), `"name":"Year end"`)
+	mockReportRepo.AssertExpectations(t)
+}
+
+func TestCreateReportDefinition_ErrorInvalid(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	tests := []struct {
+		name    string
+		body    string
+		message string
+	}{
+		{"missing name", `{"period": "daily"}`, "name is required"},
+		{"unknown period", `{"name": "Yearly", "period": "yearly"}`, `unknown period \"yearly\"`},
+		{"custom without dates", `{"name": "Audit", "period": "custom", "from": "2023-01-01"}`, "custom reports require from and to dates"},
+		{"custom with dates reversed", `{"name": "Audit", "period": "custom", "from": "2023-12-31", "to": "2023-01-01"}`, "from date 2023-12-31 is after to date 2023-01-01"},
+		{"monthly with dates", `{"name": "Monthly", "period": "monthly", "to": "2023-01-01"}`, "only custom reports have a date range"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Request = httptest.NewRequest(http.MethodPost, "/reports", strings.NewReader(tt.body))
+
+			service := &Service{}
+			service.CreateReportDefinition(c)
+
+			require.Equal(t, http.StatusBadRequest, w.Code)
+			require.Contains(t, w.Body.String(), invalidReportDefinitionErr+": "+tt.message)
+		})
+	}
+}
+
+func TestCreateReportDefinition_ErrorNameInUse(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	// mock report repo with the name already in use
+	mockReportRepo := new(MockReportRepo)
+	mockReportRepo.On("CreateReportDefinition", mock.Anything).
+		Return(gorm.ErrDuplicatedKey).
+		Times(1)
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodPost, "/reports", strings.NewReader(`{"name": "Daily digest", "period": "daily"}`))
+
+	service := &Service{reportRepo: mockReportRepo}
+	service.CreateReportDefinition(c)
+
+	require.Equal(t, http.StatusConflict, w.Code)
+	require.Contains(t, w.Body.String(), reportNameConflictErr)
+}
+
+func TestSubscribeAccount_Success(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	// mock report repo
+	mockReportRepo := newMockReportRepo()
+	mockReportRepo.On("Subscribe", uint(1), 1).
+		Return(nil).
+		Times(1)
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodPost, "/reports/1/subscriptions", strings.NewReader(`{"account_id": 1}`))
+	c.Params = gin.Params{{Key: "id", Value: "1"}}
+
+	service := &Service{accountRepo: newMockAccountRepo(), reportRepo: mockReportRepo}
+	service.SubscribeAccount(c)
+
+	require.Equal(t, http.StatusNoContent, c.Writer.Status())
+	mockReportRepo.AssertExpectations(t)
+}
+
+func TestSubscribeAccount_ErrorAccountNotFound(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	// mock account repo without the account
+	mockAccountRepo := new(MockAccountRepo)
+	mockAccountRepo.On("GetAccount", 2).
+		Return((*model.Account)(nil), gorm.ErrRecordNotFound).
+		Times(1)
+
+	mockReportRepo := newMockReportRepo()
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodPost, "/reports/1/subscriptions", strings.NewReader(`{"account_id": 2}`))
+	c.Params = gin.Params{{Key: "id", Value: "1"}}
+
+	service := &Service{accountRepo: mockAccountRepo, reportRepo: mockReportRepo}
+	service.SubscribeAccount(c)
+
+	require.Equal(t, http.StatusNotFound, w.Code)
+	require.Contains(t, w.Body.String(), accountNotFoundErr)
+	mockReportRepo.AssertNotCalled(t, "Subscribe", mock.Anything, mock.Anything)
+}
+
+func TestUnsubscribeAccount_ErrorNotSubscribed(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	// mock report repo without the subscription
+	mockReportRepo := new(MockReportRepo)
+	mockReportRepo.On("Unsubscribe", uint(1), 2).
+		Return(gorm.ErrRecordNotFound).
+		Times(1)
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodDelete, "/reports/1/subscriptions/2", nil)
+	c.Params = gin.Params{{Key: "id", Value: "1"}, {Key: "accountId", Value: "2"}}
+
+	service := &Service{reportRepo: mockReportRepo}
+	service.UnsubscribeAccount(c)
+
+	require.Equal(t, http.StatusNotFound, w.Code)
+	require.Contains(t, w.Body.String(), subscriptionNotFoundErr)
+}
+
+func TestRunReport_Success(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	// mock report repo with two subscribed accounts
+	mockReportRepo := newMockReportRepo()
+	mockReportRepo.On("ListSubscribedAccountIDs", uint(1)).
+		Return([]int{1, 3}, nil).
+		Times(1)
+
+	// mock outbox repo, the monthly report run in January covers December
+	mockOutboxRepo := new(MockOutboxRepo)
+	mockOutboxRepo.On("EnqueuePeriodReports", mock.MatchedBy(func(messages []model.OutboxMessage) bool {
+		for _, message := range messages {
+			if message.Kind != model.OutboxKindPeriodReport ||
+				*message.ReportDefinitionID != 1 ||
+				!message.PeriodFrom.Equal(time.Date(2023, 12, 1, 0, 0, 0, 0, time.UTC)) ||
+				!message.PeriodUntil.Equal(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)) ||
+				message.Status != model.OutboxStatusPending {
+				return false
+			}
+		}
+
+		return len(messages) == 2 && messages[0].AccountID == 1 && messages[1].AccountID == 3
+	})).
+		Return([]model.OutboxMessage{{ID: 1, Kind: model.OutboxKindPeriodReport, AccountID: 1}, {ID: 2, Kind: model.OutboxKindPeriodReport, AccountID: 3}}, nil).
+		Times(1)
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodPost, "/reports/1/run?date=2024-01-15", nil)
+	c.Params = gin.Params{{Key: "id", Value: "1"}}
+
+	service := &Service{reportRepo: mockReportRepo, outboxRepo: mockOutboxRepo}
+	service.RunReport(c)
+
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Contains(t, w.Body.String(), `"period_from":"2023-12-01T00:00:00Z"`)
+	require.Contains(t, w.Body.String(), `"kind":"period_report"`)
+	mockOutboxRepo.AssertExpectations(t)
+}
+
+func TestRunReport_SkipsEnqueuedReports(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	// mock report repo with two subscribed accounts
+	mockReportRepo := newMockReportRepo()
+	mockReportRepo.On("ListSubscribedAccountIDs", uint(1)).
+		Return([]int{1, 3}, nil).
+		Times(1)
+
+	// mock outbox repo, the report of account 1 was already enqueued by a previous run over December
+	mockOutboxRepo := new(MockOutboxRepo)
+	mockOutboxRepo.On("EnqueuePeriodReports", mock.Anything).
+		Return([]model.OutboxMessage{{ID: 5, Kind: model.OutboxKindPeriodReport, AccountID: 3}}, nil).
+		Times(1)
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodPost, "/reports/1/run?date=2024-01-20", nil)
+	c.Params = gin.Params{{Key: "id", Value: "1"}}
+
+	service := &Service{reportRepo: mockReportRepo, outboxRepo: mockOutboxRepo}
+	service.RunReport(c)
+
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Contains(t, w.Body.String(), `"account_id":3`)
+	require.NotContains(t, w.Body.String(), `"account_id":1,`)
+	mockOutboxRepo.AssertExpectations(t)
+}
+
+func TestDeliverOutboxMessages_PeriodReport(t *testing.T) {
+	now := time.Date(2024, 1, 1, 8, 0, 0, 0, time.UTC)
+	from := time.Date(2023, 12, 1, 0, 0, 0, 0, time.UTC)
+	until := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	definitionID := uint(1)
+
+	// mock outbox repo with a due period report
+	mockOutboxRepo := new(MockOutboxRepo)
+	mockOutboxRepo.On("ClaimDueOutboxMessages", now, now.Add(-outboxClaimTimeout), outboxDeliveryBatchSize).
+		Return([]model.OutboxMessage{{
+			ID:                 1,
+			Kind:               model.OutboxKindPeriodReport,
+			AccountID:          1,
+			ReportDefinitionID: &definitionID,
+			PeriodFrom:         &from,
+			PeriodUntil:        &until,
+			Status:             model.OutboxStatusPending,
+		}}, nil).
+		Times(1)
+	mockOutboxRepo.On("UpdateOutboxMessage", mock.MatchedBy(func(message model.OutboxMessage) bool {
+		return message.Status == model.OutboxStatusSent
+	})).
+		Return(nil).
+		Times(1)
+
+	// mock transaction repo, the opening balance sums the transactions before the period
+	mockTransactionRepo := new(MockTransactionRepo)
+	mockTransactionRepo.On("SummarizeTransactions", mock.MatchedBy(func(filter model.SummaryFilter) bool {
+		return filter.From == nil && filter.Until.Equal(from)
+	})).
+		Return(&model.AccountSummary{
+			AccountID:   1,
+			Currencies:  []model.CurrencySummary{{Currency: "USD", CreditTotal: decimal.RequireFromString("100"), CreditCount: 1}},
+			DailyTotals: []model.DailyTotal{{Currency: "USD", Date: time.Date(2023, 11, 15, 0, 0, 0, 0, time.UTC), Total: decimal.RequireFromString("100")}},
+		}, nil).
+		Times(1)
+	mockTransactionRepo.On("SummarizeTransactions", mock.MatchedBy(func(filter model.SummaryFilter) bool {
+		return filter.From.Equal(from) && filter.Until.Equal(until)
+	})).
+		Return(&model.AccountSummary{
+			AccountID:   1,
+			Currencies:  []model.CurrencySummary{{Currency: "USD", CreditTotal: decimal.RequireFromString("60.5"), CreditCount: 1}},
+			DailyTotals: []model.DailyTotal{{Currency: "USD", Date: time.Date(2023, 12, 15, 0, 0, 0, 0, time.UTC), Total: decimal.RequireFromString("60.5")}},
+		}, nil).
+		Times(1)
+	mockTransactionRepo.On("ListTransactions", mock.MatchedBy(func(filter model.TransactionFilter) bool {
+		return *filter.AccountID == 1 && filter.From.Equal(from) && filter.Until.Equal(until) && filter.ImportBatchID == nil
+	})).
+		Return([]model.Transaction{}, nil).
+		Times(1)
+
+	// mock email sender
+	mockEmailSender := new(MockEmailSender)
+	body := mock.MatchedBy(func(body email.Body) bool {
+		return strings.Contains(body.HTML, "<p>Opening balance in USD: 100.00 USD</p>") &&
+			strings.Contains(body.Text, "Closing balance in USD: 160.50 USD")
+	})
+	mockEmailSender.On("SendEmail", "test@email.com", "Monthly statement for Account 1 from 2023-12-01 to 2023-12-31", body, mock.Anything).
+		Return(nil).
+		Times(1)
+
+	service := &Service{
+		accountRepo:     newMockAccountRepo(),
+		transactionRepo: mockTransactionRepo,
+		reportRepo:      newMockReportRepo(),
+		outboxRepo:      mockOutboxRepo,
+		emailSender:     mockEmailSender,
+	}
+	require.NoError(t, service.deliverOutboxMessages(context.Background(), now))
+
+	mockTransactionRepo.AssertExpectations(t)
+	mockEmailSender.AssertExpectations(t)
+}
@@ -0,0 +1,378 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"github.com/mdcantarini/transaction-processor-api/pkg/model"
+	"github.com/mdcantarini/transaction-processor-api/pkg/utils/cron"
+)
+
+const (
+	defaultSchedulerPollInterval = 30 * time.Second
+	// defaultScheduleClaimTimeout is the time after which a claim which was not renewed is considered left behind
+	// by a service which crashed, so the schedule can be claimed again. Claims are renewed while their run goes on,
+	// several times per timeout.
+	defaultScheduleClaimTimeout  = 15 * time.Minute
+	scheduleHeartbeatsPerTimeout = 4
+	// maxScheduleCatchUpRuns bounds the runs missed while the service was down which are caught up, the older
+	// ones are skipped
+	maxScheduleCatchUpRuns = 24
+)
+
+// ScheduleRequest holds the fields of a schedule sent to create it, its cron expression is evaluated in its
+// timezone, UTC by default
+type ScheduleRequest struct {
+	Name               string `json:"name"`
+	Cron               string `json:"cron"`
+	Timezone           string `json:"timezone"`
+	Target             string `json:"target"`
+	ReportDefinitionID *uint  `json:"report_definition_id"`
+}
+
+// schedule validates the request, returning the schedule it describes with its first run after the given time
+func (sr ScheduleRequest) schedule(now time.Time) (*model.Schedule, error) {
+	schedule := &model.Schedule{
+		Name:               strings.TrimSpace(sr.Name),
+		Cron:               strings.TrimSpace(sr.Cron),
+		Timezone:           sr.Timezone,
+		Target:             sr.Target,
+		ReportDefinitionID: sr.ReportDefinitionID,
+	}
+	if schedule.Name == "" {
+		return nil, fmt.Errorf("name is required")
+	}
+
+	if schedule.Timezone == "" {
+		schedule.Timezone = "UTC"
+	}
+
+	switch sr.Target {
+	case model.ScheduleTargetDailyReport:
+		if sr.ReportDefinitionID != nil {
+			return nil, fmt.Errorf("only report schedules have a report definition")
+		}
+	case model.ScheduleTargetReport:
+		if sr.ReportDefinitionID == nil {
+			return nil, fmt.Errorf("report schedules require a report definition")
+		}
+	default:
+		return nil, fmt.Errorf("unknown target %q", sr.Target)
+	}
+
+	var err error
+	schedule.NextRunAt, err = nextScheduleRun(schedule, now)
+	if err != nil {
+		return nil, err
+	}
+
+	return schedule, nil
+}
+
+func (s *Service) CreateSchedule(c *gin.Context) {
+	var request ScheduleRequest
+	err := c.ShouldBindJSON(&request)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("%s: %s", invalidScheduleErr, err.Error())})
+		return
+	}
+
+	schedule, err := request.schedule(time.Now())
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("%s: %s", invalidScheduleErr, err.Error())})
+		return
+	}
+
+	if schedule.ReportDefinitionID != nil {
+		_, err = s.ReportRepo().GetReportDefinition(*schedule.ReportDefinitionID)
+		if err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": reportDefinitionNotFoundErr})
+				return
+			}
+
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("%s: %s", fetchReportDefinitionErr, err.Error())})
+			return
+		}
+	}
+
+	err = s.ScheduleRepo().CreateSchedule(schedule)
+	if err != nil {
+		if errors.Is(err, gorm.ErrDuplicatedKey) {
+			c.AbortWithStatusJSON(http.StatusConflict, gin.H{"error": fmt.Sprintf("%s: %s", createScheduleErr, scheduleNameConflictErr)})
+			return
+		}
+
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("%s: %s", createScheduleErr, err.Error())})
+		return
+	}
+
+	c.JSON(http.StatusCreated, schedule)
+}
+
+func (s *Service) ListSchedules(c *gin.Context) {
+	schedules, err := s.ScheduleRepo().ListSchedules()
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("%s: %s", fetchScheduleErr, err.Error())})
+		return
+	}
+
+	c.JSON(http.StatusOK, schedules)
+}
+
+// RunScheduler runs the due schedules every poll interval until the context is done, waiting for the runs
+// already started before returning
+func (s *Service) RunScheduler(ctx context.Context) {
+	pollInterval := s.schedulerPollInterval
+	if pollInterval <= 0 {
+		pollInterval = defaultSchedulerPollInterval
+	}
+
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	for {
+		err := s.runDueSchedules(time.Now(), &wg)
+		if err != nil {
+			log.Printf("%s: %s", runScheduleErr, err.Error())
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// runDueSchedules claims every schedule due at the given time and runs it in the background, adding the runs to
+// the wait group. Schedules still claimed by a previous run are skipped, so runs of the same schedule never
+// overlap, even across services sharing the database.
+func (s *Service) runDueSchedules(now time.Time, wg *sync.WaitGroup) error {
+	schedules, err := s.ScheduleRepo().ListDueSchedules(now)
+	if err != nil {
+		return fmt.Errorf("%s: %w", fetchScheduleErr, err)
+	}
+
+	var errs []error
+	for i := range schedules {
+		schedule := &schedules[i]
+		claimed, err := s.ScheduleRepo().ClaimSchedule(schedule.ID, now, now.Add(-s.claimTimeout()))
+		if err != nil {
+			errs = append(errs, fmt.Errorf("unable to claim schedule %d: %w", schedule.ID, err))
+			continue
+		}
+		if !claimed {
+			continue
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := s.runSchedule(schedule, now)
+			if err != nil {
+				log.Printf("%s %d: %s", runScheduleErr, schedule.ID, err.Error())
+			}
+		}()
+	}
+
+	return errors.Join(errs...)
+}
+
+// runSchedule runs the activations of the claimed schedule due at the given time, oldest first, so the runs
+// missed while the service was down are caught up. Activations falling while a run is going overlap it and are
+// skipped. The outcome of every run is stored, and the claim is released once the schedule is caught up.
+func (s *Service) runSchedule(schedule *model.Schedule, now time.Time) error {
+	activations, skipped, err := dueActivations(schedule, now)
+	if err != nil {
+		// the schedule cannot run anymore, it is left due until it is fixed
+		schedule.RunningSince = nil
+		schedule.LastError = err.Error()
+		return errors.Join(err, s.ScheduleRepo().UpdateScheduleRun(schedule))
+	}
+	if skipped > 0 {
+		log.Printf("schedule %d: skipping %d missed runs before %s", schedule.ID, skipped, activations[0].Format(time.RFC3339))
+	}
+
+	var errs []error
+	for i, activation := range activations {
+		startedAt := time.Now()
+		runErr := s.runClaimedScheduleTarget(schedule, activation)
+		finishedAt := time.Now()
+
+		var next time.Time
+		if i+1 < len(activations) {
+			next = activations[i+1]
+		} else {
+			next, err = nextScheduleRun(schedule, activation)
+			if err == nil && next.After(startedAt) && next.Before(finishedAt) {
+				next, err = nextScheduleRun(schedule, finishedAt)
+			}
+		}
+		if err != nil {
+			// the schedule cannot run anymore, it is left due until it is fixed
+			schedule.RunningSince = nil
+			schedule.LastError = err.Error()
+			return errors.Join(append(errs, err, s.ScheduleRepo().UpdateScheduleRun(schedule))...)
+		}
+
+		schedule.LastRunAt = &startedAt
+		schedule.NextRunAt = next
+		schedule.LastError = ""
+		if runErr != nil {
+			schedule.LastError = runErr.Error()
+			errs = append(errs, fmt.Errorf("run at %s: %w", activation.Format(time.RFC3339), runErr))
+		}
+
+		// the claim is renewed while catching up
+		schedule.RunningSince = &finishedAt
+		if next.After(now) {
+			schedule.RunningSince = nil
+		}
+
+		err = s.ScheduleRepo().UpdateScheduleRun(schedule)
+		if err != nil {
+			// the schedule is left claimed until the claim times out, so the run is not repeated right away
+			return errors.Join(append(errs, fmt.Errorf("unable to update schedule %d: %w", schedule.ID, err))...)
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// dueActivations returns the activations of the schedule due at the given time, oldest first, along with the
+// number of older activations skipped. Only the latest maxScheduleCatchUpRuns activations are caught up, and
+// daily report schedules only run their latest activation, since every run imports the same transactions file.
+func dueActivations(schedule *model.Schedule, now time.Time) ([]time.Time, int, error) {
+	expression, loc, err := scheduleExpression(schedule)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	limit := maxScheduleCatchUpRuns
+	if schedule.Target == model.ScheduleTargetDailyReport {
+		limit = 1
+	}
+
+	var activations []time.Time
+	skipped := 0
+	for activation := schedule.NextRunAt; !activation.IsZero() && !activation.After(now); activation = expression.Next(activation.In(loc)) {
+		if len(activations) == limit {
+			activations = append(activations[:0], activations[1:]...)
+			skipped++
+		}
+		activations = append(activations, activation)
+	}
+
+	return activations, skipped, nil
+}
+
+// runClaimedScheduleTarget runs the target of the claimed schedule for the given activation, renewing the claim
+// while it runs, so long runs like large imports are not claimed and run again by another service
+func (s *Service) runClaimedScheduleTarget(schedule *model.Schedule, activation time.Time) error {
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		ticker := time.NewTicker(s.claimTimeout() / scheduleHeartbeatsPerTimeout)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-done:
+				return
+			case now := <-ticker.C:
+				err := s.ScheduleRepo().RenewScheduleClaim(schedule.ID, now)
+				if err != nil {
+					log.Printf("unable to renew the claim of schedule %d: %s", schedule.ID, err.Error())
+				}
+			}
+		}
+	}()
+
+	err := s.runScheduleTarget(schedule, activation)
+	close(done)
+	wg.Wait()
+
+	return err
+}
+
+// runScheduleTarget runs the target of the schedule for the given activation
+func (s *Service) runScheduleTarget(schedule *model.Schedule, activation time.Time) error {
+	switch schedule.Target {
+	case model.ScheduleTargetDailyReport:
+		_, err := s.runDailyReport()
+		return err
+	case model.ScheduleTargetReport:
+		if schedule.ReportDefinitionID == nil {
+			return fmt.Errorf("report schedule %d without report definition", schedule.ID)
+		}
+
+		definition, err := s.ReportRepo().GetReportDefinition(*schedule.ReportDefinitionID)
+		if err != nil {
+			return fmt.Errorf("%s: %w", fetchReportDefinitionErr, err)
+		}
+
+		loc, err := time.LoadLocation(schedule.Timezone)
+		if err != nil {
+			return fmt.Errorf("invalid timezone %s: %w", schedule.Timezone, err)
+		}
+
+		// the period covered by the report ends on the date of the activation in the timezone of the schedule
+		_, err = s.runReport(definition, activation.In(loc))
+		return err
+	}
+
+	return fmt.Errorf("unknown schedule target %q", schedule.Target)
+}
+
+// nextScheduleRun returns the first activation of the schedule after the given time, evaluated in its timezone
+func nextScheduleRun(schedule *model.Schedule, after time.Time) (time.Time, error) {
+	expression, loc, err := scheduleExpression(schedule)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	next := expression.Next(after.In(loc))
+	if next.IsZero() {
+		return time.Time{}, fmt.Errorf("cron expression %q never runs after %s", schedule.Cron, after.Format(time.RFC3339))
+	}
+
+	return next, nil
+}
+
+// scheduleExpression parses the cron expression of the schedule and loads its timezone
+func scheduleExpression(schedule *model.Schedule) (*cron.Schedule, *time.Location, error) {
+	expression, err := cron.Parse(schedule.Cron)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	loc, err := time.LoadLocation(schedule.Timezone)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid timezone %s: %w", schedule.Timezone, err)
+	}
+
+	return expression, loc, nil
+}
+
+func (s *Service) claimTimeout() time.Duration {
+	if s.scheduleClaimTimeout <= 0 {
+		return defaultScheduleClaimTimeout
+	}
+
+	return s.scheduleClaimTimeout
+}
@@ -0,0 +1,344 @@
+package service
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+
+	"github.com/mdcantarini/transaction-processor-api/pkg/model"
+)
+
+func TestCreateSchedule_Success(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	// mock report repo
+	mockReportRepo := newMockReportRepo()
+
+	// mock schedule repo, the first run is the next 6 AM on the first of a month in New York
+	mockScheduleRepo := new(MockScheduleRepo)
+	mockScheduleRepo.On("CreateSchedule", mock.MatchedBy(func(schedule *model.Schedule) bool {
+		loc, _ := time.LoadLocation("America/New_York")
+		next := schedule.NextRunAt.In(loc)
+		return schedule.Name == "Monthly statement" &&
+			schedule.Cron == "0 6 1 * *" &&
+			schedule.Timezone == "America/New_York" &&
+			schedule.Target == model.ScheduleTargetReport &&
+			*schedule.ReportDefinitionID == 1 &&
+			schedule.NextRunAt.After(time.Now()) &&
+			next.Day() == 1 && next.Hour() == 6 && next.Minute() == 0
+	})).
+		Return(nil).
+		Times(1)
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodPost, "/schedules", strings.NewReader(`{"name": "Monthly statement", "cron": "0 6 1 * *", "timezone": "America/New_York", "target": "report", "report_definition_id": 1}`))
+
+	service := &Service{reportRepo: mockReportRepo, scheduleRepo: mockScheduleRepo}
+	service.CreateSchedule(c)
+
+	require.Equal(t, http.StatusCreated, w.Code)
+	require.Contains(t, w.Body.String(), `"next_run_at"`)
+	mockScheduleRepo.AssertExpectations(t)
+}
+
+func TestCreateSchedule_ErrorInvalid(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	tests := []struct {
+		name    string
+		body    string
+		message string
+	}{
+		{"missing name", `{"cron": "@daily", "target": "daily_report"}`, "name is required"},
+		{"invalid cron", `{"name": "Daily", "cron": "0 25 * * *", "target": "daily_report"}`, `hour field \"25\" out of range 0-23`},
+		{"cron never runs", `{"name": "Daily", "cron": "0 0 30 2 *", "target": "daily_report"}`, `cron expression \"0 0 30 2 *\" never runs`},
+		{"unknown timezone", `{"name": "Daily", "cron": "@daily", "timezone": "Mars/Olympus", "target": "daily_report"}`, "invalid timezone Mars/Olympus"},
+		{"unknown target", `{"name": "Daily", "cron": "@daily", "target": "backup"}`, `unknown target \"backup\"`},
+		{"report without definition", `{"name": "Daily", "cron": "@daily", "target": "report"}`, "report schedules require a report definition"},
+		{"daily report with definition", `{"name": "Daily", "cron": "@daily", "target": "daily_report", "report_definition_id": 1}`, "only report schedules have a report definition"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Request = httptest.NewRequest(http.MethodPost, "/schedules", strings.NewReader(tt.body))
+
+			service := &Service{}
+			service.CreateSchedule(c)
+
+			require.Equal(t, http.StatusBadRequest, w.Code)
+			require.Contains(t, w.Body.String(), invalidScheduleErr)
+			require.Contains(t, w.Body.String(), tt.message)
+		})
+	}
+}
+
+func TestCreateSchedule_ErrorReportDefinitionNotFound(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	// mock report repo
+	mockReportRepo := new(MockReportRepo)
+	mockReportRepo.On("GetReportDefinition", uint(2)).
+		Return((*model.ReportDefinition)(nil), gorm.ErrRecordNotFound).
+		Times(1)
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodPost, "/schedules", strings.NewReader(`{"name": "Weekly", "cron": "@weekly", "target": "report", "report_definition_id": 2}`))
+
+	service := &Service{reportRepo: mockReportRepo, scheduleRepo: new(MockScheduleRepo)}
+	service.CreateSchedule(c)
+
+	require.Equal(t, http.StatusNotFound, w.Code)
+	require.Contains(t, w.Body.String(), reportDefinitionNotFoundErr)
+}
+
+// newMockDueSchedule returns a schedule of the report definition 1 due since the given time
+func newMockDueSchedule(cron, timezone string, nextRunAt time.Time) model.Schedule {
+	definitionID := uint(1)
+	return model.Schedule{
+		ID:                 7,
+		Name:               "Daily digest",
+		Cron:               cron,
+		Timezone:           timezone,
+		Target:             model.ScheduleTargetReport,
+		ReportDefinitionID: &definitionID,
+		NextRunAt:          nextRunAt,
+	}
+}
+
+// newMockRecordingScheduleRepo returns a schedule repo returning the given due schedule, which records the
+// schedule on every update
+func newMockRecordingScheduleRepo(now time.Time, schedule model.Schedule, updates *[]model.Schedule) *MockScheduleRepo {
+	mockScheduleRepo := new(MockScheduleRepo)
+	mockScheduleRepo.On("ListDueSchedules", now).
+		Return([]model.Schedule{schedule}, nil).
+		Times(1)
+	mockScheduleRepo.On("ClaimSchedule", schedule.ID, now, now.Add(-defaultScheduleClaimTimeout)).
+		Return(true, nil).
+		Times(1)
+	mockScheduleRepo.On("UpdateScheduleRun", mock.Anything).
+		Run(func(args mock.Arguments) {
+			*updates = append(*updates, *args.Get(0).(*model.Schedule))
+		}).
+		Return(nil)
+
+	return mockScheduleRepo
+}
+
+func TestRunDueSchedules_CatchesUpMissedRuns(t *testing.T) {
+	now := time.Date(2024, 1, 3, 7, 0, 0, 0, time.UTC)
+	// the service was down since the run of January 1st
+	schedule := newMockDueSchedule("0 6 * * *", "UTC", time.Date(2024, 1, 1, 6, 0, 0, 0, time.UTC))
+
+	// mock report repo with a daily report
+	mockReportRepo := new(MockReportRepo)
+	mockReportRepo.On("GetReportDefinition", uint(1)).
+		Return(&model.ReportDefinition{ID: 1, Name: "Daily digest", Period: model.ReportPeriodDaily}, nil)
+	mockReportRepo.On("ListSubscribedAccountIDs", uint(1)).
+		Return([]int{1}, nil)
+
+	// mock outbox repo, recording the period of every run
+	periods := []time.Time{}
+	mockOutboxRepo := new(MockOutboxRepo)
+	mockOutboxRepo.On("EnqueuePeriodReports", mock.Anything).
+		Run(func(args mock.Arguments) {
+			periods = append(periods, *args.Get(0).([]model.OutboxMessage)[0].PeriodFrom)
+		}).
+		Return([]model.OutboxMessage{}, nil)
+
+	// mock schedule repo
+	updates := []model.Schedule{}
+	mockScheduleRepo := newMockRecordingScheduleRepo(now, schedule, &updates)
+
+	service := &Service{reportRepo: mockReportRepo, outboxRepo: mockOutboxRepo, scheduleRepo: mockScheduleRepo}
+	var wg sync.WaitGroup
+	err := service.runDueSchedules(now, &wg)
+	wg.Wait()
+
+	require.NoError(t, err)
+	// every missed run reports its own day, oldest first
+	require.Equal(t, []time.Time{
+		time.Date(2023, 12, 31, 0, 0, 0, 0, time.UTC),
+		time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+		time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC),
+	}, periods)
+
+	require.Len(t, updates, 3)
+	for _, update := range updates[:2] {
+		require.NotNil(t, update.RunningSince)
+	}
+
+	last := updates[2]
+	require.True(t, last.NextRunAt.Equal(time.Date(2024, 1, 4, 6, 0, 0, 0, time.UTC)))
+	require.NotNil(t, last.LastRunAt)
+	require.Nil(t, last.RunningSince)
+	require.Empty(t, last.LastError)
+}
+
+func TestDueActivations_CapsCatchUp(t *testing.T) {
+	now := time.Date(2024, 3, 1, 7, 0, 0, 0, time.UTC)
+	// the service was down for two months
+	schedule := newMockDueSchedule("0 6 * * *", "UTC", time.Date(2024, 1, 1, 6, 0, 0, 0, time.UTC))
+
+	activations, skipped, err := dueActivations(&schedule, now)
+	require.NoError(t, err)
+
+	// only the latest runs are caught up
+	require.Len(t, activations, maxScheduleCatchUpRuns)
+	require.Equal(t, 61-maxScheduleCatchUpRuns, skipped)
+	require.True(t, activations[0].Equal(time.Date(2024, 2, 7, 6, 0, 0, 0, time.UTC)))
+	require.True(t, activations[maxScheduleCatchUpRuns-1].Equal(time.Date(2024, 3, 1, 6, 0, 0, 0, time.UTC)))
+}
+
+func TestDueActivations_DailyReportRunsOnce(t *testing.T) {
+	now := time.Date(2024, 1, 3, 7, 0, 0, 0, time.UTC)
+	schedule := newMockDueSchedule("*/5 * * * *", "UTC", time.Date(2024, 1, 1, 6, 0, 0, 0, time.UTC))
+	schedule.Target = model.ScheduleTargetDailyReport
+	schedule.ReportDefinitionID = nil
+
+	activations, skipped, err := dueActivations(&schedule, now)
+	require.NoError(t, err)
+
+	// every run imports the same file, so only the latest missed run is caught up
+	require.Equal(t, []time.Time{now}, activations)
+	require.Equal(t, 49*12, skipped)
+}
+
+func TestRunDueSchedules_RunsInTimezone(t *testing.T) {
+	now := time.Date(2024, 1, 2, 3, 30, 0, 0, time.UTC)
+	// 10 PM in New York is 3 AM on the next day in UTC
+	schedule := newMockDueSchedule("0 22 * * *", "America/New_York", time.Date(2024, 1, 2, 3, 0, 0, 0, time.UTC))
+
+	// mock report repo with a daily report
+	mockReportRepo := new(MockReportRepo)
+	mockReportRepo.On("GetReportDefinition", uint(1)).
+		Return(&model.ReportDefinition{ID: 1, Name: "Daily digest", Period: model.ReportPeriodDaily}, nil)
+	mockReportRepo.On("ListSubscribedAccountIDs", uint(1)).
+		Return([]int{1}, nil)
+
+	// mock outbox repo, the run on the evening of January 1st in New York reports December 31st
+	mockOutboxRepo := new(MockOutboxRepo)
+	mockOutboxRepo.On("EnqueuePeriodReports", mock.MatchedBy(func(messages []model.OutboxMessage) bool {
+		return messages[0].PeriodFrom.Equal(time.Date(2023, 12, 31, 0, 0, 0, 0, time.UTC))
+	})).
+		Return([]model.OutboxMessage{}, nil).
+		Times(1)
+
+	// mock schedule repo
+	updates := []model.Schedule{}
+	mockScheduleRepo := newMockRecordingScheduleRepo(now, schedule, &updates)
+
+	service := &Service{reportRepo: mockReportRepo, outboxRepo: mockOutboxRepo, scheduleRepo: mockScheduleRepo}
+	var wg sync.WaitGroup
+	err := service.runDueSchedules(now, &wg)
+	wg.Wait()
+
+	require.NoError(t, err)
+	require.Len(t, updates, 1)
+	require.True(t, updates[0].NextRunAt.Equal(time.Date(2024, 1, 3, 3, 0, 0, 0, time.UTC)))
+	mockOutboxRepo.AssertExpectations(t)
+}
+
+func TestRunDueSchedules_SkipsRunningSchedules(t *testing.T) {
+	now := time.Date(2024, 1, 3, 7, 0, 0, 0, time.UTC)
+	schedule := newMockDueSchedule("0 6 * * *", "UTC", time.Date(2024, 1, 3, 6, 0, 0, 0, time.UTC))
+
+	// mock schedule repo, the previous run still holds the schedule
+	mockScheduleRepo := new(MockScheduleRepo)
+	mockScheduleRepo.On("ListDueSchedules", now).
+		Return([]model.Schedule{schedule}, nil).
+		Times(1)
+	mockScheduleRepo.On("ClaimSchedule", uint(7), now, now.Add(-defaultScheduleClaimTimeout)).
+		Return(false, nil).
+		Times(1)
+
+	service := &Service{scheduleRepo: mockScheduleRepo}
+	var wg sync.WaitGroup
+	err := service.runDueSchedules(now, &wg)
+	wg.Wait()
+
+	require.NoError(t, err)
+	mockScheduleRepo.AssertExpectations(t)
+	mockScheduleRepo.AssertNotCalled(t, "UpdateScheduleRun", mock.Anything)
+}
+
+func TestRunDueSchedules_RecordsRunErrors(t *testing.T) {
+	now := time.Date(2024, 1, 3, 7, 0, 0, 0, time.UTC)
+	schedule := newMockDueSchedule("0 6 * * *", "UTC", time.Date(2024, 1, 3, 6, 0, 0, 0, time.UTC))
+
+	// mock report repo, subscriptions cannot be fetched
+	mockReportRepo := new(MockReportRepo)
+	mockReportRepo.On("GetReportDefinition", uint(1)).
+		Return(&model.ReportDefinition{ID: 1, Name: "Daily digest", Period: model.ReportPeriodDaily}, nil)
+	mockReportRepo.On("ListSubscribedAccountIDs", uint(1)).
+		Return([]int(nil), errors.New("connection refused"))
+
+	// mock schedule repo
+	updates := []model.Schedule{}
+	mockScheduleRepo := newMockRecordingScheduleRepo(now, schedule, &updates)
+
+	service := &Service{reportRepo: mockReportRepo, scheduleRepo: mockScheduleRepo}
+	var wg sync.WaitGroup
+	err := service.runDueSchedules(now, &wg)
+	wg.Wait()
+
+	// the failed run is not retried, the schedule moves on to its next run
+	require.NoError(t, err)
+	require.Len(t, updates, 1)
+	require.Equal(t, enqueueEmailsErr+": connection refused", updates[0].LastError)
+	require.True(t, updates[0].NextRunAt.Equal(time.Date(2024, 1, 4, 6, 0, 0, 0, time.UTC)))
+	require.Nil(t, updates[0].RunningSince)
+}
+
+func TestRunDueSchedules_RenewsClaimWhileRunning(t *testing.T) {
+	now := time.Date(2024, 1, 3, 7, 0, 0, 0, time.UTC)
+	schedule := newMockDueSchedule("0 6 * * *", "UTC", time.Date(2024, 1, 3, 6, 0, 0, 0, time.UTC))
+	claimTimeout := 40 * time.Millisecond
+
+	// mock report repo, the run takes longer than the claim timeout
+	mockReportRepo := new(MockReportRepo)
+	mockReportRepo.On("GetReportDefinition", uint(1)).
+		Return(&model.ReportDefinition{ID: 1, Name: "Daily digest", Period: model.ReportPeriodDaily}, nil)
+	mockReportRepo.On("ListSubscribedAccountIDs", uint(1)).
+		After(3*claimTimeout).
+		Return([]int{}, nil)
+
+	// mock outbox repo
+	mockOutboxRepo := new(MockOutboxRepo)
+	mockOutboxRepo.On("EnqueuePeriodReports", mock.Anything).Return([]model.OutboxMessage{}, nil)
+
+	// mock schedule repo, the claim is renewed before it times out
+	mockScheduleRepo := new(MockScheduleRepo)
+	mockScheduleRepo.On("ListDueSchedules", now).
+		Return([]model.Schedule{schedule}, nil).
+		Times(1)
+	mockScheduleRepo.On("ClaimSchedule", uint(7), now, now.Add(-claimTimeout)).
+		Return(true, nil).
+		Times(1)
+	mockScheduleRepo.On("RenewScheduleClaim", uint(7), mock.Anything).
+		Return(nil)
+	mockScheduleRepo.On("UpdateScheduleRun", mock.Anything).
+		Return(nil).
+		Times(1)
+
+	service := &Service{reportRepo: mockReportRepo, outboxRepo: mockOutboxRepo, scheduleRepo: mockScheduleRepo, scheduleClaimTimeout: claimTimeout}
+	var wg sync.WaitGroup
+	err := service.runDueSchedules(now, &wg)
+	wg.Wait()
+
+	require.NoError(t, err)
+	mockScheduleRepo.AssertExpectations(t)
+	mockScheduleRepo.AssertCalled(t, "RenewScheduleClaim", uint(7), mock.Anything)
+}
@@ -1,9 +1,13 @@
 package service
 
 import (
+	"bytes"
 	"fmt"
 	"net/http"
 	"os"
+	"path/filepath"
+	"strconv"
+	"time"
 
 	"github.com/gin-gonic/gin"
 
@@ -16,7 +20,32 @@ import (
 type Service struct {
 	accountRepo     model.IAccount
 	transactionRepo model.ITransaction
+	importBatchRepo model.IImportBatch
+	fxRateRepo      model.IFXRate
+	outboxRepo      model.IOutbox
 	emailSender     email.EmailSender
+	// emailLimiter enforces the rate limit of the email provider, shared by every delivery worker
+	emailLimiter    *email.RateLimiter
+	emailWorkers    int
+	importsDir      string
+	mappingProfiles map[string]converter.MappingProfile
+	insertBatchSize int
+	// bulkLoadThreshold is the file size in bytes from which imports use the COPY protocol
+	bulkLoadThreshold int64
+	// attachmentFormat is the export format of the transactions attached to the reports, CSV by default
+	attachmentFormat string
+	// reportRenderer renders the report emails, with the embedded templates when nil
+	reportRenderer *converter.ReportRenderer
+	emailLogoURL   string
+	reportRepo     model.IReport
+	scheduleRepo   model.ISchedule
+	// outboxMaxAttempts is the number of delivery attempts after which an email is dead-lettered
+	outboxMaxAttempts  int
+	outboxPollInterval time.Duration
+	// schedulerPollInterval is the interval between checks of the due schedules
+	schedulerPollInterval time.Duration
+	// scheduleClaimTimeout is the time after which the claim of a schedule which was not renewed expires
+	scheduleClaimTimeout time.Duration
 }
 
 func (s *Service) AccountRepo() model.IAccount {
@@ -27,91 +56,462 @@ func (s *Service) TransactionRepo() model.ITransaction {
 	return s.transactionRepo
 }
 
+func (s *Service) ImportBatchRepo() model.IImportBatch {
+	return s.importBatchRepo
+}
+
+func (s *Service) FXRateRepo() model.IFXRate {
+	return s.fxRateRepo
+}
+
+func (s *Service) OutboxRepo() model.IOutbox {
+	return s.outboxRepo
+}
+
+func (s *Service) ReportRepo() model.IReport {
+	return s.reportRepo
+}
+
+func (s *Service) ScheduleRepo() model.ISchedule {
+	return s.scheduleRepo
+}
+
 func NewService() *Service {
 	db := utils.MustCreateDBConnection()
 
+	mappingProfiles, err := converter.LoadMappingProfiles(os.Getenv("MAPPING_PROFILES_PATH"))
+	if err != nil {
+		panic(err)
+	}
+
+	insertBatchSize := defaultInsertBatchSize
+	if os.Getenv("IMPORT_BATCH_SIZE") != "" {
+		insertBatchSize, err = strconv.Atoi(os.Getenv("IMPORT_BATCH_SIZE"))
+		if err != nil {
+			panic(err)
+		}
+	}
+
+	var bulkLoadThreshold int64 = defaultBulkLoadThreshold
+	if os.Getenv("BULK_LOAD_THRESHOLD_BYTES") != "" {
+		bulkLoadThreshold, err = strconv.ParseInt(os.Getenv("BULK_LOAD_THRESHOLD_BYTES"), 10, 64)
+		if err != nil {
+			panic(err)
+		}
+	}
+
+	attachmentFormat := converter.ExportFormatCSV
+	if os.Getenv("REPORT_ATTACHMENT_FORMAT") != "" {
+		attachmentFormat = os.Getenv("REPORT_ATTACHMENT_FORMAT")
+		err = converter.ValidateExportFormat(attachmentFormat)
+		if err != nil {
+			panic(err)
+		}
+	}
+
+	reportRenderer, err := converter.NewReportRenderer(os.Getenv("EMAIL_TEMPLATES_DIR"))
+	if err != nil {
+		panic(err)
+	}
+
+	outboxMaxAttempts := defaultOutboxMaxAttempts
+	if os.Getenv("OUTBOX_MAX_ATTEMPTS") != "" {
+		outboxMaxAttempts, err = strconv.Atoi(os.Getenv("OUTBOX_MAX_ATTEMPTS"))
+		if err != nil {
+			panic(err)
+		}
+	}
+
+	outboxPollInterval := defaultOutboxPollInterval
+	if os.Getenv("OUTBOX_POLL_INTERVAL") != "" {
+		outboxPollInterval, err = time.ParseDuration(os.Getenv("OUTBOX_POLL_INTERVAL"))
+		if err != nil {
+			panic(err)
+		}
+	}
+
+	schedulerPollInterval := defaultSchedulerPollInterval
+	if os.Getenv("SCHEDULER_POLL_INTERVAL") != "" {
+		schedulerPollInterval, err = time.ParseDuration(os.Getenv("SCHEDULER_POLL_INTERVAL"))
+		if err != nil {
+			panic(err)
+		}
+	}
+
+	scheduleClaimTimeout := defaultScheduleClaimTimeout
+	if os.Getenv("SCHEDULE_CLAIM_TIMEOUT") != "" {
+		scheduleClaimTimeout, err = time.ParseDuration(os.Getenv("SCHEDULE_CLAIM_TIMEOUT"))
+		if err != nil {
+			panic(err)
+		}
+	}
+
+	emailSender, emailLimiter := mustCreateEmailSender()
+
+	emailWorkers := defaultEmailWorkers
+	if os.Getenv("EMAIL_WORKERS") != "" {
+		emailWorkers, err = strconv.Atoi(os.Getenv("EMAIL_WORKERS"))
+		if err != nil {
+			panic(err)
+		}
+	}
+
 	return &Service{
-		transactionRepo: model.TransactionRepository{DB: db},
-		accountRepo:     model.AccountRepository{DB: db},
-		emailSender: email.Mailtrap{
+		transactionRepo:       model.TransactionRepository{DB: db},
+		accountRepo:           model.AccountRepository{DB: db},
+		importBatchRepo:       model.ImportBatchRepository{DB: db},
+		fxRateRepo:            model.FXRateRepository{DB: db},
+		outboxRepo:            model.OutboxRepository{DB: db},
+		reportRepo:            model.ReportRepository{DB: db},
+		scheduleRepo:          model.ScheduleRepository{DB: db},
+		emailSender:           emailSender,
+		emailLimiter:          emailLimiter,
+		emailWorkers:          emailWorkers,
+		importsDir:            os.Getenv("IMPORTS_DIR"),
+		mappingProfiles:       mappingProfiles,
+		insertBatchSize:       insertBatchSize,
+		bulkLoadThreshold:     bulkLoadThreshold,
+		attachmentFormat:      attachmentFormat,
+		reportRenderer:        reportRenderer,
+		emailLogoURL:          os.Getenv("EMAIL_LOGO_URL"),
+		outboxMaxAttempts:     outboxMaxAttempts,
+		outboxPollInterval:    outboxPollInterval,
+		schedulerPollInterval: schedulerPollInterval,
+		scheduleClaimTimeout:  scheduleClaimTimeout,
+	}
+}
+
+const (
+	emailProviderMailtrap = "mailtrap"
+	emailProviderSMTP     = "smtp"
+)
+
+// mustCreateEmailSender returns the email sender of the provider selected by EMAIL_PROVIDER, Mailtrap by default,
+// along with the rate limiter configured for the provider
+func mustCreateEmailSender() (email.EmailSender, *email.RateLimiter) {
+	switch os.Getenv("EMAIL_PROVIDER") {
+	case "", emailProviderMailtrap:
+		return email.Mailtrap{
 			FromEmail: os.Getenv("MAILTRAP_FROM_EMAIL"),
 			Host:      os.Getenv("MAILTRAP_HOST"),
 			Token:     os.Getenv("MAILTRAP_TOKEN"),
-		},
+		}, mustCreateRateLimiter("MAILTRAP_RATE_LIMIT")
+	case emailProviderSMTP:
+		port, err := strconv.Atoi(os.Getenv("SMTP_PORT"))
+		if err != nil {
+			panic(fmt.Errorf("invalid SMTP_PORT: %w", err))
+		}
+
+		sender := email.SMTP{
+			FromEmail: os.Getenv("SMTP_FROM_EMAIL"),
+			Host:      os.Getenv("SMTP_HOST"),
+			Port:      port,
+			Username:  os.Getenv("SMTP_USERNAME"),
+			Password:  os.Getenv("SMTP_PASSWORD"),
+			Security:  os.Getenv("SMTP_SECURITY"),
+			Auth:      os.Getenv("SMTP_AUTH"),
+		}
+		err = sender.Validate()
+		if err != nil {
+			panic(err)
+		}
+
+		return sender, mustCreateRateLimiter("SMTP_RATE_LIMIT")
 	}
+
+	panic(fmt.Errorf("unknown email provider %q", os.Getenv("EMAIL_PROVIDER")))
+}
+
+// mustCreateRateLimiter returns the rate limiter allowing the emails per second set in the given environment
+// variable, emails are not limited when it is empty
+func mustCreateRateLimiter(envName string) *email.RateLimiter {
+	if os.Getenv(envName) == "" {
+		return nil
+	}
+
+	perSecond, err := strconv.ParseFloat(os.Getenv(envName), 64)
+	if err != nil {
+		panic(fmt.Errorf("invalid %s: %w", envName, err))
+	}
+
+	return email.NewRateLimiter(perSecond)
+}
+
+// mappingProfile returns the mapping profile registered under the given name, the default profile
+// is always available
+func (s *Service) mappingProfile(name string) (converter.MappingProfile, bool) {
+	profile, ok := s.mappingProfiles[name]
+	if !ok && name == converter.DefaultMappingProfileName {
+		return converter.DefaultMappingProfile, true
+	}
+
+	return profile, ok
 }
 
 const (
-	parseCSVErr              = `unable to parse csv file`
-	transactionConversionErr = `unable to convert csv records to transactions`
-	insertTransactionErr     = `unable to insert transactions`
-	sendEmailErr             = `unable to send daily report by email`
+	parseCSVErr                 = `unable to parse csv file`
+	transactionConversionErr    = `unable to convert csv records to transactions`
+	insertTransactionErr        = `unable to insert transactions`
+	sendEmailErr                = `unable to send daily report by email`
+	missingFileErr              = `missing transactions file`
+	saveFileErr                 = `unable to save transactions file`
+	generateImportIDErr         = `unable to generate import id`
+	hashFileErr                 = `unable to compute file checksum`
+	createImportBatchErr        = `unable to create import batch`
+	updateImportBatchErr        = `unable to update import batch`
+	fetchImportBatchErr         = `unable to fetch import batch`
+	importBatchNotFoundErr      = `import batch not found`
+	invalidLimitErr             = `invalid limit`
+	invalidImportModeErr        = `invalid import mode`
+	unknownMappingProfileErr    = `unknown mapping profile`
+	parseFileErr                = `unable to parse transactions file`
+	fetchAccountErr             = `unable to fetch account`
+	writeRejectsErr             = `unable to write rejected rows file`
+	noRejectsErr                = `import batch has no rejected rows`
+	parseFXRatesErr             = `unable to parse fx rates file`
+	upsertFXRatesErr            = `unable to store fx rates`
+	fetchFXRateErr              = `unable to fetch fx rate`
+	buildReportErr              = `unable to build report`
+	invalidOffsetErr            = `invalid offset`
+	invalidAccountErr           = `invalid account`
+	accountNotFoundErr          = `account not found`
+	createAccountErr            = `unable to create account`
+	updateAccountErr            = `unable to update account`
+	deleteAccountErr            = `unable to delete account`
+	accountConflictErr          = `email or bank account already in use`
+	accountInUseErr             = `account has transactions`
+	invalidTransactionFilterErr = `invalid transaction filter`
+	fetchTransactionsErr        = `unable to fetch transactions`
+	transactionNotFoundErr      = `transaction not found`
+	invalidSummaryFilterErr     = `invalid summary filter`
+	summarizeAccountErr         = `unable to summarize account`
+	exportTransactionsErr       = `unable to export transactions`
+	enqueueEmailsErr            = `unable to enqueue report emails`
+	fetchOutboxMessageErr       = `unable to fetch outbox messages`
+	outboxMessageNotFoundErr    = `outbox message not found`
+	invalidOutboxFilterErr      = `invalid outbox filter`
+	invalidPreviewErr           = `invalid report preview`
+	noImportedTransactionsErr   = `no transactions of the account were imported`
+	invalidReportDefinitionErr  = `invalid report definition`
+	createReportDefinitionErr   = `unable to create report definition`
+	reportNameConflictErr       = `report name already in use`
+	fetchReportDefinitionErr    = `unable to fetch report definitions`
+	reportDefinitionNotFoundErr = `report definition not found`
+	subscribeAccountErr         = `unable to subscribe account`
+	unsubscribeAccountErr       = `unable to unsubscribe account`
+	subscriptionNotFoundErr     = `subscription not found`
+	invalidReportRunErr         = `invalid report run`
+	invalidScheduleErr          = `invalid schedule`
+	createScheduleErr           = `unable to create schedule`
+	scheduleNameConflictErr     = `schedule name already in use`
+	fetchScheduleErr            = `unable to fetch schedules`
+	runScheduleErr              = `unable to run schedule`
 )
 
+// DailyReportResult is the outcome of a daily report run, the reports are built and delivered by the outbox
+// worker
+type DailyReportResult struct {
+	ImportBatch *model.ImportBatch    `json:"import"`
+	Emails      []model.OutboxMessage `json:"emails"`
+}
+
 func (s *Service) RunDailyReport(c *gin.Context) {
+	result, err := s.runDailyReport()
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, result)
+}
+
+// runDailyReport imports the transactions file, enqueueing the daily report of every account with transactions
+// inserted by the import
+func (s *Service) runDailyReport() (*DailyReportResult, error) {
 	filePath := os.Getenv("TRANSACTIONS_FILE_PATH")
 
-	records, err := utils.ParseCSVFile(filePath)
+	importID, err := utils.GenerateID()
 	if err != nil {
-		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("%s: %s", parseCSVErr, err.Error())})
-		return
+		return nil, fmt.Errorf("%s: %w", generateImportIDErr, err)
+	}
+
+	batch := &model.ImportBatch{
+		ID:             importID,
+		FileName:       filepath.Base(filePath),
+		Mode:           model.ImportModeStrict,
+		MappingProfile: converter.DefaultMappingProfileName,
+	}
+	// the reports are enqueued within the import database transaction, so they are only delivered when
+	// the transactions they report are committed
+	var emails []model.OutboxMessage
+	beforeCommit := func(repo model.ITransaction) error {
+		emails, err = enqueueDailyReports(repo, batch.ID)
+		return err
 	}
 
-	transactions, err := converter.CSVRecordsToTransactions(records)
+	_, err = s.importTransactionsFile(batch, filePath, beforeCommit)
 	if err != nil {
-		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("%s: %s", transactionConversionErr, err.Error())})
-		return
+		return nil, err
 	}
 
-	err = s.TransactionRepo().UpsertTransactions(transactions)
+	return &DailyReportResult{ImportBatch: batch, Emails: emails}, nil
+}
+
+// enqueueDailyReports enqueues the daily report of every account with transactions inserted by the import
+// batch, so importing the same file again does not send the reports again. The given repository must belong
+// to the import database transaction.
+func enqueueDailyReports(repo model.ITransaction, importBatchID string) ([]model.OutboxMessage, error) {
+	accountIDs, err := repo.ListImportedAccountIDs(importBatchID)
 	if err != nil {
-		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("%s: %s", insertTransactionErr, err.Error())})
-		return
+		return nil, fmt.Errorf("%s: %w", enqueueEmailsErr, err)
 	}
 
-	err = s.sendDailyReportByEmail(transactions)
+	messages := make([]model.OutboxMessage, 0, len(accountIDs))
+	for _, accountID := range accountIDs {
+		messages = append(messages, model.OutboxMessage{
+			Kind:          model.OutboxKindDailyReport,
+			ImportBatchID: &importBatchID,
+			AccountID:     accountID,
+			Status:        model.OutboxStatusPending,
+			NextAttemptAt: time.Now(),
+		})
+	}
+
+	err = repo.OutboxRepo().EnqueueOutboxMessages(messages)
 	if err != nil {
-		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("%s: %s", sendEmailErr, err.Error())})
-		return
+		return nil, fmt.Errorf("%s: %w", enqueueEmailsErr, err)
 	}
 
-	c.JSON(http.StatusOK, nil)
+	return messages, nil
 }
 
-func (s *Service) sendDailyReportByEmail(txs []model.Transaction) error {
-	transactionsByAccount := groupTransactionsByAccount(txs)
+// reportEmail is the content of a report email, ready to be sent
+type reportEmail struct {
+	To          string
+	Subject     string
+	Body        email.Body
+	Attachments []email.Attachment
+}
 
-	for accountID, transactions := range transactionsByAccount {
-		account, err := s.AccountRepo().GetAccount(accountID)
-		if err != nil {
-			return fmt.Errorf("unable to fetch account %d", accountID)
-		}
+// buildDailyReport builds the email with the summary of the whole account history, along with the summary of
+// the transactions inserted by the import batch. Only the transactions of the account inserted by the import
+// batch are attached.
+func (s *Service) buildDailyReport(accountID int, importBatchID string, findRate converter.RateFinder) (*reportEmail, error) {
+	account, err := s.AccountRepo().GetAccount(accountID)
+	if err != nil {
+		return nil, fmt.Errorf("unable to fetch account %d", accountID)
+	}
 
-		to := account.Email
-		subject := fmt.Sprintf("Daily report for Account %d", accountID)
-		body := converter.TransactionsToEmailTemplate(transactions)
-		attachment := os.Getenv("TRANSACTIONS_FILE_PATH")
+	view, err := s.dailyReportView(account, importBatchID, findRate)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", buildReportErr, err)
+	}
 
-		err = s.emailSender.SendEmail(to, subject, body, attachment)
-		if err != nil {
-			fmt.Println("unable to send email:", err.Error())
-			return err
-		}
+	attachment, err := s.transactionsAttachment(accountID, model.TransactionFilter{AccountID: &accountID, ImportBatchID: &importBatchID})
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", buildReportErr, err)
 	}
 
-	return nil
+	body, err := s.renderReport(view)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", buildReportErr, err)
+	}
+
+	return &reportEmail{
+		To:          account.Email,
+		Subject:     fmt.Sprintf("Daily report for Account %d", accountID),
+		Body:        body,
+		Attachments: []email.Attachment{attachment},
+	}, nil
+}
+
+// dailyReportView summarizes the whole history of the account along with the transactions inserted by the import
+// batch, it is shared by the daily report emails and their preview so both always agree
+func (s *Service) dailyReportView(account *model.Account, importBatchID string, findRate converter.RateFinder) (converter.ReportView, error) {
+	// the stored history already includes the transactions of the import batch
+	historyFilter := model.SummaryFilter{AccountID: account.ID}
+	latestFilter := model.SummaryFilter{AccountID: account.ID, ImportBatchID: &importBatchID}
+
+	return s.reportView(account, historyFilter, latestFilter, findRate)
+}
+
+// reportView summarizes the history and the new transactions of the account matching the given filters into
+// the view the report is rendered with
+func (s *Service) reportView(account *model.Account, historyFilter, latestFilter model.SummaryFilter, findRate converter.RateFinder) (converter.ReportView, error) {
+	history, err := s.summarizeAccount(s.TransactionRepo(), account, historyFilter, findRate)
+	if err != nil {
+		return converter.ReportView{}, err
+	}
+
+	latest, err := s.summarizeAccount(s.TransactionRepo(), account, latestFilter, findRate)
+	if err != nil {
+		return converter.ReportView{}, err
+	}
+
+	return converter.NewReportView(history, latest, s.emailLogoURL), nil
+}
+
+// renderReport renders the HTML body of the report along with its plain text alternative
+func (s *Service) renderReport(view converter.ReportView) (email.Body, error) {
+	html, err := s.renderer().RenderHTML(view)
+	if err != nil {
+		return email.Body{}, err
+	}
+
+	text, err := s.renderer().RenderText(view)
+	if err != nil {
+		return email.Body{}, err
+	}
+
+	return email.Body{HTML: html, Text: text}, nil
+}
+
+// renderer returns the configured report renderer, or the one of the embedded templates
+func (s *Service) renderer() *converter.ReportRenderer {
+	if s.reportRenderer == nil {
+		return converter.DefaultReportRenderer()
+	}
+
+	return s.reportRenderer
 }
 
-func groupTransactionsByAccount(txs []model.Transaction) map[int][]model.Transaction {
-	result := map[int][]model.Transaction{}
+// exportPageSize is the number of transactions fetched per query while exporting them
+const exportPageSize = 500
 
-	for _, tx := range txs {
-		if _, ok := result[tx.AccountID]; !ok {
-			result[tx.AccountID] = []model.Transaction{}
+// transactionsAttachment exports the transactions of the account matching the filter into an in-memory file in
+// the configured attachment format
+func (s *Service) transactionsAttachment(accountID int, filter model.TransactionFilter) (email.Attachment, error) {
+	format := s.attachmentFormat
+	if format == "" {
+		format = converter.ExportFormatCSV
+	}
+
+	transactions := []model.Transaction{}
+	filter.Limit = exportPageSize
+	for {
+		page, err := s.TransactionRepo().ListTransactions(filter)
+		if err != nil {
+			return email.Attachment{}, fmt.Errorf("%s: %w", fetchTransactionsErr, err)
+		}
+
+		transactions = append(transactions, page...)
+		if len(page) < exportPageSize {
+			break
 		}
 
-		result[tx.AccountID] = append(result[tx.AccountID], tx)
+		last := page[len(page)-1]
+		filter.After = &model.TransactionCursor{Date: last.Date, TransactionID: last.TransactionID}
+	}
+
+	var content bytes.Buffer
+	err := converter.ExportTransactions(&content, format, transactions)
+	if err != nil {
+		return email.Attachment{}, fmt.Errorf("%s: %w", exportTransactionsErr, err)
 	}
 
-	return result
+	return email.Attachment{
+		FileName:    fmt.Sprintf("transactions-account-%d.%s", accountID, format),
+		ContentType: converter.ExportContentType(format),
+		Content:     content.Bytes(),
+	}, nil
 }
@@ -4,27 +4,93 @@ import (
 	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/shopspring/decimal"
 	"github.com/stretchr/testify/mock"
 	"github.com/stretchr/testify/require"
 
-	"github.com/mdcantarini/transaction-processor-api/pkg/converter"
 	"github.com/mdcantarini/transaction-processor-api/pkg/model"
-	"github.com/mdcantarini/transaction-processor-api/pkg/utils"
+	"github.com/mdcantarini/transaction-processor-api/pkg/utils/email"
 )
 
 type MockTransactionRepo struct {
 	mock.Mock
 }
 
-func (m *MockTransactionRepo) UpsertTransactions(transactions []model.Transaction) error {
-	args := m.Called(transactions)
+func (m *MockTransactionRepo) UpsertTransactions(transactions []model.Transaction) (int, error) {
+	// the service reuses the slice between calls, so a copy is recorded
+	args := m.Called(append([]model.Transaction(nil), transactions...))
+	return args.Int(0), args.Error(1)
+}
+
+func (m *MockTransactionRepo) BulkLoadTransactions(transactions []model.Transaction) (int, error) {
+	args := m.Called(append([]model.Transaction(nil), transactions...))
+	return args.Int(0), args.Error(1)
+}
+
+func (m *MockTransactionRepo) RunInDBTransaction(fn func(repo model.ITransaction) error) error {
+	return fn(m)
+}
+
+func (m *MockTransactionRepo) OutboxRepo() model.IOutbox {
+	args := m.Called()
+	return args.Get(0).(model.IOutbox)
+}
+
+func (m *MockTransactionRepo) ListTransactions(filter model.TransactionFilter) ([]model.Transaction, error) {
+	args := m.Called(filter)
+	return args.Get(0).([]model.Transaction), args.Error(1)
+}
+
+func (m *MockTransactionRepo) GetTransaction(transactionID int) (*model.Transaction, error) {
+	args := m.Called(transactionID)
+	return args.Get(0).(*model.Transaction), args.Error(1)
+}
+
+func (m *MockTransactionRepo) ListImportedAccountIDs(importBatchID string) ([]int, error) {
+	args := m.Called(importBatchID)
+	return args.Get(0).([]int), args.Error(1)
+}
+
+func (m *MockTransactionRepo) LatestImportBatchID(accountID int, until *time.Time) (string, error) {
+	args := m.Called(accountID, until)
+	return args.String(0), args.Error(1)
+}
+
+func (m *MockTransactionRepo) SummarizeTransactions(filter model.SummaryFilter) (*model.AccountSummary, error) {
+	args := m.Called(filter)
+	return args.Get(0).(*model.AccountSummary), args.Error(1)
+}
+
+type MockImportBatchRepo struct {
+	mock.Mock
+}
+
+func (m *MockImportBatchRepo) CreateImportBatch(batch *model.ImportBatch) error {
+	args := m.Called(batch)
 	return args.Error(0)
 }
 
+func (m *MockImportBatchRepo) UpdateImportBatch(batch *model.ImportBatch) error {
+	args := m.Called(batch)
+	return args.Error(0)
+}
+
+func (m *MockImportBatchRepo) GetImportBatch(batchID string) (*model.ImportBatch, error) {
+	args := m.Called(batchID)
+	return args.Get(0).(*model.ImportBatch), args.Error(1)
+}
+
+func (m *MockImportBatchRepo) ListImportBatches(limit int) ([]model.ImportBatch, error) {
+	args := m.Called(limit)
+	return args.Get(0).([]model.ImportBatch), args.Error(1)
+}
+
 type MockAccountRepo struct {
 	mock.Mock
 }
@@ -34,67 +100,259 @@ func (m *MockAccountRepo) GetAccount(accountID int) (*model.Account, error) {
 	return args.Get(0).(*model.Account), args.Error(1)
 }
 
+func (m *MockAccountRepo) GetAccountByBankAccount(bankAccount string) (*model.Account, error) {
+	args := m.Called(bankAccount)
+	return args.Get(0).(*model.Account), args.Error(1)
+}
+
+func (m *MockAccountRepo) ListAccounts(limit, offset int) ([]model.Account, int64, error) {
+	args := m.Called(limit, offset)
+	return args.Get(0).([]model.Account), args.Get(1).(int64), args.Error(2)
+}
+
+func (m *MockAccountRepo) CreateAccount(account *model.Account) error {
+	args := m.Called(account)
+	return args.Error(0)
+}
+
+func (m *MockAccountRepo) UpdateAccount(account *model.Account) error {
+	args := m.Called(account)
+	return args.Error(0)
+}
+
+func (m *MockAccountRepo) DeleteAccount(accountID int) error {
+	args := m.Called(accountID)
+	return args.Error(0)
+}
+
 func (m *MockAccountRepo) UpsertAccounts(accounts []model.Account) error {
 	args := m.Called(accounts)
 	return args.Error(0)
 }
 
+type MockFXRateRepo struct {
+	mock.Mock
+}
+
+func (m *MockFXRateRepo) UpsertFXRates(rates []model.FXRate) error {
+	args := m.Called(rates)
+	return args.Error(0)
+}
+
+func (m *MockFXRateRepo) GetEffectiveFXRate(baseCurrency, quoteCurrency string, date time.Time) (*model.FXRate, error) {
+	args := m.Called(baseCurrency, quoteCurrency, date)
+	return args.Get(0).(*model.FXRate), args.Error(1)
+}
+
+type MockOutboxRepo struct {
+	mock.Mock
+}
+
+func (m *MockOutboxRepo) EnqueueOutboxMessages(messages []model.OutboxMessage) error {
+	args := m.Called(messages)
+	return args.Error(0)
+}
+
+func (m *MockOutboxRepo) EnqueuePeriodReports(messages []model.OutboxMessage) ([]model.OutboxMessage, error) {
+	args := m.Called(messages)
+	return args.Get(0).([]model.OutboxMessage), args.Error(1)
+}
+
+func (m *MockOutboxRepo) ClaimDueOutboxMessages(now, staleBefore time.Time, limit int) ([]model.OutboxMessage, error) {
+	args := m.Called(now, staleBefore, limit)
+	return args.Get(0).([]model.OutboxMessage), args.Error(1)
+}
+
+func (m *MockOutboxRepo) ReleaseOutboxMessages(messageIDs []uint) error {
+	args := m.Called(messageIDs)
+	return args.Error(0)
+}
+
+func (m *MockOutboxRepo) UpdateOutboxMessage(message *model.OutboxMessage) error {
+	// the worker updates the message in place, so a copy is recorded
+	args := m.Called(*message)
+	return args.Error(0)
+}
+
+func (m *MockOutboxRepo) ListOutboxMessages(filter model.OutboxFilter) ([]model.OutboxMessage, error) {
+	args := m.Called(filter)
+	return args.Get(0).([]model.OutboxMessage), args.Error(1)
+}
+
+func (m *MockOutboxRepo) GetOutboxMessage(messageID uint) (*model.OutboxMessage, error) {
+	args := m.Called(messageID)
+	return args.Get(0).(*model.OutboxMessage), args.Error(1)
+}
+
+type MockReportRepo struct {
+	mock.Mock
+}
+
+func (m *MockReportRepo) CreateReportDefinition(definition *model.ReportDefinition) error {
+	args := m.Called(definition)
+	return args.Error(0)
+}
+
+func (m *MockReportRepo) ListReportDefinitions() ([]model.ReportDefinition, error) {
+	args := m.Called()
+	return args.Get(0).([]model.ReportDefinition), args.Error(1)
+}
+
+func (m *MockReportRepo) GetReportDefinition(definitionID uint) (*model.ReportDefinition, error) {
+	args := m.Called(definitionID)
+	return args.Get(0).(*model.ReportDefinition), args.Error(1)
+}
+
+func (m *MockReportRepo) Subscribe(definitionID uint, accountID int) error {
+	args := m.Called(definitionID, accountID)
+	return args.Error(0)
+}
+
+func (m *MockReportRepo) Unsubscribe(definitionID uint, accountID int) error {
+	args := m.Called(definitionID, accountID)
+	return args.Error(0)
+}
+
+func (m *MockReportRepo) ListSubscribedAccountIDs(definitionID uint) ([]int, error) {
+	args := m.Called(definitionID)
+	return args.Get(0).([]int), args.Error(1)
+}
+
+type MockScheduleRepo struct {
+	mock.Mock
+}
+
+func (m *MockScheduleRepo) CreateSchedule(schedule *model.Schedule) error {
+	args := m.Called(schedule)
+	return args.Error(0)
+}
+
+func (m *MockScheduleRepo) ListSchedules() ([]model.Schedule, error) {
+	args := m.Called()
+	return args.Get(0).([]model.Schedule), args.Error(1)
+}
+
+func (m *MockScheduleRepo) ListDueSchedules(now time.Time) ([]model.Schedule, error) {
+	args := m.Called(now)
+	return args.Get(0).([]model.Schedule), args.Error(1)
+}
+
+func (m *MockScheduleRepo) ClaimSchedule(scheduleID uint, now, staleBefore time.Time) (bool, error) {
+	args := m.Called(scheduleID, now, staleBefore)
+	return args.Bool(0), args.Error(1)
+}
+
+func (m *MockScheduleRepo) RenewScheduleClaim(scheduleID uint, now time.Time) error {
+	args := m.Called(scheduleID, now)
+	return args.Error(0)
+}
+
+func (m *MockScheduleRepo) UpdateScheduleRun(schedule *model.Schedule) error {
+	args := m.Called(schedule)
+	return args.Error(0)
+}
+
 type MockEmailSender struct {
 	mock.Mock
 }
 
-func (m *MockEmailSender) SendEmail(to, subject, body string, attachments ...string) error {
+func (m *MockEmailSender) SendEmail(to, subject string, body email.Body, attachments ...email.Attachment) error {
 	args := m.Called(to, subject, body, attachments)
 	return args.Error(0)
 }
 
+const validTransactionsFile = "Id,Date,Transaction,Account\n1,2023-12-15,60.5,1\n2,2023-12-15,-10.3,1\n"
+
 func TestRunDailyReport_Success(t *testing.T) {
 	gin.SetMode(gin.TestMode)
 
-	// mock success response in ParseCSVFile function
-	mockParseCSVFile(t, [][]string{{"1", "2023-12-15", "60.5", "1"}, {"2", "2023-12-15", "-10.3", "1"}}, nil)
+	// mock transactions file
+	mockTransactionsFile(t, validTransactionsFile)
 
-	// mock transaction repo
+	// mock transaction repo, the report covers the accounts of the inserted transactions
 	mockTransactionRepo := new(MockTransactionRepo)
 	mockTransactionRepo.On("UpsertTransactions", mock.Anything).
-		Return(nil).
+		Return(2, nil).
 		Times(1)
-
-	// mock account repo
-	mockAccountRepo := new(MockAccountRepo)
-	mockAccountRepo.On("GetAccount", mock.Anything).
-		Return(&model.Account{ID: 1, Email: "test@email.com"}, nil).
+	mockTransactionRepo.On("ListImportedAccountIDs", mock.Anything).
+		Return([]int{1}, nil).
 		Times(1)
 
-	// mock email sender
-	mockEmailSender := new(MockEmailSender)
-	mockEmailSender.On("SendEmail", mock.Anything, mock.Anything, mock.Anything, mock.Anything).
+	// mock outbox repo, the report is enqueued within the import database transaction
+	mockOutboxRepo := new(MockOutboxRepo)
+	mockOutboxRepo.On("EnqueueOutboxMessages", mock.MatchedBy(func(messages []model.OutboxMessage) bool {
+		return len(messages) == 1 &&
+			messages[0].Kind == model.OutboxKindDailyReport &&
+			messages[0].AccountID == 1 &&
+			messages[0].ImportBatchID != nil &&
+			messages[0].Status == model.OutboxStatusPending
+	})).
 		Return(nil).
 		Times(1)
+	mockTransactionRepo.On("OutboxRepo").Return(mockOutboxRepo)
 
 	w := httptest.NewRecorder()
 	c, _ := gin.CreateTestContext(w)
 
+	// emails are only built and sent by the outbox worker
+	mockEmailSender := new(MockEmailSender)
 	service := &Service{
-		accountRepo:     mockAccountRepo,
+		accountRepo:     newMockAccountRepo(),
 		transactionRepo: mockTransactionRepo,
+		importBatchRepo: newMockImportBatchRepo(),
 		emailSender:     mockEmailSender,
 	}
 	service.RunDailyReport(c)
 
 	require.Equal(t, http.StatusOK, w.Code)
+	require.Contains(t, w.Body.String(), `"kind":"daily_report"`)
+	mockOutboxRepo.AssertExpectations(t)
+	mockTransactionRepo.AssertNotCalled(t, "SummarizeTransactions", mock.Anything)
+	mockEmailSender.AssertNotCalled(t, "SendEmail")
+}
+
+func TestRunDailyReport_SkipsAccountsWithoutNewTransactions(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	// mock transactions file
+	mockTransactionsFile(t, validTransactionsFile)
+
+	// mock transaction repo, every transaction of the file was already stored
+	mockTransactionRepo := new(MockTransactionRepo)
+	mockTransactionRepo.On("UpsertTransactions", mock.Anything).
+		Return(0, nil).
+		Times(1)
+	mockTransactionRepo.On("ListImportedAccountIDs", mock.Anything).
+		Return([]int{}, nil).
+		Times(1)
+
+	// mock outbox repo
+	mockOutboxRepo := new(MockOutboxRepo)
+	mockOutboxRepo.On("EnqueueOutboxMessages", []model.OutboxMessage{}).
+		Return(nil).
+		Times(1)
+	mockTransactionRepo.On("OutboxRepo").Return(mockOutboxRepo)
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+
+	service := &Service{accountRepo: newMockAccountRepo(), transactionRepo: mockTransactionRepo, importBatchRepo: newMockImportBatchRepo()}
+	service.RunDailyReport(c)
+
+	require.Equal(t, http.StatusOK, w.Code)
+	mockOutboxRepo.AssertExpectations(t)
 }
 
 func TestRunDailyReport_ErrorParsingCsvFile(t *testing.T) {
 	gin.SetMode(gin.TestMode)
 
-	// mock error response in ParseCSVFile function
-	mockParseCSVFile(t, [][]string{}, fmt.Errorf("error parsing csv file"))
+	// mock transactions file with an unterminated quoted field
+	mockTransactionsFile(t, "Id,Date,Transaction,Account\n\"1,2023-12-15,60.5,1\n")
 
 	w := httptest.NewRecorder()
 	c, _ := gin.CreateTestContext(w)
 
-	service := &Service{}
+	service := &Service{accountRepo: newMockAccountRepo(), transactionRepo: new(MockTransactionRepo), importBatchRepo: newMockImportBatchRepo()}
 	service.RunDailyReport(c)
 
 	require.Equal(t, http.StatusInternalServerError, w.Code)
@@ -104,16 +362,13 @@ func TestRunDailyReport_ErrorParsingCsvFile(t *testing.T) {
 func TestRunDailyReport_ErrorConvertingTransaction(t *testing.T) {
 	gin.SetMode(gin.TestMode)
 
-	// mock success response in ParseCSVFile function
-	mockParseCSVFile(t, [][]string{{"1", "2023-12-15", "60.5", "1"}, {"2", "2023-12-15", "-10.3", "1"}}, nil)
-
-	// mock error response in CSVRecordsToTransactions function
-	mockCSVRecordsToTransactions(t, nil, fmt.Errorf("error converting csv records to transactions"))
+	// mock transactions file with an invalid amount
+	mockTransactionsFile(t, "Id,Date,Transaction,Account\n1,2023-12-15,60.5,1\n2,2023-12-15,-10.a,1\n")
 
 	w := httptest.NewRecorder()
 	c, _ := gin.CreateTestContext(w)
 
-	service := &Service{}
+	service := &Service{accountRepo: newMockAccountRepo(), transactionRepo: new(MockTransactionRepo), importBatchRepo: newMockImportBatchRepo()}
 	service.RunDailyReport(c)
 
 	require.Equal(t, http.StatusInternalServerError, w.Code)
@@ -123,84 +378,95 @@ func TestRunDailyReport_ErrorConvertingTransaction(t *testing.T) {
 func TestRunDailyReport_ErrorInsertingTransaction(t *testing.T) {
 	gin.SetMode(gin.TestMode)
 
-	// mock success response in ParseCSVFile function
-	mockParseCSVFile(t, [][]string{{"1", "2023-12-15", "60.5", "1"}, {"2", "2023-12-15", "-10.3", "1"}}, nil)
+	// mock transactions file
+	mockTransactionsFile(t, validTransactionsFile)
 
-	// mock success response in CSVRecordsToTransactions function
-	mockCSVRecordsToTransactions(t, []model.Transaction{{TransactionID: 1}, {TransactionID: 2}}, nil)
-
-	// mock success response in transaction repo
+	// mock error response in transaction repo
 	mockTransactionRepo := new(MockTransactionRepo)
 	mockTransactionRepo.On("UpsertTransactions", mock.Anything).
-		Return(fmt.Errorf("error inserting transaction")).
+		Return(0, fmt.Errorf("error inserting transaction")).
 		Times(1)
 
 	w := httptest.NewRecorder()
 	c, _ := gin.CreateTestContext(w)
 
-	service := &Service{transactionRepo: mockTransactionRepo}
+	service := &Service{accountRepo: newMockAccountRepo(), transactionRepo: mockTransactionRepo, importBatchRepo: newMockImportBatchRepo()}
 	service.RunDailyReport(c)
 
 	require.Equal(t, http.StatusInternalServerError, w.Code)
 	require.Contains(t, w.Body.String(), insertTransactionErr)
 }
 
-func TestRunDailyReport_ErrorSendingEmail(t *testing.T) {
+func TestRunDailyReport_ErrorEnqueueingEmails(t *testing.T) {
 	gin.SetMode(gin.TestMode)
 
-	// mock success response in ParseCSVFile function
-	mockParseCSVFile(t, [][]string{{"1", "2023-12-15", "60.5", "1"}, {"2", "2023-12-15", "-10.3", "1"}}, nil)
-
-	// mock success response in CSVRecordsToTransactions function
-	mockCSVRecordsToTransactions(t, []model.Transaction{
-		{TransactionID: 1, TransactionAmount: decimal.RequireFromString("60.5")},
-		{TransactionID: 2, TransactionAmount: decimal.RequireFromString("-10.3")},
-	}, nil)
+	// mock transactions file
+	mockTransactionsFile(t, validTransactionsFile)
 
 	// mock success response in transaction repo
 	mockTransactionRepo := new(MockTransactionRepo)
 	mockTransactionRepo.On("UpsertTransactions", mock.Anything).
-		Return(nil).
+		Return(2, nil).
 		Times(1)
-
-	// mock account repo
-	mockAccountRepo := new(MockAccountRepo)
-	mockAccountRepo.On("GetAccount", mock.Anything).
-		Return(&model.Account{ID: 1, Email: "test@email.com"}, nil).
+	mockTransactionRepo.On("ListImportedAccountIDs", mock.Anything).
+		Return([]int{1}, nil).
 		Times(1)
 
-	// mock email sender
-	mockEmailSender := new(MockEmailSender)
-	mockEmailSender.On("SendEmail", mock.Anything, mock.Anything, mock.Anything, mock.Anything).
-		Return(fmt.Errorf("error sending email")).
+	// mock error response in outbox repo
+	mockOutboxRepo := new(MockOutboxRepo)
+	mockOutboxRepo.On("EnqueueOutboxMessages", mock.Anything).
+		Return(fmt.Errorf("error enqueueing emails")).
 		Times(1)
+	mockTransactionRepo.On("OutboxRepo").Return(mockOutboxRepo)
+
+	// mock import batch repo, the import fails along with the emails
+	mockImportBatchRepo := newMockImportBatchRepo()
 
 	w := httptest.NewRecorder()
 	c, _ := gin.CreateTestContext(w)
 
-	service := &Service{accountRepo: mockAccountRepo, transactionRepo: mockTransactionRepo, emailSender: mockEmailSender}
+	service := &Service{
+		accountRepo:     newMockAccountRepo(),
+		transactionRepo: mockTransactionRepo,
+		importBatchRepo: mockImportBatchRepo,
+	}
 	service.RunDailyReport(c)
 
 	require.Equal(t, http.StatusInternalServerError, w.Code)
-	require.Contains(t, w.Body.String(), sendEmailErr)
+	require.Contains(t, w.Body.String(), enqueueEmailsErr)
+	mockImportBatchRepo.AssertCalled(t, "UpdateImportBatch", mock.MatchedBy(func(batch *model.ImportBatch) bool {
+		return batch.Status == model.ImportBatchStatusFailed && batch.InsertedCount == 0
+	}))
 }
 
-func mockParseCSVFile(t *testing.T, expectedRes [][]string, expectedErr error) {
-	orig := utils.ParseCSVFile
-	utils.ParseCSVFile = func(_ string) ([][]string, error) {
-		return expectedRes, expectedErr
+// newMockAccountSummary returns the summary of an account with a single transaction in its base currency
+func newMockAccountSummary() *model.AccountSummary {
+	return &model.AccountSummary{
+		AccountID:  1,
+		Currencies: []model.CurrencySummary{{Currency: "USD", CreditTotal: decimal.RequireFromString("60.5"), CreditCount: 1}},
 	}
-	t.Cleanup(func() {
-		utils.ParseCSVFile = orig
-	})
 }
 
-func mockCSVRecordsToTransactions(t *testing.T, expectedRes []model.Transaction, expectedErr error) {
-	orig := converter.CSVRecordsToTransactions
-	converter.CSVRecordsToTransactions = func(_ [][]string) ([]model.Transaction, error) {
-		return expectedRes, expectedErr
-	}
-	t.Cleanup(func() {
-		converter.CSVRecordsToTransactions = orig
-	})
+// newMockAccountRepo returns an account repo whose accounts have USD as base currency
+func newMockAccountRepo() *MockAccountRepo {
+	mockAccountRepo := new(MockAccountRepo)
+	mockAccountRepo.On("GetAccount", mock.Anything).
+		Return(&model.Account{ID: 1, Email: "test@email.com", BaseCurrency: "USD"}, nil)
+
+	return mockAccountRepo
+}
+
+func newMockImportBatchRepo() *MockImportBatchRepo {
+	mockImportBatchRepo := new(MockImportBatchRepo)
+	mockImportBatchRepo.On("CreateImportBatch", mock.Anything).Return(nil)
+	mockImportBatchRepo.On("UpdateImportBatch", mock.Anything).Return(nil)
+
+	return mockImportBatchRepo
+}
+
+// mockTransactionsFile points TRANSACTIONS_FILE_PATH to a temporary file with the given content
+func mockTransactionsFile(t *testing.T, content string) {
+	filePath := filepath.Join(t.TempDir(), "transactions.csv")
+	require.NoError(t, os.WriteFile(filePath, []byte(content), 0600))
+	t.Setenv("TRANSACTIONS_FILE_PATH", filePath)
 }
@@ -0,0 +1,176 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"github.com/mdcantarini/transaction-processor-api/pkg/converter"
+	"github.com/mdcantarini/transaction-processor-api/pkg/model"
+)
+
+// GetAccountSummary returns the balance and statistics of the transactions of an account, optionally
+// restricted to the from and to (inclusive) dates
+func (s *Service) GetAccountSummary(c *gin.Context) {
+	account, ok := s.accountFromPath(c)
+	if !ok {
+		return
+	}
+
+	filter := model.SummaryFilter{AccountID: account.ID}
+	var err error
+	filter.From, filter.Until, err = dateRangeFromQuery(c)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("%s: %s", invalidSummaryFilterErr, err.Error())})
+		return
+	}
+
+	summary, err := s.summarizeAccount(s.TransactionRepo(), account, filter, s.rateFinder())
+	if err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, converter.ErrMissingFXRate) {
+			status = http.StatusUnprocessableEntity
+		}
+
+		c.AbortWithStatusJSON(status, gin.H{"error": fmt.Sprintf("%s: %s", summarizeAccountErr, err.Error())})
+		return
+	}
+
+	c.JSON(http.StatusOK, summary)
+}
+
+// summarizeAccount computes the summary of the account transactions matching the filter, it is shared by
+// the summary endpoint and the email reports so both always agree. The transactions are read through the
+// given repository, which lets reports see the transactions of the import database transaction.
+func (s *Service) summarizeAccount(repo model.ITransaction, account *model.Account, filter model.SummaryFilter, findRate converter.RateFinder) (*model.AccountSummary, error) {
+	summary, err := repo.SummarizeTransactions(filter)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", fetchTransactionsErr, err)
+	}
+
+	err = converter.CompleteSummary(summary, account.BaseCurrency, findRate)
+	if err != nil {
+		return nil, err
+	}
+
+	return summary, nil
+}
+
+// dateRangeFromQuery parses the from and to query parameters, returning the first date included and the
+// first date excluded
+func dateRangeFromQuery(c *gin.Context) (*time.Time, *time.Time, error) {
+	var from, until *time.Time
+
+	if c.Query("from") != "" {
+		date, err := time.Parse(time.DateOnly, c.Query("from"))
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid from date %s", c.Query("from"))
+		}
+
+		from = &date
+	}
+
+	if c.Query("to") != "" {
+		date, err := time.Parse(time.DateOnly, c.Query("to"))
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid to date %s", c.Query("to"))
+		}
+
+		// the whole last day is included
+		date = date.AddDate(0, 0, 1)
+		until = &date
+	}
+
+	if from != nil && until != nil && !from.Before(*until) {
+		return nil, nil, fmt.Errorf("from date %s is after to date %s", c.Query("from"), c.Query("to"))
+	}
+
+	return from, until, nil
+}
+
+const (
+	previewFormatHTML = "html"
+	previewFormatText = "text"
+	previewFormatJSON = "json"
+)
+
+// PreviewAccountReport renders the daily report of an account without sending it, so its content can be checked.
+// The report is built for the last import batch which inserted transactions of the account on or before the date
+// query parameter, at any time by default, exactly like the daily report email of that import. The import_batch_id
+// query parameter previews a given import batch instead. It is rendered as HTML by default, or as the plain text
+// alternative, or as the JSON of the data it is rendered with.
+func (s *Service) PreviewAccountReport(c *gin.Context) {
+	format := c.DefaultQuery("format", previewFormatHTML)
+	switch format {
+	case previewFormatHTML, previewFormatText, previewFormatJSON:
+	default:
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("%s: unknown format %s", invalidPreviewErr, format)})
+		return
+	}
+
+	account, ok := s.accountFromPath(c)
+	if !ok {
+		return
+	}
+
+	var until *time.Time
+	if c.Query("date") != "" {
+		date, err := time.Parse(time.DateOnly, c.Query("date"))
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("%s: invalid date %s", invalidPreviewErr, c.Query("date"))})
+			return
+		}
+
+		// the imports of the whole day are included
+		date = date.AddDate(0, 0, 1)
+		until = &date
+	}
+
+	importBatchID := c.Query("import_batch_id")
+	if importBatchID == "" {
+		var err error
+		importBatchID, err = s.TransactionRepo().LatestImportBatchID(account.ID, until)
+		if err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": noImportedTransactionsErr})
+				return
+			}
+
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("%s: %s", fetchTransactionsErr, err.Error())})
+			return
+		}
+	}
+
+	view, err := s.dailyReportView(account, importBatchID, s.rateFinder())
+	if err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, converter.ErrMissingFXRate) {
+			status = http.StatusUnprocessableEntity
+		}
+
+		c.AbortWithStatusJSON(status, gin.H{"error": fmt.Sprintf("%s: %s", buildReportErr, err.Error())})
+		return
+	}
+
+	if format == previewFormatJSON {
+		c.JSON(http.StatusOK, view)
+		return
+	}
+
+	body, err := s.renderReport(view)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("%s: %s", buildReportErr, err.Error())})
+		return
+	}
+
+	if format == previewFormatText {
+		c.Data(http.StatusOK, "text/plain; charset=utf-8", []byte(body.Text))
+		return
+	}
+
+	c.Data(http.StatusOK, "text/html; charset=utf-8", []byte(body.HTML))
+}
@@ -0,0 +1,343 @@
+package service
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+
+	"github.com/mdcantarini/transaction-processor-api/pkg/model"
+)
+
+func TestGetAccountSummary_Success(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	// mock account repo
+	mockAccountRepo := new(MockAccountRepo)
+	mockAccountRepo.On("GetAccount", 1).
+		Return(&model.Account{ID: 1, Email: "test@email.com", BaseCurrency: "USD"}, nil).
+		Times(1)
+
+	// mock transaction repo, the whole last day is included
+	mockTransactionRepo := new(MockTransactionRepo)
+	mockTransactionRepo.On("SummarizeTransactions", mock.MatchedBy(func(filter model.SummaryFilter) bool {
+		return filter.AccountID == 1 &&
+			filter.From.Equal(time.Date(2023, 12, 1, 0, 0, 0, 0, time.UTC)) &&
+			filter.Until.Equal(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)) &&
+			filter.ImportBatchID == nil
+	})).
+		Return(&model.AccountSummary{
+			AccountID: 1,
+			Currencies: []model.CurrencySummary{{
+				Currency:    "USD",
+				CreditTotal: decimal.RequireFromString("60.5"),
+				CreditCount: 1,
+				DebitTotal:  decimal.RequireFromString("-10.3"),
+				DebitCount:  1,
+			}},
+			Months:      []model.MonthlySummary{{Month: "2023-12", Currency: "USD", CreditTotal: decimal.RequireFromString("60.5"), DebitTotal: decimal.RequireFromString("-10.3"), Count: 2}},
+			DailyTotals: []model.DailyTotal{{Currency: "USD", Date: time.Date(2023, 12, 15, 0, 0, 0, 0, time.UTC), Total: decimal.RequireFromString("50.2")}},
+		}, nil).
+		Times(1)
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodGet, "/accounts/1/summary?from=2023-12-01&to=2023-12-31", nil)
+	c.Params = gin.Params{{Key: "id", Value: "1"}}
+
+	service := &Service{accountRepo: mockAccountRepo, transactionRepo: mockTransactionRepo}
+	service.GetAccountSummary(c)
+
+	require.Equal(t, http.StatusOK, w.Code)
+	require.JSONEq(t, `{
+		"account_id": 1,
+		"transaction_count": 2,
+		"base_currency": "USD",
+		"converted_balance": "50.2",
+		"currencies": [{
+			"currency": "USD",
+			"balance": "50.2",
+			"credit_total": "60.5",
+			"credit_count": 1,
+			"debit_total": "-10.3",
+			"debit_count": 1,
+			"average_credit": "60.5",
+			"average_debit": "-10.3",
+			"converted_balance": "50.2"
+		}],
+		"months": [{
+			"month": "2023-12",
+			"currency": "USD",
+			"credit_total": "60.5",
+			"debit_total": "-10.3",
+			"net": "50.2",
+			"count": 2
+		}]
+	}`, w.Body.String())
+	mockTransactionRepo.AssertExpectations(t)
+}
+
+func TestGetAccountSummary_InvalidDateRange(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	// mock account repo
+	mockAccountRepo := new(MockAccountRepo)
+	mockAccountRepo.On("GetAccount", 1).
+		Return(&model.Account{ID: 1, Email: "test@email.com"}, nil).
+		Times(1)
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodGet, "/accounts/1/summary?from=2023-12-31&to=2023-12-01", nil)
+	c.Params = gin.Params{{Key: "id", Value: "1"}}
+
+	service := &Service{accountRepo: mockAccountRepo}
+	service.GetAccountSummary(c)
+
+	require.Equal(t, http.StatusBadRequest, w.Code)
+	require.Contains(t, w.Body.String(), invalidSummaryFilterErr)
+}
+
+func TestGetAccountSummary_MissingFXRate(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	// mock account repo
+	mockAccountRepo := new(MockAccountRepo)
+	mockAccountRepo.On("GetAccount", 1).
+		Return(&model.Account{ID: 1, Email: "test@email.com", BaseCurrency: "USD"}, nil).
+		Times(1)
+
+	// mock transaction repo with amounts in euros
+	mockTransactionRepo := new(MockTransactionRepo)
+	mockTransactionRepo.On("SummarizeTransactions", mock.Anything).
+		Return(&model.AccountSummary{
+			AccountID:   1,
+			DailyTotals: []model.DailyTotal{{Currency: "EUR", Date: time.Date(2023, 12, 15, 0, 0, 0, 0, time.UTC), Total: decimal.RequireFromString("60.5")}},
+		}, nil).
+		Times(1)
+
+	// mock fx rate repo without rates
+	mockFXRateRepo := new(MockFXRateRepo)
+	mockFXRateRepo.On("GetEffectiveFXRate", mock.Anything, mock.Anything, mock.Anything).
+		Return((*model.FXRate)(nil), gorm.ErrRecordNotFound)
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodGet, "/accounts/1/summary", nil)
+	c.Params = gin.Params{{Key: "id", Value: "1"}}
+
+	service := &Service{accountRepo: mockAccountRepo, transactionRepo: mockTransactionRepo, fxRateRepo: mockFXRateRepo}
+	service.GetAccountSummary(c)
+
+	require.Equal(t, http.StatusUnprocessableEntity, w.Code)
+	require.Contains(t, w.Body.String(), "missing fx rate from EUR to USD on 2023-12-15")
+}
+
+func TestPreviewAccountReport_HTML(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	// mock transaction repo, the new transactions are those of the last import of the account, like in the email
+	mockTransactionRepo := new(MockTransactionRepo)
+	mockTransactionRepo.On("LatestImportBatchID", 1, (*time.Time)(nil)).
+		Return("batch-1", nil).
+		Times(1)
+	mockTransactionRepo.On("SummarizeTransactions", mock.MatchedBy(func(filter model.SummaryFilter) bool {
+		return filter.AccountID == 1 && filter.From == nil && filter.Until == nil && filter.ImportBatchID == nil
+	})).
+		Return(&model.AccountSummary{
+			AccountID:   1,
+			Currencies:  []model.CurrencySummary{{Currency: "USD", CreditTotal: decimal.RequireFromString("80.5"), CreditCount: 2}},
+			Months:      []model.MonthlySummary{{Month: "2023-12", Currency: "USD", CreditTotal: decimal.RequireFromString("80.5"), Count: 2}},
+			DailyTotals: []model.DailyTotal{{Currency: "USD", Date: time.Date(2023, 12, 15, 0, 0, 0, 0, time.UTC), Total: decimal.RequireFromString("80.5")}},
+		}, nil).
+		Times(1)
+	mockTransactionRepo.On("SummarizeTransactions", mock.MatchedBy(func(filter model.SummaryFilter) bool {
+		return filter.AccountID == 1 && filter.ImportBatchID != nil && *filter.ImportBatchID == "batch-1"
+	})).
+		Return(newMockAccountSummary(), nil).
+		Times(1)
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodGet, "/accounts/1/report/preview", nil)
+	c.Params = gin.Params{{Key: "id", Value: "1"}}
+
+	// no email sender nor outbox repo is involved
+	service := &Service{accountRepo: newMockAccountRepo(), transactionRepo: mockTransactionRepo}
+	service.PreviewAccountReport(c)
+
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Equal(t, "text/html; charset=utf-8", w.Header().Get("Content-Type"))
+	require.Contains(t, w.Body.String(), "<p>Total balance in USD is: 80.50 USD</p>")
+	require.Contains(t, w.Body.String(), "<p>Number of new transactions: 1</p>")
+	mockTransactionRepo.AssertExpectations(t)
+}
+
+func TestPreviewAccountReport_Text(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	// mock transaction repo
+	mockTransactionRepo := new(MockTransactionRepo)
+	mockTransactionRepo.On("LatestImportBatchID", 1, (*time.Time)(nil)).
+		Return("batch-1", nil).
+		Times(1)
+	mockTransactionRepo.On("SummarizeTransactions", mock.Anything).
+		Return(newMockAccountSummary(), nil).
+		Times(2)
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodGet, "/accounts/1/report/preview?format=text", nil)
+	c.Params = gin.Params{{Key: "id", Value: "1"}}
+
+	service := &Service{accountRepo: newMockAccountRepo(), transactionRepo: mockTransactionRepo}
+	service.PreviewAccountReport(c)
+
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Equal(t, "text/plain; charset=utf-8", w.Header().Get("Content-Type"))
+	require.Contains(t, w.Body.String(), "Number of new transactions: 1\n")
+	require.NotContains(t, w.Body.String(), "<p>")
+}
+
+func TestPreviewAccountReport_JSON(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	// mock transaction repo, the import batch is given so the last one is not looked up
+	mockTransactionRepo := new(MockTransactionRepo)
+	mockTransactionRepo.On("SummarizeTransactions", mock.Anything).
+		Return(newMockAccountSummary(), nil).
+		Times(2)
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodGet, "/accounts/1/report/preview?format=json&import_batch_id=batch-1", nil)
+	c.Params = gin.Params{{Key: "id", Value: "1"}}
+
+	service := &Service{accountRepo: newMockAccountRepo(), transactionRepo: mockTransactionRepo}
+	service.PreviewAccountReport(c)
+
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Contains(t, w.Body.String(), `"new_transaction_count":1`)
+	require.Contains(t, w.Body.String(), `"credit_total":"60.50 USD"`)
+	mockTransactionRepo.AssertNotCalled(t, "LatestImportBatchID", mock.Anything, mock.Anything)
+}
+
+func TestPreviewAccountReport_Date(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	// mock transaction repo, the last import of the account started before the end of the date is previewed
+	mockTransactionRepo := new(MockTransactionRepo)
+	mockTransactionRepo.On("LatestImportBatchID", 1, mock.MatchedBy(func(until *time.Time) bool {
+		return until != nil && until.Equal(time.Date(2023, 12, 16, 0, 0, 0, 0, time.UTC))
+	})).
+		Return("batch-1", nil).
+		Times(1)
+	mockTransactionRepo.On("SummarizeTransactions", mock.MatchedBy(func(filter model.SummaryFilter) bool {
+		return filter.AccountID == 1 && filter.ImportBatchID == nil
+	})).
+		Return(newMockAccountSummary(), nil).
+		Times(1)
+	mockTransactionRepo.On("SummarizeTransactions", mock.MatchedBy(func(filter model.SummaryFilter) bool {
+		return filter.AccountID == 1 && filter.ImportBatchID != nil && *filter.ImportBatchID == "batch-1"
+	})).
+		Return(newMockAccountSummary(), nil).
+		Times(1)
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodGet, "/accounts/1/report/preview?format=json&date=2023-12-15", nil)
+	c.Params = gin.Params{{Key: "id", Value: "1"}}
+
+	service := &Service{accountRepo: newMockAccountRepo(), transactionRepo: mockTransactionRepo}
+	service.PreviewAccountReport(c)
+
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Contains(t, w.Body.String(), `"new_transaction_count":1`)
+	mockTransactionRepo.AssertExpectations(t)
+}
+
+func TestPreviewAccountReport_ErrorInvalidDate(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodGet, "/accounts/1/report/preview?date=15-12-2023", nil)
+	c.Params = gin.Params{{Key: "id", Value: "1"}}
+
+	service := &Service{accountRepo: newMockAccountRepo()}
+	service.PreviewAccountReport(c)
+
+	require.Equal(t, http.StatusBadRequest, w.Code)
+	require.Contains(t, w.Body.String(), "invalid report preview: invalid date 15-12-2023")
+}
+
+func TestPreviewAccountReport_ErrorNoImports(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	// mock transaction repo, no transaction of the account was imported
+	mockTransactionRepo := new(MockTransactionRepo)
+	mockTransactionRepo.On("LatestImportBatchID", 1, (*time.Time)(nil)).
+		Return("", gorm.ErrRecordNotFound).
+		Times(1)
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodGet, "/accounts/1/report/preview", nil)
+	c.Params = gin.Params{{Key: "id", Value: "1"}}
+
+	service := &Service{accountRepo: newMockAccountRepo(), transactionRepo: mockTransactionRepo}
+	service.PreviewAccountReport(c)
+
+	require.Equal(t, http.StatusNotFound, w.Code)
+	require.Contains(t, w.Body.String(), noImportedTransactionsErr)
+}
+
+func TestPreviewAccountReport_ErrorInvalidFormat(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodGet, "/accounts/1/report/preview?format=pdf", nil)
+	c.Params = gin.Params{{Key: "id", Value: "1"}}
+
+	service := &Service{}
+	service.PreviewAccountReport(c)
+
+	require.Equal(t, http.StatusBadRequest, w.Code)
+	require.Contains(t, w.Body.String(), "invalid report preview: unknown format pdf")
+}
+
+func TestPreviewAccountReport_MissingFXRate(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	// mock transaction repo with amounts in euros
+	mockTransactionRepo := new(MockTransactionRepo)
+	mockTransactionRepo.On("SummarizeTransactions", mock.Anything).
+		Return(&model.AccountSummary{
+			AccountID:   1,
+			DailyTotals: []model.DailyTotal{{Currency: "EUR", Date: time.Date(2023, 12, 15, 0, 0, 0, 0, time.UTC), Total: decimal.RequireFromString("60.5")}},
+		}, nil).
+		Times(1)
+
+	// mock fx rate repo without rates
+	mockFXRateRepo := new(MockFXRateRepo)
+	mockFXRateRepo.On("GetEffectiveFXRate", mock.Anything, mock.Anything, mock.Anything).
+		Return((*model.FXRate)(nil), gorm.ErrRecordNotFound)
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodGet, "/accounts/1/report/preview?import_batch_id=batch-1", nil)
+	c.Params = gin.Params{{Key: "id", Value: "1"}}
+
+	service := &Service{accountRepo: newMockAccountRepo(), transactionRepo: mockTransactionRepo, fxRateRepo: mockFXRateRepo}
+	service.PreviewAccountReport(c)
+
+	require.Equal(t, http.StatusUnprocessableEntity, w.Code)
+	require.Contains(t, w.Body.String(), "missing fx rate from EUR to USD on 2023-12-15")
+}
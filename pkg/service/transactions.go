@@ -0,0 +1,180 @@
+package service
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/shopspring/decimal"
+	"gorm.io/gorm"
+
+	"github.com/mdcantarini/transaction-processor-api/pkg/model"
+)
+
+const (
+	defaultTransactionsLimit = 50
+	maxTransactionsLimit     = 500
+)
+
+// TransactionsPage is a page of the transactions list, the next page is requested by sending NextCursor
+// as the cursor query parameter
+type TransactionsPage struct {
+	Transactions []model.Transaction `json:"transactions"`
+	NextCursor   string              `json:"next_cursor,omitempty"`
+}
+
+// ListTransactions returns the transactions ordered by date and transaction ID. They can be filtered by the
+// account_id, from and to (inclusive dates), min_amount and max_amount and sign (credit or debit) query parameters.
+func (s *Service) ListTransactions(c *gin.Context) {
+	filter, err := transactionFilterFromQuery(c)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("%s: %s", invalidTransactionFilterErr, err.Error())})
+		return
+	}
+
+	limit := filter.Limit
+	// an additional transaction tells whether there is a next page
+	filter.Limit++
+
+	transactions, err := s.TransactionRepo().ListTransactions(filter)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("%s: %s", fetchTransactionsErr, err.Error())})
+		return
+	}
+
+	page := TransactionsPage{Transactions: transactions}
+	if len(transactions) > limit {
+		page.Transactions = transactions[:limit]
+		last := page.Transactions[limit-1]
+		page.NextCursor = encodeTransactionCursor(model.TransactionCursor{Date: last.Date, TransactionID: last.TransactionID})
+	}
+
+	c.JSON(http.StatusOK, page)
+}
+
+func (s *Service) GetTransaction(c *gin.Context) {
+	transactionID, err := strconv.Atoi(c.Param("transactionId"))
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": transactionNotFoundErr})
+		return
+	}
+
+	transaction, err := s.TransactionRepo().GetTransaction(transactionID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": transactionNotFoundErr})
+			return
+		}
+
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("%s: %s", fetchTransactionsErr, err.Error())})
+		return
+	}
+
+	c.JSON(http.StatusOK, transaction)
+}
+
+func transactionFilterFromQuery(c *gin.Context) (model.TransactionFilter, error) {
+	filter := model.TransactionFilter{Limit: defaultTransactionsLimit}
+
+	if c.Query("account_id") != "" {
+		accountID, err := strconv.Atoi(c.Query("account_id"))
+		if err != nil {
+			return filter, fmt.Errorf("invalid account_id %s", c.Query("account_id"))
+		}
+
+		filter.AccountID = &accountID
+	}
+
+	var err error
+	filter.From, filter.Until, err = dateRangeFromQuery(c)
+	if err != nil {
+		return filter, err
+	}
+
+	filter.MinAmount, err = optionalDecimalQuery(c, "min_amount")
+	if err != nil {
+		return filter, err
+	}
+
+	filter.MaxAmount, err = optionalDecimalQuery(c, "max_amount")
+	if err != nil {
+		return filter, err
+	}
+
+	filter.Sign = c.Query("sign")
+	if filter.Sign != "" && filter.Sign != model.SignCredit && filter.Sign != model.SignDebit {
+		return filter, fmt.Errorf("invalid sign %s, expected %s or %s", filter.Sign, model.SignCredit, model.SignDebit)
+	}
+
+	if c.Query("limit") != "" {
+		limit, err := strconv.Atoi(c.Query("limit"))
+		if err != nil || limit <= 0 || limit > maxTransactionsLimit {
+			return filter, fmt.Errorf("invalid limit %s, expected up to %d", c.Query("limit"), maxTransactionsLimit)
+		}
+
+		filter.Limit = limit
+	}
+
+	if c.Query("cursor") != "" {
+		cursor, err := decodeTransactionCursor(c.Query("cursor"))
+		if err != nil {
+			return filter, err
+		}
+
+		filter.After = &cursor
+	}
+
+	return filter, nil
+}
+
+func optionalDecimalQuery(c *gin.Context, param string) (*decimal.Decimal, error) {
+	if c.Query(param) == "" {
+		return nil, nil
+	}
+
+	amount, err := decimal.NewFromString(c.Query(param))
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s %s", param, c.Query(param))
+	}
+
+	return &amount, nil
+}
+
+// encodeTransactionCursor turns the position of a transaction into an opaque token
+func encodeTransactionCursor(cursor model.TransactionCursor) string {
+	token := fmt.Sprintf("%s|%d", cursor.Date.Format(time.RFC3339Nano), cursor.TransactionID)
+
+	return base64.RawURLEncoding.EncodeToString([]byte(token))
+}
+
+func decodeTransactionCursor(token string) (model.TransactionCursor, error) {
+	invalidCursor := fmt.Errorf("invalid cursor %s", token)
+
+	decoded, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return model.TransactionCursor{}, invalidCursor
+	}
+
+	date, transactionID, ok := strings.Cut(string(decoded), "|")
+	if !ok {
+		return model.TransactionCursor{}, invalidCursor
+	}
+
+	cursor := model.TransactionCursor{}
+	cursor.Date, err = time.Parse(time.RFC3339Nano, date)
+	if err != nil {
+		return model.TransactionCursor{}, invalidCursor
+	}
+
+	cursor.TransactionID, err = strconv.Atoi(transactionID)
+	if err != nil {
+		return model.TransactionCursor{}, invalidCursor
+	}
+
+	return cursor, nil
+}
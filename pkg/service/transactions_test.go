@@ -0,0 +1,175 @@
+package service
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+
+	"github.com/mdcantarini/transaction-processor-api/pkg/model"
+)
+
+func TestListTransactions_Filters(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	// mock transaction repo, one more transaction than requested is fetched
+	mockTransactionRepo := new(MockTransactionRepo)
+	mockTransactionRepo.On("ListTransactions", mock.MatchedBy(func(filter model.TransactionFilter) bool {
+		return *filter.AccountID == 1 &&
+			filter.From.Equal(time.Date(2023, 12, 1, 0, 0, 0, 0, time.UTC)) &&
+			filter.Until.Equal(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)) &&
+			filter.MinAmount.Equal(decimal.RequireFromString("-100")) &&
+			filter.MaxAmount == nil &&
+			filter.Sign == model.SignDebit &&
+			filter.After == nil &&
+			filter.Limit == 11
+	})).
+		Return([]model.Transaction{}, nil).
+		Times(1)
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodGet, "/transactions?account_id=1&from=2023-12-01&to=2023-12-31&min_amount=-100&sign=debit&limit=10", nil)
+
+	service := &Service{transactionRepo: mockTransactionRepo}
+	service.ListTransactions(c)
+
+	require.Equal(t, http.StatusOK, w.Code)
+	require.JSONEq(t, `{"transactions": []}`, w.Body.String())
+	mockTransactionRepo.AssertExpectations(t)
+}
+
+func TestListTransactions_Pagination(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	date := time.Date(2023, 12, 15, 0, 0, 0, 0, time.UTC)
+	transactions := []model.Transaction{
+		{TransactionID: 1, Date: date, TransactionAmount: decimal.RequireFromString("60.5"), Currency: "USD", AccountID: 1},
+		{TransactionID: 2, Date: date, TransactionAmount: decimal.RequireFromString("-10.3"), Currency: "USD", AccountID: 1},
+		{TransactionID: 3, Date: date, TransactionAmount: decimal.RequireFromString("5"), Currency: "USD", AccountID: 1},
+	}
+
+	// mock transaction repo, the second page starts after the last transaction of the first one
+	mockTransactionRepo := new(MockTransactionRepo)
+	mockTransactionRepo.On("ListTransactions", mock.MatchedBy(func(filter model.TransactionFilter) bool {
+		return filter.After == nil
+	})).
+		Return(transactions, nil).
+		Times(1)
+	mockTransactionRepo.On("ListTransactions", mock.MatchedBy(func(filter model.TransactionFilter) bool {
+		return filter.After != nil && filter.After.Date.Equal(date) && filter.After.TransactionID == 2
+	})).
+		Return(transactions[2:], nil).
+		Times(1)
+
+	service := &Service{transactionRepo: mockTransactionRepo}
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodGet, "/transactions?limit=2", nil)
+	service.ListTransactions(c)
+
+	require.Equal(t, http.StatusOK, w.Code)
+	var page TransactionsPage
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &page))
+	require.Len(t, page.Transactions, 2)
+	require.Equal(t, 2, page.Transactions[1].TransactionID)
+	require.NotEmpty(t, page.NextCursor)
+
+	w = httptest.NewRecorder()
+	c, _ = gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodGet, "/transactions?limit=2&cursor="+page.NextCursor, nil)
+	service.ListTransactions(c)
+
+	require.Equal(t, http.StatusOK, w.Code)
+	page = TransactionsPage{}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &page))
+	require.Len(t, page.Transactions, 1)
+	require.Equal(t, 3, page.Transactions[0].TransactionID)
+	require.Empty(t, page.NextCursor)
+	mockTransactionRepo.AssertExpectations(t)
+}
+
+func TestListTransactions_InvalidFilters(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	for query, expected := range map[string]string{
+		"account_id=a":      "invalid account_id a",
+		"from=15/12/2023":   "invalid from date 15/12/2023",
+		"max_amount=1a":     "invalid max_amount 1a",
+		"sign=positive":     "invalid sign positive",
+		"limit=1000":        "invalid limit 1000",
+		"cursor=not-a-page": "invalid cursor not-a-page",
+	} {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest(http.MethodGet, "/transactions?"+query, nil)
+
+		service := &Service{}
+		service.ListTransactions(c)
+
+		require.Equal(t, http.StatusBadRequest, w.Code)
+		require.Contains(t, w.Body.String(), invalidTransactionFilterErr)
+		require.Contains(t, w.Body.String(), expected)
+	}
+}
+
+func TestGetTransaction_Success(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	// mock transaction repo
+	mockTransactionRepo := new(MockTransactionRepo)
+	mockTransactionRepo.On("GetTransaction", 1).
+		Return(&model.Transaction{
+			TransactionID:     1,
+			Date:              time.Date(2023, 12, 15, 0, 0, 0, 0, time.UTC),
+			TransactionAmount: decimal.RequireFromString("60.5"),
+			Currency:          "USD",
+			AccountID:         1,
+		}, nil).
+		Times(1)
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Params = gin.Params{{Key: "transactionId", Value: "1"}}
+
+	service := &Service{transactionRepo: mockTransactionRepo}
+	service.GetTransaction(c)
+
+	require.Equal(t, http.StatusOK, w.Code)
+	require.JSONEq(t, `{
+		"transaction_id": 1,
+		"date": "2023-12-15T00:00:00Z",
+		"transaction_amount": "60.5",
+		"currency": "USD",
+		"account_id": 1,
+		"import_batch_id": null
+	}`, w.Body.String())
+}
+
+func TestGetTransaction_NotFound(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	// mock transaction repo
+	mockTransactionRepo := new(MockTransactionRepo)
+	mockTransactionRepo.On("GetTransaction", 1).
+		Return((*model.Transaction)(nil), gorm.ErrRecordNotFound).
+		Times(1)
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Params = gin.Params{{Key: "transactionId", Value: "1"}}
+
+	service := &Service{transactionRepo: mockTransactionRepo}
+	service.GetTransaction(c)
+
+	require.Equal(t, http.StatusNotFound, w.Code)
+	require.Contains(t, w.Body.String(), transactionNotFoundErr)
+}
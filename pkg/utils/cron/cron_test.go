@@ -0,0 +1,100 @@
+package cron
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestNext(t *testing.T) {
+	// January 1st 2024 is a Monday
+	after := time.Date(2024, 1, 1, 10, 17, 30, 0, time.UTC)
+
+	tests := []struct {
+		expression string
+		next       time.Time
+	}{
+		{"* * * * *", time.Date(2024, 1, 1, 10, 18, 0, 0, time.UTC)},
+		{"*/15 * * * *", time.Date(2024, 1, 1, 10, 30, 0, 0, time.UTC)},
+		{"5/20 * * * *", time.Date(2024, 1, 1, 10, 25, 0, 0, time.UTC)},
+		{"0 6 * * *", time.Date(2024, 1, 2, 6, 0, 0, 0, time.UTC)},
+		{"30 9-17 * * 1-5", time.Date(2024, 1, 1, 10, 30, 0, 0, time.UTC)},
+		{"0 8 * * 6,7", time.Date(2024, 1, 6, 8, 0, 0, 0, time.UTC)},
+		{"0 0 1 * *", time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC)},
+		{"0 0 29 2 *", time.Date(2024, 2, 29, 0, 0, 0, 0, time.UTC)},
+		// restricted days of month and days of week match either of them
+		{"0 0 15 * 5", time.Date(2024, 1, 5, 0, 0, 0, 0, time.UTC)},
+		{"@hourly", time.Date(2024, 1, 1, 11, 0, 0, 0, time.UTC)},
+		{"@weekly", time.Date(2024, 1, 7, 0, 0, 0, 0, time.UTC)},
+		{"@yearly", time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.expression, func(t *testing.T) {
+			schedule, err := Parse(tt.expression)
+			require.NoError(t, err)
+			require.Equal(t, tt.next, schedule.Next(after))
+		})
+	}
+}
+
+func TestNext_Timezone(t *testing.T) {
+	loc, err := time.LoadLocation("America/New_York")
+	require.NoError(t, err)
+
+	schedule, err := Parse("0 2 * * *")
+	require.NoError(t, err)
+
+	// the activation is in the location of the given time
+	next := schedule.Next(time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC).In(loc))
+	require.Equal(t, time.Date(2024, 1, 2, 7, 0, 0, 0, time.UTC), next.UTC())
+
+	// 2 AM does not exist on March 10th 2024 in New York
+	next = schedule.Next(time.Date(2024, 3, 9, 12, 0, 0, 0, loc))
+	require.Equal(t, time.Date(2024, 3, 11, 2, 0, 0, 0, loc), next)
+
+	// 1:30 AM happens twice on November 3rd 2024 in New York, first in EDT then in EST, and only runs once
+	schedule, err = Parse("30 1 * * *")
+	require.NoError(t, err)
+
+	next = schedule.Next(time.Date(2024, 11, 3, 0, 0, 0, 0, loc))
+	require.Equal(t, time.Date(2024, 11, 3, 5, 30, 0, 0, time.UTC), next.UTC())
+	next = schedule.Next(next)
+	require.Equal(t, time.Date(2024, 11, 4, 6, 30, 0, 0, time.UTC), next.UTC())
+
+	// activations within the repeated hour are skipped as well
+	schedule, err = Parse("*/30 * * * *")
+	require.NoError(t, err)
+
+	next = schedule.Next(time.Date(2024, 11, 3, 5, 30, 0, 0, time.UTC).In(loc))
+	require.Equal(t, time.Date(2024, 11, 3, 7, 0, 0, 0, time.UTC), next.UTC())
+}
+
+func TestNext_Never(t *testing.T) {
+	schedule, err := Parse("0 0 31 2 *")
+	require.NoError(t, err)
+	require.True(t, schedule.Next(time.Now()).IsZero())
+}
+
+func TestParse_Errors(t *testing.T) {
+	tests := []struct {
+		expression string
+		err        string
+	}{
+		{"* * * *", `invalid cron expression "* * * *": expected 5 fields, got 4`},
+		{"60 * * * *", `invalid cron expression "60 * * * *": minute field "60" out of range 0-59`},
+		{"* 5-2 * * *", `invalid cron expression "* 5-2 * * *": hour field "5-2" out of range 0-23`},
+		{"* * 0 * *", `invalid cron expression "* * 0 * *": day of month field "0" out of range 1-31`},
+		{"*/0 * * * *", `invalid cron expression "*/0 * * * *": invalid step in minute field "*/0"`},
+		{"* * * JAN *", `invalid cron expression "* * * JAN *": invalid month field "JAN"`},
+		{"@every 5m", `invalid cron expression "@every 5m": expected 5 fields, got 2`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.expression, func(t *testing.T) {
+			_, err := Parse(tt.expression)
+			require.EqualError(t, err, tt.err)
+		})
+	}
+}
@@ -14,7 +14,8 @@ func MustCreateDBConnection() *gorm.DB {
 	// retry the connection to the database until this is successful
 	var db *gorm.DB
 	err := backoff.Retry(func() error {
-		dbConnection, err := gorm.Open(postgres.Open(os.Getenv("DATABASE_DSN")))
+		// constraint violations are translated into errors like gorm.ErrDuplicatedKey
+		dbConnection, err := gorm.Open(postgres.Open(os.Getenv("DATABASE_DSN")), &gorm.Config{TranslateError: true})
 		if err != nil {
 			return err
 		}
@@ -27,7 +28,7 @@ func MustCreateDBConnection() *gorm.DB {
 		panic(err)
 	}
 
-	err = db.AutoMigrate(&model.Transaction{})
+	err = db.AutoMigrate(&model.Account{}, &model.ImportBatch{}, &model.StatementBalance{}, &model.Transaction{}, &model.FXRate{}, &model.OutboxMessage{}, &model.ReportDefinition{}, &model.ReportSubscription{}, &model.Schedule{})
 	if err != nil {
 		panic(err)
 	}
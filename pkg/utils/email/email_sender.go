@@ -1,5 +1,89 @@
 package email
 
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"mime"
+	"path/filepath"
+)
+
 type EmailSender interface {
-	SendEmail(to, subject, body string, attachments ...string) error
+	SendEmail(to, subject string, body Body, attachments ...Attachment) error
+}
+
+// Body is the content of an email, sent as HTML along with a plain text alternative
+type Body struct {
+	HTML string
+	// Text is the plain text alternative, it is derived from the HTML body when empty
+	Text string
+}
+
+// PlainText returns the plain text alternative of the body
+func (b Body) PlainText() string {
+	if b.Text != "" {
+		return b.Text
+	}
+
+	return htmlToText(b.HTML)
+}
+
+// Attachment is a file attached to an email
+type Attachment struct {
+	// FileName is the name the file is attached with, any directory is dropped
+	FileName string
+	// ContentType is the MIME type of the file, it is guessed from the file name extension when empty
+	ContentType string
+	// Content holds the file content, unless Reader is set, in which case the content is read from it
+	Content []byte
+	Reader  io.Reader
+	// Inline attachments are displayed within the HTML body, which refers to them as cid:ContentID
+	Inline    bool
+	ContentID string
+}
+
+// Name returns the file name without its directory
+func (a Attachment) Name() string {
+	return filepath.Base(a.FileName)
+}
+
+// MIMEType returns the content type of the attachment, defaulting to a generic binary type
+func (a Attachment) MIMEType() string {
+	if a.ContentType != "" {
+		return a.ContentType
+	}
+
+	contentType := mime.TypeByExtension(filepath.Ext(a.FileName))
+	if contentType == "" {
+		return "application/octet-stream"
+	}
+
+	return contentType
+}
+
+// Bytes returns the content of the attachment, reading it from Reader when set
+func (a Attachment) Bytes() ([]byte, error) {
+	if a.Reader == nil {
+		return a.Content, nil
+	}
+
+	var buf bytes.Buffer
+	_, err := io.Copy(&buf, a.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read attachment %s: %w", a.Name(), err)
+	}
+
+	return buf.Bytes(), nil
+}
+
+// Validate checks the attachment has a file name and, when inline, a content ID
+func (a Attachment) Validate() error {
+	if a.FileName == "" {
+		return fmt.Errorf("attachment without file name")
+	}
+	if a.Inline && a.ContentID == "" {
+		return fmt.Errorf("inline attachment %s without content id", a.Name())
+	}
+
+	return nil
 }
@@ -2,15 +2,18 @@ package email
 
 import (
 	"bytes"
+	"encoding/base64"
 	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
 	"strings"
-
-	"github.com/mdcantarini/transaction-processor-api/pkg/utils"
+	"time"
 )
 
+// mailtrapTimeout bounds every request to the Mailtrap API, so a hung request cannot block the sender
+const mailtrapTimeout = time.Minute
+
 type Mailtrap struct {
 	FromEmail string
 	Host      string
@@ -23,11 +26,19 @@ type emailData struct {
 	Subject     string              `json:"subject"`
 	Text        string              `json:"text"`
 	HTML        string              `json:"html"`
-	Attachments []map[string]string `json:"attachments"`
+	Attachments []attachmentData    `json:"attachments,omitempty"`
+}
+
+type attachmentData struct {
+	Content     string `json:"content"`
+	FileName    string `json:"filename"`
+	Type        string `json:"type"`
+	Disposition string `json:"disposition"`
+	ContentID   string `json:"content_id,omitempty"`
 }
 
 // SendEmail sends an email using the Mailtrap API: https://api-docs.mailtrap.io/docs/mailtrap-api-docs
-func (mt Mailtrap) SendEmail(to, subject, body string, attachments ...string) error {
+func (mt Mailtrap) SendEmail(to, subject string, body Body, attachments ...Attachment) error {
 	emailData, err := buildEmailData(mt.FromEmail, to, subject, body, attachments...)
 	if err != nil {
 		return err
@@ -38,7 +49,7 @@ func (mt Mailtrap) SendEmail(to, subject, body string, attachments ...string) er
 		return err
 	}
 
-	client := &http.Client{}
+	client := &http.Client{Timeout: mailtrapTimeout}
 	req, err := http.NewRequest("POST", mt.Host, bytes.NewBuffer(jsonPayload))
 	if err != nil {
 		return err
@@ -66,7 +77,7 @@ func (mt Mailtrap) SendEmail(to, subject, body string, attachments ...string) er
 	return nil
 }
 
-func buildEmailData(fromEmail, toEmail, subject, body string, attachments ...string) (*emailData, error) {
+func buildEmailData(fromEmail, toEmail, subject string, body Body, attachments ...Attachment) (*emailData, error) {
 	data := &emailData{}
 
 	data.From = map[string]string{"email": fromEmail}
@@ -74,20 +85,32 @@ func buildEmailData(fromEmail, toEmail, subject, body string, attachments ...str
 		{"email": toEmail},
 	}
 	data.Subject = subject
-	data.HTML = body
+	data.HTML = body.HTML
+	data.Text = body.PlainText()
 
-	for _, attattachment := range attachments {
-		attachmentContentEncoded, err := utils.EncodeFileContent(attattachment)
+	for _, attachment := range attachments {
+		err := attachment.Validate()
 		if err != nil {
 			return nil, err
 		}
 
-		data.Attachments = []map[string]string{
-			{
-				"content":  attachmentContentEncoded,
-				"filename": attattachment,
-			},
+		content, err := attachment.Bytes()
+		if err != nil {
+			return nil, err
+		}
+
+		disposition := "attachment"
+		if attachment.Inline {
+			disposition = "inline"
 		}
+
+		data.Attachments = append(data.Attachments, attachmentData{
+			Content:     base64.StdEncoding.EncodeToString(content),
+			FileName:    attachment.Name(),
+			Type:        attachment.MIMEType(),
+			Disposition: disposition,
+			ContentID:   attachment.ContentID,
+		})
 	}
 
 	return data, nil
@@ -0,0 +1,59 @@
+package email
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestBuildEmailData_Attachments(t *testing.T) {
+	data, err := buildEmailData("from@email.com", "to@email.com", "subject", Body{HTML: `<img src="cid:logo">`},
+		Attachment{FileName: "data/transactions.csv", ContentType: "text/csv", Content: []byte("Id\n1\n")},
+		Attachment{FileName: "report.xlsx", ContentType: "application/vnd.ms-excel", Reader: strings.NewReader("xlsx")},
+		Attachment{FileName: "logo.png", Content: []byte("png"), Inline: true, ContentID: "logo"},
+	)
+	require.NoError(t, err)
+
+	// every attachment is sent, named without its directory, and the type of the logo is guessed from its name
+	require.Equal(t, []attachmentData{
+		{Content: "SWQKMQo=", FileName: "transactions.csv", Type: "text/csv", Disposition: "attachment"},
+		{Content: "eGxzeA==", FileName: "report.xlsx", Type: "application/vnd.ms-excel", Disposition: "attachment"},
+		{Content: "cG5n", FileName: "logo.png", Type: "image/png", Disposition: "inline", ContentID: "logo"},
+	}, data.Attachments)
+}
+
+func TestBuildEmailData_ErrorInlineWithoutContentID(t *testing.T) {
+	_, err := buildEmailData("from@email.com", "to@email.com", "subject", Body{HTML: "body"},
+		Attachment{FileName: "logo.png", Content: []byte("png"), Inline: true},
+	)
+	require.ErrorContains(t, err, "inline attachment logo.png without content id")
+}
+
+func TestMailtrapSendEmail(t *testing.T) {
+	var payload emailData
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "Bearer token", r.Header.Get("Authorization"))
+		body, err := io.ReadAll(r.Body)
+		require.NoError(t, err)
+		require.NoError(t, json.Unmarshal(body, &payload))
+
+		w.Write([]byte(`{"success":true,"message_ids":["1"]}`))
+	}))
+	defer server.Close()
+
+	mt := Mailtrap{FromEmail: "from@email.com", Host: server.URL, Token: "Bearer token"}
+	err := mt.SendEmail("to@email.com", "subject", Body{HTML: "<p>body</p>", Text: "plain body"},
+		Attachment{FileName: "a.csv", Content: []byte("a")},
+		Attachment{FileName: "b.csv", Content: []byte("b")},
+	)
+	require.NoError(t, err)
+	require.Equal(t, "to@email.com", payload.To[0]["email"])
+	require.Equal(t, "<p>body</p>", payload.HTML)
+	require.Equal(t, "plain body", payload.Text)
+	require.Len(t, payload.Attachments, 2)
+}
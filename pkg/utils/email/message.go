@@ -0,0 +1,210 @@
+package email
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"html"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/textproto"
+	"regexp"
+	"strings"
+	"time"
+)
+
+var (
+	lineBreakTags = regexp.MustCompile(`(?i)<br\s*/?>|</(p|div|h[1-6]|li|tr|ul|ol|table)>`)
+	htmlTags      = regexp.MustCompile(`<[^>]*>`)
+	blankLines    = regexp.MustCompile(`\n[ \t]*\n(\s*\n)+`)
+)
+
+// htmlToText returns a plain text version of an HTML body, keeping its text and line breaks
+func htmlToText(body string) string {
+	text := lineBreakTags.ReplaceAllString(body, "$0\n")
+	text = htmlTags.ReplaceAllString(text, "")
+	text = html.UnescapeString(text)
+	text = blankLines.ReplaceAllString(text, "\n\n")
+
+	return strings.TrimSpace(text) + "\n"
+}
+
+// buildMIMEMessage builds an email whose HTML body comes with a plain text alternative. Inline attachments are
+// related to the HTML body, so it can display them, while the rest of them are attached to the whole message.
+func buildMIMEMessage(from, to, subject string, body Body, attachments ...Attachment) ([]byte, error) {
+	var inline, attached []Attachment
+	for _, attachment := range attachments {
+		err := attachment.Validate()
+		if err != nil {
+			return nil, err
+		}
+
+		if attachment.Inline {
+			inline = append(inline, attachment)
+		} else {
+			attached = append(attached, attachment)
+		}
+	}
+
+	contentType, content, err := alternativePart(body)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(inline) > 0 {
+		contentType, content, err = multipartOf("related", contentType, content, inline)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if len(attached) > 0 {
+		contentType, content, err = multipartOf("mixed", contentType, content, attached)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	messageID, err := newMessageID(from)
+	if err != nil {
+		return nil, err
+	}
+
+	var msg bytes.Buffer
+	fmt.Fprintf(&msg, "From: %s\r\n", from)
+	fmt.Fprintf(&msg, "To: %s\r\n", to)
+	fmt.Fprintf(&msg, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", subject))
+	fmt.Fprintf(&msg, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	fmt.Fprintf(&msg, "Message-ID: %s\r\n", messageID)
+	fmt.Fprintf(&msg, "MIME-Version: 1.0\r\n")
+	fmt.Fprintf(&msg, "Content-Type: %s\r\n\r\n", contentType)
+	msg.Write(content)
+
+	return msg.Bytes(), nil
+}
+
+// alternativePart returns the content type and content of the multipart/alternative part holding the body
+// both as plain text and as HTML, the latter being the preferred one
+func alternativePart(body Body) (string, []byte, error) {
+	var buf bytes.Buffer
+	writer := multipart.NewWriter(&buf)
+	for _, part := range []struct{ contentType, content string }{
+		{"text/plain; charset=utf-8", body.PlainText()},
+		{"text/html; charset=utf-8", body.HTML},
+	} {
+		partWriter, err := writer.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {part.contentType},
+			"Content-Transfer-Encoding": {"quoted-printable"},
+		})
+		if err != nil {
+			return "", nil, err
+		}
+
+		qp := quotedprintable.NewWriter(partWriter)
+		_, err = io.WriteString(qp, part.content)
+		if err != nil {
+			return "", nil, err
+		}
+
+		err = qp.Close()
+		if err != nil {
+			return "", nil, err
+		}
+	}
+
+	err := writer.Close()
+	if err != nil {
+		return "", nil, err
+	}
+
+	return "multipart/alternative; boundary=" + writer.Boundary(), buf.Bytes(), nil
+}
+
+// multipartOf returns the content type and content of a multipart part of the given subtype, made of the
+// given first part followed by the attachments
+func multipartOf(subtype, contentType string, content []byte, attachments []Attachment) (string, []byte, error) {
+	var buf bytes.Buffer
+	writer := multipart.NewWriter(&buf)
+	partWriter, err := writer.CreatePart(textproto.MIMEHeader{"Content-Type": {contentType}})
+	if err != nil {
+		return "", nil, err
+	}
+
+	_, err = partWriter.Write(content)
+	if err != nil {
+		return "", nil, err
+	}
+
+	for _, attachment := range attachments {
+		err = writeAttachmentPart(writer, attachment)
+		if err != nil {
+			return "", nil, err
+		}
+	}
+
+	err = writer.Close()
+	if err != nil {
+		return "", nil, err
+	}
+
+	return fmt.Sprintf("multipart/%s; boundary=%s", subtype, writer.Boundary()), buf.Bytes(), nil
+}
+
+func writeAttachmentPart(writer *multipart.Writer, attachment Attachment) error {
+	content, err := attachment.Bytes()
+	if err != nil {
+		return err
+	}
+
+	disposition := "attachment"
+	if attachment.Inline {
+		disposition = "inline"
+	}
+
+	header := textproto.MIMEHeader{
+		"Content-Type":              {mime.FormatMediaType(attachment.MIMEType(), map[string]string{"name": attachment.Name()})},
+		"Content-Disposition":       {mime.FormatMediaType(disposition, map[string]string{"filename": attachment.Name()})},
+		"Content-Transfer-Encoding": {"base64"},
+	}
+	if attachment.ContentID != "" {
+		header.Set("Content-ID", "<"+attachment.ContentID+">")
+	}
+
+	partWriter, err := writer.CreatePart(header)
+	if err != nil {
+		return err
+	}
+
+	// encoded lines must not be longer than 76 characters
+	encoded := base64.StdEncoding.EncodeToString(content)
+	for len(encoded) > 76 {
+		_, err = io.WriteString(partWriter, encoded[:76]+"\r\n")
+		if err != nil {
+			return err
+		}
+		encoded = encoded[76:]
+	}
+
+	_, err = io.WriteString(partWriter, encoded+"\r\n")
+	return err
+}
+
+// newMessageID returns a unique message ID within the domain of the sender address
+func newMessageID(from string) (string, error) {
+	random := make([]byte, 16)
+	_, err := rand.Read(random)
+	if err != nil {
+		return "", err
+	}
+
+	domain := "localhost"
+	if at := strings.LastIndex(from, "@"); at >= 0 {
+		domain = strings.TrimSuffix(from[at+1:], ">")
+	}
+
+	return fmt.Sprintf("<%s@%s>", hex.EncodeToString(random), domain), nil
+}
@@ -0,0 +1,53 @@
+package email
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// RateLimiter spaces out the emails sent to a provider, so its sending limits are not exceeded. It is safe
+// for concurrent use, and a nil RateLimiter does not limit anything.
+type RateLimiter struct {
+	interval time.Duration
+
+	mu sync.Mutex
+	// next is the earliest time the next email can be sent
+	next time.Time
+}
+
+// NewRateLimiter returns a rate limiter allowing the given number of emails per second, or nil when the
+// rate is not positive
+func NewRateLimiter(perSecond float64) *RateLimiter {
+	if perSecond <= 0 {
+		return nil
+	}
+
+	return &RateLimiter{interval: time.Duration(float64(time.Second) / perSecond)}
+}
+
+// Wait blocks until an email can be sent, or until the context is done, in which case its error is returned
+func (rl *RateLimiter) Wait(ctx context.Context) error {
+	if rl == nil {
+		return ctx.Err()
+	}
+
+	rl.mu.Lock()
+	now := time.Now()
+	slot := rl.next
+	if slot.Before(now) {
+		slot = now
+	}
+	rl.next = slot.Add(rl.interval)
+	rl.mu.Unlock()
+
+	timer := time.NewTimer(time.Until(slot))
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
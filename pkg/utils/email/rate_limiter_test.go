@@ -0,0 +1,36 @@
+package email
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRateLimiterWait(t *testing.T) {
+	limiter := NewRateLimiter(50)
+
+	// the first email is sent right away, the following ones every 20ms
+	start := time.Now()
+	for i := 0; i < 4; i++ {
+		require.NoError(t, limiter.Wait(context.Background()))
+	}
+	require.GreaterOrEqual(t, time.Since(start), 60*time.Millisecond)
+}
+
+func TestRateLimiterWait_ContextCancelled(t *testing.T) {
+	limiter := NewRateLimiter(0.1)
+	require.NoError(t, limiter.Wait(context.Background()))
+
+	// the next email would wait ten seconds
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	require.ErrorIs(t, limiter.Wait(ctx), context.DeadlineExceeded)
+}
+
+func TestRateLimiterWait_Unlimited(t *testing.T) {
+	var limiter *RateLimiter = NewRateLimiter(0)
+	require.Nil(t, limiter)
+	require.NoError(t, limiter.Wait(context.Background()))
+}
@@ -0,0 +1,207 @@
+package email
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/smtp"
+	"strconv"
+	"time"
+)
+
+const (
+	// SecurityStartTLS upgrades a plain connection to TLS through the STARTTLS command
+	SecurityStartTLS = "starttls"
+	// SecurityTLS connects through TLS from the start, usually on port 465
+	SecurityTLS = "tls"
+	// SecurityNone never encrypts the connection, it is only meant for local relays
+	SecurityNone = "none"
+
+	AuthPlain = "plain"
+	AuthLogin = "login"
+)
+
+const (
+	smtpDialTimeout = 30 * time.Second
+	// smtpTimeout bounds the whole conversation with the server, so a stalled server cannot block the sender
+	smtpTimeout = 2 * time.Minute
+)
+
+type SMTP struct {
+	FromEmail string
+	Host      string
+	Port      int
+	Username  string
+	Password  string
+	// Security is either SecurityStartTLS, SecurityTLS or SecurityNone, SecurityStartTLS by default
+	Security string
+	// Auth is either AuthPlain or AuthLogin, AuthPlain by default. No authentication happens without username.
+	Auth string
+	// TLSConfig replaces the default TLS configuration, which verifies the certificate against Host
+	TLSConfig *tls.Config
+}
+
+// Validate checks the security and authentication mechanisms are known
+func (s SMTP) Validate() error {
+	switch s.Security {
+	case "", SecurityStartTLS, SecurityTLS, SecurityNone:
+	default:
+		return fmt.Errorf("unknown smtp security %q", s.Security)
+	}
+
+	switch s.Auth {
+	case "", AuthPlain, AuthLogin:
+	default:
+		return fmt.Errorf("unknown smtp auth %q", s.Auth)
+	}
+
+	return nil
+}
+
+// SendEmail sends an email through the SMTP server, the HTML body comes with a plain text alternative
+func (s SMTP) SendEmail(to, subject string, body Body, attachments ...Attachment) error {
+	err := s.Validate()
+	if err != nil {
+		return err
+	}
+
+	msg, err := buildMIMEMessage(s.FromEmail, to, subject, body, attachments...)
+	if err != nil {
+		return err
+	}
+
+	client, err := s.dial()
+	if err != nil {
+		return fmt.Errorf("unable to connect to smtp server %s: %w", s.Host, err)
+	}
+	defer client.Close()
+
+	if s.Security == "" || s.Security == SecurityStartTLS {
+		if ok, _ := client.Extension("STARTTLS"); !ok {
+			return fmt.Errorf("smtp server %s does not support STARTTLS", s.Host)
+		}
+
+		err = client.StartTLS(s.tlsConfig())
+		if err != nil {
+			return err
+		}
+	}
+
+	if s.Username != "" {
+		err = client.Auth(s.auth())
+		if err != nil {
+			return fmt.Errorf("unable to authenticate to smtp server %s: %w", s.Host, err)
+		}
+	}
+
+	err = client.Mail(s.FromEmail)
+	if err != nil {
+		return err
+	}
+
+	err = client.Rcpt(to)
+	if err != nil {
+		return fmt.Errorf("unable to send email to %s; error: %w", to, err)
+	}
+
+	writer, err := client.Data()
+	if err != nil {
+		return err
+	}
+
+	_, err = writer.Write(msg)
+	if err != nil {
+		return err
+	}
+
+	err = writer.Close()
+	if err != nil {
+		return fmt.Errorf("unable to send email to %s; error: %w", to, err)
+	}
+
+	return client.Quit()
+}
+
+func (s SMTP) dial() (*smtp.Client, error) {
+	addr := net.JoinHostPort(s.Host, strconv.Itoa(s.Port))
+	dialer := &net.Dialer{Timeout: smtpDialTimeout}
+
+	var conn net.Conn
+	var err error
+	if s.Security == SecurityTLS {
+		conn, err = tls.DialWithDialer(dialer, "tcp", addr, s.tlsConfig())
+	} else {
+		conn, err = dialer.Dial("tcp", addr)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	err = conn.SetDeadline(time.Now().Add(smtpTimeout))
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	client, err := smtp.NewClient(conn, s.Host)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	return client, nil
+}
+
+func (s SMTP) tlsConfig() *tls.Config {
+	if s.TLSConfig != nil {
+		return s.TLSConfig
+	}
+
+	return &tls.Config{ServerName: s.Host}
+}
+
+func (s SMTP) auth() smtp.Auth {
+	if s.Auth == AuthLogin {
+		return &loginAuth{username: s.Username, password: s.Password, host: s.Host}
+	}
+
+	return smtp.PlainAuth("", s.Username, s.Password, s.Host)
+}
+
+// loginAuth implements the LOGIN authentication mechanism, which net/smtp lacks. Just like PLAIN, it only
+// sends the credentials over TLS, or to a local server.
+type loginAuth struct {
+	username string
+	password string
+	host     string
+}
+
+func (a *loginAuth) Start(server *smtp.ServerInfo) (string, []byte, error) {
+	if !server.TLS && !isLocalhost(server.Name) {
+		return "", nil, fmt.Errorf("unencrypted connection")
+	}
+	if server.Name != a.host {
+		return "", nil, fmt.Errorf("wrong host name")
+	}
+
+	return "LOGIN", nil, nil
+}
+
+func (a *loginAuth) Next(fromServer []byte, more bool) ([]byte, error) {
+	if !more {
+		return nil, nil
+	}
+
+	switch string(fromServer) {
+	case "Username:":
+		return []byte(a.username), nil
+	case "Password:":
+		return []byte(a.password), nil
+	}
+
+	return nil, fmt.Errorf("unexpected server challenge %q", fromServer)
+}
+
+func isLocalhost(name string) bool {
+	return name == "localhost" || name == "127.0.0.1" || name == "::1"
+}
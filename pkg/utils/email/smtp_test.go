@@ -0,0 +1,297 @@
+package email
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"io"
+	"math/big"
+	"mime"
+	"mime/multipart"
+	"net"
+	"net/mail"
+	"net/textproto"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// receivedEmail is an email accepted by the fake SMTP server
+type receivedEmail struct {
+	tls      bool
+	username string
+	password string
+	from     string
+	to       string
+	data     []byte
+}
+
+// fakeSMTPServer is an in-process SMTP server accepting any email, it offers STARTTLS when it has a TLS
+// configuration and it is not already running over TLS
+type fakeSMTPServer struct {
+	listener    net.Listener
+	tlsConfig   *tls.Config
+	implicitTLS bool
+	emails      chan receivedEmail
+}
+
+func newFakeSMTPServer(t *testing.T, tlsConfig *tls.Config, implicitTLS bool) *fakeSMTPServer {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { listener.Close() })
+
+	server := &fakeSMTPServer{listener: listener, tlsConfig: tlsConfig, implicitTLS: implicitTLS, emails: make(chan receivedEmail, 1)}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+
+			go server.serve(conn)
+		}
+	}()
+
+	return server
+}
+
+func (fs *fakeSMTPServer) port() int {
+	return fs.listener.Addr().(*net.TCPAddr).Port
+}
+
+func (fs *fakeSMTPServer) serve(conn net.Conn) {
+	defer conn.Close()
+
+	email := receivedEmail{}
+	if fs.implicitTLS {
+		conn = tls.Server(conn, fs.tlsConfig)
+		email.tls = true
+	}
+
+	text := textproto.NewConn(conn)
+	text.PrintfLine("220 fake ESMTP")
+	for {
+		line, err := text.ReadLine()
+		if err != nil {
+			return
+		}
+
+		command, arg, _ := strings.Cut(line, " ")
+		switch strings.ToUpper(command) {
+		case "EHLO":
+			text.PrintfLine("250-fake")
+			if fs.tlsConfig != nil && !email.tls {
+				text.PrintfLine("250-STARTTLS")
+			}
+			text.PrintfLine("250 AUTH PLAIN LOGIN")
+		case "STARTTLS":
+			text.PrintfLine("220 ready to start TLS")
+			conn = tls.Server(conn, fs.tlsConfig)
+			text = textproto.NewConn(conn)
+			email.tls = true
+		case "AUTH":
+			mechanism, initial, _ := strings.Cut(arg, " ")
+			if mechanism == "PLAIN" {
+				credentials, _ := base64.StdEncoding.DecodeString(initial)
+				parts := strings.Split(string(credentials), "\x00")
+				email.username, email.password = parts[1], parts[2]
+			} else {
+				email.username = fs.challenge(text, "Username:")
+				email.password = fs.challenge(text, "Password:")
+			}
+			text.PrintfLine("235 authenticated")
+		case "MAIL":
+			email.from = strings.TrimSuffix(strings.TrimPrefix(strings.Fields(arg)[0], "FROM:<"), ">")
+			text.PrintfLine("250 ok")
+		case "RCPT":
+			email.to = strings.TrimSuffix(strings.TrimPrefix(arg, "TO:<"), ">")
+			text.PrintfLine("250 ok")
+		case "DATA":
+			text.PrintfLine("354 go ahead")
+			email.data, err = text.ReadDotBytes()
+			if err != nil {
+				return
+			}
+			text.PrintfLine("250 queued")
+			fs.emails <- email
+		case "QUIT":
+			text.PrintfLine("221 bye")
+			return
+		default:
+			text.PrintfLine("250 ok")
+		}
+	}
+}
+
+func (fs *fakeSMTPServer) challenge(text *textproto.Conn, prompt string) string {
+	text.PrintfLine("334 %s", base64.StdEncoding.EncodeToString([]byte(prompt)))
+	line, _ := text.ReadLine()
+	answer, _ := base64.StdEncoding.DecodeString(line)
+
+	return string(answer)
+}
+
+// newTestTLSConfigs returns the TLS configurations of a server with a self-signed certificate for 127.0.0.1
+// and of a client trusting it
+func newTestTLSConfigs(t *testing.T) (server, client *tls.Config) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "127.0.0.1"},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	certificate, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+
+	pool := x509.NewCertPool()
+	pool.AddCert(certificate)
+
+	return &tls.Config{Certificates: []tls.Certificate{{Certificate: [][]byte{der}, PrivateKey: key}}},
+		&tls.Config{ServerName: "127.0.0.1", RootCAs: pool}
+}
+
+func receiveEmail(t *testing.T, server *fakeSMTPServer) receivedEmail {
+	select {
+	case email := <-server.emails:
+		return email
+	case <-time.After(5 * time.Second):
+		t.Fatal("no email received")
+		return receivedEmail{}
+	}
+}
+
+func TestSMTPSendEmail_StartTLS(t *testing.T) {
+	serverTLS, clientTLS := newTestTLSConfigs(t)
+	server := newFakeSMTPServer(t, serverTLS, false)
+
+	sender := SMTP{
+		FromEmail: "from@email.com",
+		Host:      "127.0.0.1",
+		Port:      server.port(),
+		Username:  "user",
+		Password:  "secret",
+		TLSConfig: clientTLS,
+	}
+	err := sender.SendEmail("to@email.com", "Daily report", Body{HTML: "<h1>Report</h1><p>Balance: 10 &amp; more</p>"},
+		Attachment{FileName: "transactions.csv", ContentType: "text/csv", Content: []byte("Id\n1\n")},
+	)
+	require.NoError(t, err)
+
+	email := receiveEmail(t, server)
+	require.True(t, email.tls)
+	require.Equal(t, "user", email.username)
+	require.Equal(t, "secret", email.password)
+	require.Equal(t, "from@email.com", email.from)
+	require.Equal(t, "to@email.com", email.to)
+
+	msg, err := mail.ReadMessage(bytes.NewReader(email.data))
+	require.NoError(t, err)
+	require.Equal(t, "Daily report", msg.Header.Get("Subject"))
+
+	// the message holds the alternative bodies followed by the attachment
+	mediaType, params, err := mime.ParseMediaType(msg.Header.Get("Content-Type"))
+	require.NoError(t, err)
+	require.Equal(t, "multipart/mixed", mediaType)
+	mixed := multipart.NewReader(msg.Body, params["boundary"])
+
+	part, err := mixed.NextPart()
+	require.NoError(t, err)
+	mediaType, params, err = mime.ParseMediaType(part.Header.Get("Content-Type"))
+	require.NoError(t, err)
+	require.Equal(t, "multipart/alternative", mediaType)
+	alternative := multipart.NewReader(part, params["boundary"])
+
+	text, err := alternative.NextPart()
+	require.NoError(t, err)
+	require.Equal(t, "text/plain; charset=utf-8", text.Header.Get("Content-Type"))
+	content, err := io.ReadAll(text)
+	require.NoError(t, err)
+	require.Equal(t, "Report\nBalance: 10 & more\n", string(content))
+
+	html, err := alternative.NextPart()
+	require.NoError(t, err)
+	require.Equal(t, "text/html; charset=utf-8", html.Header.Get("Content-Type"))
+	content, err = io.ReadAll(html)
+	require.NoError(t, err)
+	require.Equal(t, "<h1>Report</h1><p>Balance: 10 &amp; more</p>", string(content))
+
+	attachment, err := mixed.NextPart()
+	require.NoError(t, err)
+	require.Equal(t, "transactions.csv", attachment.FileName())
+	content, err = io.ReadAll(base64.NewDecoder(base64.StdEncoding, attachment))
+	require.NoError(t, err)
+	require.Equal(t, "Id\n1\n", string(content))
+}
+
+func TestSMTPSendEmail_ImplicitTLSWithLoginAuth(t *testing.T) {
+	serverTLS, clientTLS := newTestTLSConfigs(t)
+	server := newFakeSMTPServer(t, serverTLS, true)
+
+	sender := SMTP{
+		FromEmail: "from@email.com",
+		Host:      "127.0.0.1",
+		Port:      server.port(),
+		Username:  "user",
+		Password:  "secret",
+		Security:  SecurityTLS,
+		Auth:      AuthLogin,
+		TLSConfig: clientTLS,
+	}
+	err := sender.SendEmail("to@email.com", "Daily report", Body{HTML: `<img src="cid:logo">`},
+		Attachment{FileName: "logo.png", Content: []byte("png"), Inline: true, ContentID: "logo"},
+	)
+	require.NoError(t, err)
+
+	email := receiveEmail(t, server)
+	require.True(t, email.tls)
+	require.Equal(t, "user", email.username)
+	require.Equal(t, "secret", email.password)
+
+	// inline attachments are related to the body rather than attached to the message
+	msg, err := mail.ReadMessage(bytes.NewReader(email.data))
+	require.NoError(t, err)
+	require.True(t, strings.HasPrefix(msg.Header.Get("Content-Type"), "multipart/related"))
+	require.Contains(t, string(email.data), "Content-Id: <logo>")
+}
+
+func TestSMTPSendEmail_ErrorStartTLSNotSupported(t *testing.T) {
+	server := newFakeSMTPServer(t, nil, false)
+
+	sender := SMTP{FromEmail: "from@email.com", Host: "127.0.0.1", Port: server.port()}
+	err := sender.SendEmail("to@email.com", "Daily report", Body{HTML: "<p>Report</p>"})
+	require.ErrorContains(t, err, "does not support STARTTLS")
+}
+
+func TestSMTPSendEmail_WithoutSecurity(t *testing.T) {
+	server := newFakeSMTPServer(t, nil, false)
+
+	sender := SMTP{FromEmail: "from@email.com", Host: "127.0.0.1", Port: server.port(), Security: SecurityNone}
+	require.NoError(t, sender.SendEmail("to@email.com", "Daily report", Body{HTML: "<p>Report</p>", Text: "Plain report\n"}))
+
+	email := receiveEmail(t, server)
+	require.False(t, email.tls)
+	require.Empty(t, email.username)
+	// the given plain text alternative is sent rather than the one derived from the HTML body
+	require.Contains(t, string(email.data), "Plain report")
+}
+
+func TestSMTPValidate(t *testing.T) {
+	require.NoError(t, SMTP{Security: SecurityTLS, Auth: AuthLogin}.Validate())
+	require.ErrorContains(t, SMTP{Security: "ssl"}.Validate(), `unknown smtp security "ssl"`)
+	require.ErrorContains(t, SMTP{Auth: "cram-md5"}.Validate(), `unknown smtp auth "cram-md5"`)
+}
@@ -1,58 +1,25 @@
 package utils
 
 import (
-	"encoding/base64"
-	"encoding/csv"
+	"crypto/sha256"
+	"encoding/hex"
 	"io"
 	"os"
 )
 
-var ParseCSVFile = parseCSVFile
-
-func parseCSVFile(filepath string) ([][]string, error) {
-	file, err := os.Open(filepath)
-	if err != nil {
-		return nil, err
-	}
-	defer file.Close()
-
-	reader := csv.NewReader(file)
-
-	var records [][]string
-	for {
-		record, err := reader.Read()
-		if err != nil {
-			if err == io.EOF {
-				// reached the end of the file
-				break
-			}
-
-			// any other type of error must finish the execution
-			return nil, err
-		}
-
-		records = append(records, record)
-	}
-	
-	return records[1:], nil
-}
-
-func EncodeFileContent(filePath string) (string, error) {
+// FileSHA256 returns the hex encoded SHA-256 checksum of the file content
+func FileSHA256(filePath string) (string, error) {
 	file, err := os.Open(filePath)
 	if err != nil {
 		return "", err
 	}
 	defer file.Close()
 
-	// Read the file contents
-	fileBytes, err := io.ReadAll(file)
+	hash := sha256.New()
+	_, err = io.Copy(hash, file)
 	if err != nil {
 		return "", err
 	}
 
-	// Encode the file content to base64
-	encoded := base64.StdEncoding.EncodeToString(fileBytes)
-
-	// Print the base64 encoded string
-	return encoded, nil
+	return hex.EncodeToString(hash.Sum(nil)), nil
 }